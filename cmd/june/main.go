@@ -8,6 +8,7 @@ import (
 	"syscall"
 
 	"github.com/alecthomas/kong"
+	"github.com/kscarlett/june/internal/diag"
 	"github.com/kscarlett/june/internal/generate"
 	"github.com/kscarlett/june/internal/watch"
 )
@@ -19,15 +20,90 @@ var (
 	date    = "unknown"
 )
 
+// pageFlags are the options for building pages, shared by the generate
+// and site commands.
+type pageFlags struct {
+	Ugc      bool   `optional help:"Whether to treat the markdown as untrusted."`
+	Style    string `optional help:"Path to a CSS, SCSS or Sass file for styling, or embedded:<name> for a built-in style." default:"embedded:simple"`
+	Template string `optional help:"Path to a gohtml template file or a directory of layouts and partials, or embedded:<name> for a built-in template." default:"embedded:default"`
+	Schema   string `optional help:"Path to a frontmatter schema (YAML, TOML, JSON or JSON Schema)." type:"path"`
+	Strict   bool   `optional help:"Treat frontmatter warnings as errors."`
+	Static   string `optional help:"Directory copied into the output directory. Defaults to static/ next to the input." type:"path"`
+	Assets   bool   `optional help:"Copy local files referenced by images and links into the output directory." default:"true" negatable:""`
+
+	SelfContained bool  `optional help:"Embed images, stylesheets and scripts so the page works offline as a single file."`
+	InlineLimit   int64 `optional help:"Largest file, in KiB, to embed in --self-contained mode. 0 means no limit." default:"1024"`
+	InlineFonts   bool  `optional help:"Also embed fonts referenced from CSS in --self-contained mode."`
+	InlineSvg     bool  `optional help:"Embed SVG images as inline markup in --self-contained mode."`
+	Minify        bool  `optional help:"Minify the output HTML, including inline CSS, JavaScript and SVG."`
+
+	TitleFromHeading  bool `optional help:"Use the first heading as the title if frontmatter has none." default:"true" negatable:""`
+	DescFromParagraph bool `optional help:"Use the first paragraph as the description if frontmatter has none." default:"true" negatable:""`
+	StripTitleHeading bool `optional help:"Remove the first heading from the body when it repeats the title."`
+
+	Markdown   map[string]bool `optional help:"Turn markdown features on or off, e.g. typographer=false,definition-list=true." mapsep:","`
+	Typography string          `optional help:"Path to per-locale typography overrides (YAML, TOML or JSON)." type:"path"`
+	Shortcodes string          `optional help:"Directory of shortcode templates. Defaults to shortcodes/ next to the input." type:"path"`
+	Data       string          `optional help:"Directory of YAML, TOML, JSON and CSV data files for templates. Defaults to data/ next to the input." type:"path"`
+}
+
+// config returns the page options, without an input or output.
+func (f pageFlags) config() generate.GenerateConfig {
+	return generate.GenerateConfig{
+		Style:      f.Style,
+		Template:   f.Template,
+		Ugc:        f.Ugc,
+		Schema:     f.Schema,
+		Strict:     f.Strict,
+		Static:     f.Static,
+		CopyAssets: f.Assets,
+
+		SelfContained: f.SelfContained,
+		InlineLimit:   f.InlineLimit * 1024,
+		InlineFonts:   f.InlineFonts,
+		InlineSVG:     f.InlineSvg,
+		Minify:        f.Minify,
+
+		Fallbacks: generate.Fallbacks{
+			TitleFromHeading:  f.TitleFromHeading,
+			DescFromParagraph: f.DescFromParagraph,
+			StripTitleHeading: f.StripTitleHeading,
+		},
+		Markdown:   generate.Markdown(f.Markdown),
+		Typography: f.Typography,
+		Shortcodes: f.Shortcodes,
+		Data:       f.Data,
+	}
+}
+
 var CLI struct {
 	Generate struct {
-		Input    string `arg name:"file" help:"Input file to generate from." type:"existingfile"`
-		Output   string `optional help:"Where to output the file." short:"o" default:"public/index.html" type:"path"`
-		Ugc      bool   `optional help:"Whether to treat the markdown as untrusted."`
-		Watch    bool   `optional help:"Watches for changes to your markdown and updates the html."`
-		Style    string `optional help:"Path to a CSS file for styling." default:"embedded style"`
-		Template string `optional help:"Path to a gohtml template file." default:"embedded template"`
+		Input  string `arg name:"file" help:"Input file to generate from." type:"existingfile"`
+		Output string `optional help:"Where to output the file." short:"o" default:"public/index.html" type:"path"`
+		Watch  bool   `optional help:"Watches for changes to your markdown and updates the html."`
+
+		Page pageFlags `embed:""`
 	} `cmd help:"Generate HTML output from Markdown file."`
+	Site struct {
+		Dir     string `arg name:"dir" help:"Directory of markdown pages to generate from." type:"existingdir"`
+		Output  string `optional help:"Directory to write the site to." short:"o" default:"public" type:"path"`
+		BaseURL string `optional name:"base-url" help:"Absolute URL the site is served from, like https://example.com/. Needed for feeds."`
+		Title   string `optional help:"Site title for feeds. Defaults to the title of index.md."`
+
+		TagPages bool `optional help:"Write a page for every tag and an index of the tags." default:"true" negatable:""`
+
+		Feeds     bool `optional help:"Write RSS and Atom feeds of the dated pages."`
+		FeedFull  bool `optional help:"Put whole pages in feeds instead of their descriptions."`
+		TagFeeds  bool `optional help:"Also write a feed for every tag."`
+		FeedLimit int  `optional help:"Most entries in a feed. 0 means no limit." default:"20"`
+
+		Sitemap    bool     `optional help:"Write sitemap.xml when --base-url is set." default:"true" negatable:""`
+		Robots     bool     `optional help:"Write robots.txt." default:"true" negatable:""`
+		RobotsFile string   `optional help:"robots.txt to use instead of generated rules. Defaults to robots.txt in the static directory." type:"existingfile"`
+		Disallow   []string `optional help:"Paths crawlers are asked to stay out of in the generated robots.txt, e.g. /drafts/,/tmp/."`
+
+		Page pageFlags `embed:""`
+	} `cmd help:"Generate a site from a directory of Markdown files."`
 	Version struct{} `cmd help:"Show the current version"`
 }
 
@@ -43,6 +119,8 @@ func main() {
 
 	switch ctx.Command() {
 	case "generate <file>":
+		cfg := CLI.Generate.Page.config()
+		cfg.Input, cfg.Output = CLI.Generate.Input, CLI.Generate.Output
 		if CLI.Generate.Watch {
 			// Set up context that cancels on interrupt signal (Ctrl+C)
 			ctx, cancel := signal.NotifyContext(
@@ -50,29 +128,41 @@ func main() {
 				os.Interrupt, syscall.SIGTERM,
 			)
 			defer cancel()
-			if err := watch.Run(
-				ctx,
-				CLI.Generate.Input,
-				CLI.Generate.Output,
-				CLI.Generate.Ugc,
-				CLI.Generate.Style,
-				CLI.Generate.Template,
-			); err != nil {
+			if err := watch.Run(ctx, cfg); err != nil {
 				fmt.Fprintln(os.Stderr, "Error starting watcher:", err)
 				os.Exit(1)
 			}
 		} else {
-			if err := generate.Generate(generate.GenerateConfig{
-				Input:    CLI.Generate.Input,
-				Output:   CLI.Generate.Output,
-				Style:    CLI.Generate.Style,
-				Template: CLI.Generate.Template,
-				Ugc:      CLI.Generate.Ugc,
-			}); err != nil {
-				fmt.Fprintln(os.Stderr, "Error:", err)
+			if err := generate.Generate(cfg); err != nil {
+				diag.Print(os.Stderr, err)
 				os.Exit(1)
 			}
 		}
+	case "site <dir>":
+		cfg := generate.SiteConfig{
+			Page:    CLI.Site.Page.config(),
+			Input:   CLI.Site.Dir,
+			Output:  CLI.Site.Output,
+			BaseURL: CLI.Site.BaseURL,
+			Title:   CLI.Site.Title,
+			Feeds: generate.FeedConfig{
+				Enabled: CLI.Site.Feeds || CLI.Site.TagFeeds,
+				Full:    CLI.Site.FeedFull,
+				Tags:    CLI.Site.TagFeeds,
+				Limit:   CLI.Site.FeedLimit,
+			},
+			TagPages: CLI.Site.TagPages,
+			Sitemap:  CLI.Site.Sitemap,
+			Robots: generate.RobotsConfig{
+				Enabled:  CLI.Site.Robots,
+				File:     CLI.Site.RobotsFile,
+				Disallow: CLI.Site.Disallow,
+			},
+		}
+		if _, err := generate.BuildSite(cfg); err != nil {
+			diag.Print(os.Stderr, err)
+			os.Exit(1)
+		}
 	case "version":
 		fmt.Println(generate.VersionString())
 	default:
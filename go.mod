@@ -5,25 +5,28 @@ go 1.23
 toolchain go1.23.2
 
 require (
+	github.com/BurntSushi/toml v1.2.1
 	github.com/alecthomas/kong v1.11.0
+	github.com/bep/godartsass/v2 v2.5.0
+	github.com/tdewolff/minify/v2 v2.21.3
 	github.com/yuin/goldmark v1.7.12
+	golang.org/x/text v0.21.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
-	github.com/BurntSushi/toml v1.2.1 // indirect
-	github.com/bep/godartsass/v2 v2.5.0 // indirect
 	github.com/bep/golibsass v1.2.0 // indirect
-	golang.org/x/sys v0.21.0 // indirect
+	github.com/tdewolff/parse/v2 v2.7.19 // indirect
+	golang.org/x/sys v0.25.0 // indirect
 	google.golang.org/protobuf v1.35.2 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
 
 require (
 	github.com/aymerick/douceur v0.2.0 // indirect
 	github.com/fsnotify/fsnotify v1.9.0
 	github.com/gorilla/css v1.0.1 // indirect
-	github.com/microcosm-cc/bluemonday v1.0.27 // indirect
+	github.com/microcosm-cc/bluemonday v1.0.27
 	github.com/pkg/errors v0.9.1 // indirect
 	go.abhg.dev/goldmark/frontmatter v0.2.0
-	golang.org/x/net v0.26.0 // indirect
+	golang.org/x/net v0.26.0
 )
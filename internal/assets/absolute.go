@@ -0,0 +1,84 @@
+package assets
+
+import (
+	"bytes"
+	"io"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// Absolute rewrites the relative URLs in the HTML fragment body against
+// base, for copies of a page read elsewhere, like feed readers. URLs that are
+// already absolute and fragment-only links are left alone.
+func Absolute(body []byte, base string) ([]byte, error) {
+	b, err := url.Parse(base)
+	if err != nil {
+		return nil, err
+	}
+	resolve := func(ref string) (string, bool) {
+		ref = strings.TrimSpace(ref)
+		if ref == "" || strings.HasPrefix(ref, "#") {
+			return ref, false
+		}
+		r, err := url.Parse(ref)
+		if err != nil || r.IsAbs() {
+			return ref, false
+		}
+		return b.ResolveReference(r).String(), true
+	}
+
+	var out bytes.Buffer
+	z := html.NewTokenizer(bytes.NewReader(body))
+	for {
+		tt := z.Next()
+		switch tt {
+		case html.ErrorToken:
+			if err := z.Err(); err != io.EOF {
+				return nil, err
+			}
+			return out.Bytes(), nil
+		case html.StartTagToken, html.SelfClosingTagToken:
+			raw := append([]byte(nil), z.Raw()...)
+			tok := z.Token()
+			changed := false
+			for i, a := range tok.Attr {
+				if !contains(urlAttrs[tok.Data], a.Key) {
+					continue
+				}
+				var ok bool
+				if a.Key == "srcset" {
+					tok.Attr[i].Val, ok = absoluteSrcset(a.Val, resolve)
+				} else {
+					tok.Attr[i].Val, ok = resolve(a.Val)
+				}
+				changed = changed || ok
+			}
+			if changed {
+				out.WriteString(tok.String())
+			} else {
+				out.Write(raw)
+			}
+			continue
+		}
+		out.Write(z.Raw())
+	}
+}
+
+func absoluteSrcset(val string, resolve func(string) (string, bool)) (string, bool) {
+	candidates := strings.Split(val, ",")
+	changed := false
+	for i, c := range candidates {
+		f := strings.Fields(c)
+		if len(f) == 0 {
+			continue
+		}
+		if abs, ok := resolve(f[0]); ok {
+			f[0] = abs
+			candidates[i] = strings.Join(f, " ")
+			changed = true
+		}
+	}
+	return strings.Join(candidates, ", "), changed
+}
@@ -0,0 +1,212 @@
+// Package assets copies the files a page depends on next to the generated
+// HTML: a static directory, and local files referenced from the page.
+package assets
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// urlAttrs lists, per element, the attributes that hold a URL of a resource
+// the page uses.
+var urlAttrs = map[string][]string{
+	"a":      {"href"},
+	"img":    {"src", "srcset"},
+	"source": {"src", "srcset"},
+	"video":  {"src", "poster"},
+	"audio":  {"src"},
+	"track":  {"src"},
+	"embed":  {"src"},
+	"object": {"data"},
+	"iframe": {"src"},
+	"link":   {"href"},
+}
+
+// pageExts are link targets that are other pages rather than assets.
+var pageExts = map[string]bool{
+	".md":       true,
+	".markdown": true,
+	".html":     true,
+	".htm":      true,
+}
+
+// References returns the relative, local paths referenced by the HTML in
+// body, in the order they first appear. Remote URLs, site-absolute paths,
+// fragments and links to other pages are left out.
+func References(body []byte) []string {
+	var refs []string
+	seen := make(map[string]bool)
+	add := func(ref string) {
+		if p, ok := LocalPath(ref); ok && !seen[p] {
+			seen[p] = true
+			refs = append(refs, p)
+		}
+	}
+
+	z := html.NewTokenizer(bytes.NewReader(body))
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return refs
+		case html.StartTagToken, html.SelfClosingTagToken:
+			tok := z.Token()
+			attrs := urlAttrs[tok.Data]
+			for _, a := range tok.Attr {
+				if !contains(attrs, a.Key) {
+					continue
+				}
+				if a.Key == "srcset" {
+					for _, c := range strings.Split(a.Val, ",") {
+						if f := strings.Fields(c); len(f) > 0 {
+							add(f[0])
+						}
+					}
+					continue
+				}
+				if tok.Data == "a" && pageExts[strings.ToLower(path.Ext(stripQuery(a.Val)))] {
+					continue
+				}
+				add(a.Val)
+			}
+		}
+	}
+}
+
+// LocalPath reports whether ref points to a file relative to the page, and
+// returns its cleaned, unescaped slash-separated path.
+func LocalPath(ref string) (string, bool) {
+	ref = strings.TrimSpace(ref)
+	u, err := url.Parse(ref)
+	if err != nil || u.Scheme != "" || u.Host != "" || u.Opaque != "" {
+		return "", false
+	}
+	if u.Path == "" || strings.HasPrefix(u.Path, "/") {
+		return "", false
+	}
+	return path.Clean(u.Path), true
+}
+
+// outside reports whether a path from LocalPath leaves the directory it is
+// relative to.
+func outside(p string) bool {
+	return p == ".." || strings.HasPrefix(p, "../")
+}
+
+func stripQuery(ref string) string {
+	if i := strings.IndexAny(ref, "?#"); i >= 0 {
+		return ref[:i]
+	}
+	return ref
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// CopyReferences copies each referenced path from srcDir to the same
+// relative location under dstDir. It returns a warning for every reference
+// that can't be copied; only failures to write are returned as errors.
+func CopyReferences(srcDir, dstDir string, refs []string) (warnings []string, err error) {
+	for _, ref := range refs {
+		if outside(ref) {
+			warnings = append(warnings, fmt.Sprintf("not copying %s: it is outside the input directory", ref))
+			continue
+		}
+		src := filepath.Join(srcDir, filepath.FromSlash(ref))
+		info, statErr := os.Stat(src)
+		if statErr != nil {
+			warnings = append(warnings, fmt.Sprintf("referenced file %s not found", src))
+			continue
+		}
+		if info.IsDir() {
+			continue
+		}
+		if err := CopyFile(src, filepath.Join(dstDir, filepath.FromSlash(ref))); err != nil {
+			return warnings, err
+		}
+	}
+	return warnings, nil
+}
+
+// CopyDir copies the contents of srcDir into dstDir, skipping hidden files
+// and anything inside dstDir itself.
+func CopyDir(srcDir, dstDir string) error {
+	absDst, err := filepath.Abs(dstDir)
+	if err != nil {
+		return err
+	}
+	return filepath.WalkDir(srcDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if p != srcDir && strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			if abs, err := filepath.Abs(p); err == nil && abs == absDst {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(srcDir, p)
+		if err != nil {
+			return err
+		}
+		return CopyFile(p, filepath.Join(dstDir, rel))
+	})
+}
+
+// CopyFile copies src to dst, creating directories as needed. The copy is
+// skipped if dst already has the same size and is at least as new as src.
+func CopyFile(src, dst string) error {
+	srcInfo, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	if dstInfo, err := os.Stat(dst); err == nil {
+		if os.SameFile(srcInfo, dstInfo) {
+			return nil
+		}
+		if dstInfo.Size() == srcInfo.Size() && !dstInfo.ModTime().Before(srcInfo.ModTime()) {
+			return nil
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return fmt.Errorf("failed to create directory for %s: %w", dst, err)
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", dst, err)
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return fmt.Errorf("failed to copy %s to %s: %w", src, dst, err)
+	}
+	if err := out.Close(); err != nil {
+		return fmt.Errorf("failed to copy %s to %s: %w", src, dst, err)
+	}
+	return os.Chtimes(dst, srcInfo.ModTime(), srcInfo.ModTime())
+}
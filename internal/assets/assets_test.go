@@ -0,0 +1,253 @@
+package assets
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReferences(t *testing.T) {
+	body := []byte(`<p><img src="img/logo.png" alt="logo">
+<a href="files/report%20v2.pdf">report</a>
+<a href="https://example.com/x.png">remote</a>
+<a href="/absolute.png">absolute</a>
+<a href="#section">fragment</a>
+<a href="other.md">page</a>
+<a href="mailto:me@example.com">mail</a>
+<img src="./img/logo.png">
+<img srcset="img/small.jpg 1x, img/large.jpg 2x">
+<video src="media/clip.mp4" poster="media/poster.jpg?v=2"></video>
+<a href="../outside.txt">outside</a></p>`)
+
+	want := []string{
+		"img/logo.png",
+		"files/report v2.pdf",
+		"img/small.jpg",
+		"img/large.jpg",
+		"media/clip.mp4",
+		"media/poster.jpg",
+		"../outside.txt",
+	}
+	if got := References(body); !reflect.DeepEqual(got, want) {
+		t.Errorf("References() = %q, want %q", got, want)
+	}
+}
+
+func TestCopyReferences(t *testing.T) {
+	src := t.TempDir()
+	dst := t.TempDir()
+	writeFile(t, filepath.Join(src, "img", "logo.png"), "png")
+
+	warnings, err := CopyReferences(src, dst, []string{"img/logo.png", "missing.pdf", "../outside.txt"})
+	if err != nil {
+		t.Fatalf("CopyReferences() error = %v", err)
+	}
+	if len(warnings) != 2 {
+		t.Errorf("CopyReferences() warnings = %q, want 2", warnings)
+	}
+	if got := readFile(t, filepath.Join(dst, "img", "logo.png")); got != "png" {
+		t.Errorf("copied file = %q, want %q", got, "png")
+	}
+}
+
+func TestCopyDir(t *testing.T) {
+	src := t.TempDir()
+	writeFile(t, filepath.Join(src, "robots.txt"), "robots")
+	writeFile(t, filepath.Join(src, "fonts", "a.woff2"), "font")
+	writeFile(t, filepath.Join(src, ".hidden"), "secret")
+	dst := filepath.Join(t.TempDir(), "public")
+
+	if err := CopyDir(src, dst); err != nil {
+		t.Fatalf("CopyDir() error = %v", err)
+	}
+	if got := readFile(t, filepath.Join(dst, "robots.txt")); got != "robots" {
+		t.Errorf("robots.txt = %q, want %q", got, "robots")
+	}
+	if got := readFile(t, filepath.Join(dst, "fonts", "a.woff2")); got != "font" {
+		t.Errorf("fonts/a.woff2 = %q, want %q", got, "font")
+	}
+	if _, err := os.Stat(filepath.Join(dst, ".hidden")); !os.IsNotExist(err) {
+		t.Errorf("hidden file was copied, want skipped")
+	}
+
+	t.Run("output inside static directory", func(t *testing.T) {
+		nested := filepath.Join(src, "public")
+		if err := CopyDir(src, nested); err != nil {
+			t.Fatalf("CopyDir() error = %v", err)
+		}
+		if err := CopyDir(src, nested); err != nil {
+			t.Fatalf("CopyDir() second run error = %v", err)
+		}
+		if _, err := os.Stat(filepath.Join(nested, "public")); !os.IsNotExist(err) {
+			t.Errorf("output directory was copied into itself")
+		}
+	})
+}
+
+func TestCopyFileUpdates(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "a.txt")
+	dst := filepath.Join(dir, "out", "a.txt")
+	writeFile(t, src, "one")
+	if err := CopyFile(src, dst); err != nil {
+		t.Fatalf("CopyFile() error = %v", err)
+	}
+	writeFile(t, src, "two!")
+	if err := CopyFile(src, dst); err != nil {
+		t.Fatalf("CopyFile() error = %v", err)
+	}
+	if got := readFile(t, dst); got != "two!" {
+		t.Errorf("CopyFile() dst = %q, want updated contents", got)
+	}
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestInline(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "img", "dot.png"), "\x89PNG\r\n\x1a\nfake")
+	writeFile(t, filepath.Join(dir, "big.jpg"), strings.Repeat("x", 2048))
+	writeFile(t, filepath.Join(dir, "icon.svg"), `<?xml version="1.0"?>`+"\n"+`<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 1 1"><rect/></svg>`)
+	writeFile(t, filepath.Join(dir, "font.woff2"), "woff2")
+	writeFile(t, filepath.Join(dir, "app.js"), `console.log("</script>")`)
+	writeFile(t, filepath.Join(dir, "extra.css"), `p { background: url(img/dot.png) }`)
+
+	page := []byte(`<!DOCTYPE html>
+<html><head>
+<style>body > p { font-family: x; } @font-face { src: url("font.woff2") } .a { background: url('img/dot.png') }</style>
+<link rel="stylesheet" href="extra.css">
+<link rel="stylesheet" href="https://cdn.example.com/remote.css">
+<script src="app.js"></script>
+</head><body>
+<p><img src="img/dot.png" alt="dot"> <img src="big.jpg"> <img src="icon.svg" alt="Icon &amp; more" class="logo">
+<img src="https://example.com/remote.png"> <a href="img/dot.png">download</a></p>
+<pre>  keep   this  </pre>
+</body></html>`)
+
+	t.Run("images and files", func(t *testing.T) {
+		out, warnings, err := Inline(page, InlineOptions{BaseDir: dir, MaxSize: 1024})
+		if err != nil {
+			t.Fatalf("Inline() error = %v", err)
+		}
+		got := string(out)
+		for _, want := range []string{
+			`<img src="data:image/png;base64,`,
+			`alt="dot"`,
+			`<img src="big.jpg">`,
+			`<img src="data:image/svg+xml;base64,`,
+			`<style>p { background: url("data:image/png;base64,`,
+			`<link rel="stylesheet" href="https://cdn.example.com/remote.css">`,
+			`<script>console.log("<\/script>")</script>`,
+			`<a href="img/dot.png">download</a>`,
+			`body > p { font-family: x; }`,
+			`url("font.woff2")`,
+			`.a { background: url("data:image/png;base64,`,
+			`<pre>  keep   this  </pre>`,
+		} {
+			if !strings.Contains(got, want) {
+				t.Errorf("Inline() output does not contain %q:\n%s", want, got)
+			}
+		}
+
+		wantWarnings := []string{
+			"big.jpg is not inlined",
+			"remote resource https://cdn.example.com/remote.css",
+			"remote resource https://example.com/remote.png",
+			"font font.woff2 is not inlined",
+		}
+		for _, want := range wantWarnings {
+			found := false
+			for _, w := range warnings {
+				found = found || strings.Contains(w, want)
+			}
+			if !found {
+				t.Errorf("Inline() warnings = %q, want one containing %q", warnings, want)
+			}
+		}
+	})
+
+	t.Run("fonts and svg markup", func(t *testing.T) {
+		out, _, err := Inline(page, InlineOptions{BaseDir: dir, Fonts: true, SVG: true})
+		if err != nil {
+			t.Fatalf("Inline() error = %v", err)
+		}
+		got := string(out)
+		if !strings.Contains(got, `url("data:font/woff2;base64,`) {
+			t.Errorf("Inline() did not embed font:\n%s", got)
+		}
+		if !strings.Contains(got, `<svg role="img" aria-label="Icon &amp; more" class="logo" xmlns="http://www.w3.org/2000/svg"`) {
+			t.Errorf("Inline() did not embed svg markup:\n%s", got)
+		}
+		if strings.Contains(got, "<?xml") {
+			t.Errorf("Inline() kept the XML prolog of the svg")
+		}
+		if !strings.Contains(got, `<img src="data:image/jpeg;base64,`) {
+			t.Errorf("Inline() with no limit did not embed big.jpg:\n%s", got)
+		}
+	})
+	t.Run("files outside the base directory", func(t *testing.T) {
+		site := filepath.Join(dir, "site")
+		writeFile(t, filepath.Join(site, "page.md"), "")
+		page := []byte(`<img src="../img/dot.png"><img src="sub/../../icon.svg"><style>p { background: url(../img/dot.png) }</style>`)
+		out, warnings, err := Inline(page, InlineOptions{BaseDir: site, StyleDir: site, SVG: true})
+		if err != nil {
+			t.Fatalf("Inline() error = %v", err)
+		}
+		if string(out) != string(page) {
+			t.Errorf("Inline() = %s, want files outside %s left alone", out, site)
+		}
+		if len(warnings) == 0 || !strings.Contains(warnings[0], "outside the input directory") {
+			t.Errorf("Inline() warnings = %q, want the references outside reported", warnings)
+		}
+	})
+
+	t.Run("skipped files", func(t *testing.T) {
+		page := []byte(`<img src="img/dot.png"><img src="./icon.svg">`)
+		out, _, err := Inline(page, InlineOptions{BaseDir: dir, SVG: true, Skip: []string{"img/dot.png", "icon.svg"}})
+		if err != nil {
+			t.Fatalf("Inline() error = %v", err)
+		}
+		if string(out) != string(page) {
+			t.Errorf("Inline() = %s, want skipped files left alone", out)
+		}
+	})
+}
+
+func TestAbsolute(t *testing.T) {
+	body := []byte(`<p><img src="img/logo.png" alt="a &amp; b">
+<a href="../about/">about</a> <a href="/feed.xml">feed</a>
+<a href="https://example.com/x">remote</a> <a href="#top">top</a>
+<a href="mailto:me@example.com">mail</a>
+<img srcset="small.jpg 1x, large.jpg 2x"></p>`)
+	want := `<p><img src="https://example.com/blog/post/img/logo.png" alt="a &amp; b">
+<a href="https://example.com/blog/about/">about</a> <a href="https://example.com/feed.xml">feed</a>
+<a href="https://example.com/x">remote</a> <a href="#top">top</a>
+<a href="mailto:me@example.com">mail</a>
+<img srcset="https://example.com/blog/post/small.jpg 1x, https://example.com/blog/post/large.jpg 2x"></p>`
+	got, err := Absolute(body, "https://example.com/blog/post/")
+	if err != nil {
+		t.Fatalf("Absolute() error = %v", err)
+	}
+	if string(got) != want {
+		t.Errorf("Absolute() =\n%s\nwant\n%s", got, want)
+	}
+}
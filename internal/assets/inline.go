@@ -0,0 +1,399 @@
+package assets
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// InlineOptions controls how Inline embeds a page's resources.
+type InlineOptions struct {
+	// BaseDir is the directory relative paths in the page are resolved
+	// against, normally the directory of the markdown file.
+	BaseDir string
+
+	// StyleDir is tried before BaseDir for url() references inside
+	// <style> elements, since those are relative to the stylesheet.
+	StyleDir string
+
+	// MaxSize is the largest file, in bytes, that is inlined. Larger files
+	// are left as references. Zero means no limit.
+	MaxSize int64
+
+	// Fonts inlines fonts referenced from CSS url() values.
+	Fonts bool
+
+	// SVG replaces <img> elements showing an SVG with the SVG markup itself
+	// rather than a data URI, so it can be styled with CSS.
+	SVG bool
+
+	// Skip lists paths, as LocalPath returns them, that are left as
+	// references. Pages from untrusted authors skip every file their content
+	// references, so it can't pull files from the host into the output.
+	Skip []string
+}
+
+// resourceAttrs lists the attributes that load a resource into the page, as
+// opposed to linking to another document.
+var resourceAttrs = map[string][]string{
+	"img":    {"src", "srcset"},
+	"source": {"src", "srcset"},
+	"video":  {"src", "poster"},
+	"audio":  {"src"},
+	"track":  {"src"},
+	"embed":  {"src"},
+	"object": {"data"},
+	"iframe": {"src"},
+	"input":  {"src"},
+	"script": {"src"},
+	"link":   {"href"},
+}
+
+var fontExts = map[string]bool{
+	".woff":  true,
+	".woff2": true,
+	".ttf":   true,
+	".otf":   true,
+	".eot":   true,
+}
+
+// cssURL matches url() values in CSS, quoted or not.
+var cssURL = regexp.MustCompile(`url\(\s*(?:"([^"]*)"|'([^']*)'|([^)'"\s]*))\s*\)`)
+
+// Inline rewrites a complete HTML page so that it doesn't depend on any
+// local file: images become data URIs, local stylesheets and scripts are
+// embedded, and fonts and SVGs are embedded if asked for. It returns a
+// warning for every resource that stays external.
+func Inline(page []byte, opts InlineOptions) ([]byte, []string, error) {
+	in := &inliner{opts: opts, warned: make(map[string]bool)}
+
+	var out bytes.Buffer
+	z := html.NewTokenizer(bytes.NewReader(page))
+	inStyle := false
+	for {
+		tt := z.Next()
+		switch tt {
+		case html.ErrorToken:
+			if err := z.Err(); err != io.EOF {
+				return nil, in.warnings, err
+			}
+			return out.Bytes(), in.warnings, nil
+		case html.TextToken:
+			if inStyle {
+				out.WriteString(in.css(string(z.Raw())))
+				continue
+			}
+		case html.StartTagToken, html.SelfClosingTagToken:
+			raw := append([]byte(nil), z.Raw()...)
+			tok := z.Token()
+			inStyle = tok.Data == "style" && tt == html.StartTagToken
+			if replaced, ok := in.element(tok); ok {
+				out.WriteString(replaced)
+			} else {
+				out.Write(raw)
+			}
+			continue
+		case html.EndTagToken:
+			inStyle = false
+		}
+		out.Write(z.Raw())
+	}
+}
+
+type inliner struct {
+	opts     InlineOptions
+	warnings []string
+	warned   map[string]bool
+}
+
+func (in *inliner) warn(format string, args ...any) {
+	msg := fmt.Sprintf(format, args...)
+	if !in.warned[msg] {
+		in.warned[msg] = true
+		in.warnings = append(in.warnings, msg)
+	}
+}
+
+// element returns the replacement markup for a start tag, or false if the
+// tag should be written out unchanged.
+func (in *inliner) element(tok html.Token) (string, bool) {
+	attrs := resourceAttrs[tok.Data]
+	if len(attrs) == 0 {
+		return "", false
+	}
+
+	switch tok.Data {
+	case "link":
+		return in.link(tok)
+	case "script":
+		return in.script(tok)
+	case "img":
+		if in.opts.SVG {
+			if svg, ok := in.svg(tok); ok {
+				return svg, true
+			}
+		}
+	}
+
+	changed := false
+	for i, a := range tok.Attr {
+		if !contains(attrs, a.Key) {
+			continue
+		}
+		var val string
+		var ok bool
+		if a.Key == "srcset" {
+			val, ok = in.srcset(a.Val)
+		} else {
+			val, ok = in.dataURI(a.Val, nil)
+		}
+		if ok {
+			tok.Attr[i].Val = val
+			changed = true
+		}
+	}
+	if !changed {
+		return "", false
+	}
+	return tok.String(), true
+}
+
+func (in *inliner) srcset(val string) (string, bool) {
+	candidates := strings.Split(val, ",")
+	changed := false
+	for i, c := range candidates {
+		f := strings.Fields(c)
+		if len(f) == 0 {
+			continue
+		}
+		if uri, ok := in.dataURI(f[0], nil); ok {
+			f[0] = uri
+			candidates[i] = strings.Join(f, " ")
+			changed = true
+		}
+	}
+	return strings.Join(candidates, ", "), changed
+}
+
+// link embeds a local stylesheet as a <style> element and turns icons into
+// data URIs. Other link types are left alone.
+func (in *inliner) link(tok html.Token) (string, bool) {
+	rel := strings.ToLower(attr(tok, "rel"))
+	href := attr(tok, "href")
+	switch {
+	case hasToken(rel, "stylesheet"):
+		file, ok := in.resolve(href, nil)
+		if !ok {
+			return "", false
+		}
+		b, err := os.ReadFile(file)
+		if err != nil {
+			in.warn("could not inline stylesheet %s: %v", href, err)
+			return "", false
+		}
+		saved := in.opts.StyleDir
+		in.opts.StyleDir = filepath.Dir(file)
+		css := in.css(string(b))
+		in.opts.StyleDir = saved
+		return "<style>" + strings.ReplaceAll(css, "</style", `<\/style`) + "</style>", true
+	case hasToken(rel, "icon") || hasToken(rel, "apple-touch-icon"):
+		if uri, ok := in.dataURI(href, nil); ok {
+			setAttr(&tok, "href", uri)
+			return tok.String(), true
+		}
+	}
+	return "", false
+}
+
+// script embeds a local script file inline.
+func (in *inliner) script(tok html.Token) (string, bool) {
+	src := attr(tok, "src")
+	if src == "" {
+		return "", false
+	}
+	file, ok := in.resolve(src, nil)
+	if !ok {
+		return "", false
+	}
+	b, err := os.ReadFile(file)
+	if err != nil {
+		in.warn("could not inline script %s: %v", src, err)
+		return "", false
+	}
+	if !in.fits(src, int64(len(b))) {
+		return "", false
+	}
+	removeAttr(&tok, "src")
+	// The end tag from the page closes the element after the contents.
+	return tok.String() + strings.ReplaceAll(string(b), "</script", `<\/script`), true
+}
+
+// svg replaces an <img> of a local SVG file with the SVG markup.
+func (in *inliner) svg(tok html.Token) (string, bool) {
+	src := attr(tok, "src")
+	if strings.ToLower(path.Ext(stripQuery(src))) != ".svg" {
+		return "", false
+	}
+	file, ok := in.resolve(src, nil)
+	if !ok {
+		return "", false
+	}
+	b, err := os.ReadFile(file)
+	if err != nil || !in.fits(src, int64(len(b))) {
+		return "", false
+	}
+	start := bytes.Index(b, []byte("<svg"))
+	if start < 0 {
+		return "", false
+	}
+	svg := string(b[start:])
+	extra := ` role="img"`
+	if alt := attr(tok, "alt"); alt != "" {
+		extra += ` aria-label="` + html.EscapeString(alt) + `"`
+	}
+	for _, a := range []string{"class", "id", "width", "height"} {
+		if v := attr(tok, a); v != "" && !strings.Contains(svg[:strings.IndexByte(svg, '>')+1], a+"=") {
+			extra += " " + a + `="` + html.EscapeString(v) + `"`
+		}
+	}
+	return "<svg" + extra + svg[len("<svg"):], true
+}
+
+// css rewrites url() references in a stylesheet.
+func (in *inliner) css(css string) string {
+	return cssURL.ReplaceAllStringFunc(css, func(m string) string {
+		sub := cssURL.FindStringSubmatch(m)
+		ref := sub[1] + sub[2] + sub[3]
+		if strings.HasPrefix(ref, "data:") || strings.HasPrefix(ref, "#") {
+			return m
+		}
+		isFont := fontExts[strings.ToLower(path.Ext(stripQuery(ref)))]
+		if isFont && !in.opts.Fonts {
+			if _, local := LocalPath(ref); local {
+				in.warn("font %s is not inlined, enable font inlining to embed it", ref)
+				return m
+			}
+		}
+		var dirs []string
+		if in.opts.StyleDir != "" {
+			dirs = append(dirs, in.opts.StyleDir)
+		}
+		if uri, ok := in.dataURI(ref, dirs); ok {
+			return `url("` + uri + `")`
+		}
+		return m
+	})
+}
+
+// dataURI reads a local resource and encodes it as a data URI. Remote and
+// missing resources are reported as warnings.
+func (in *inliner) dataURI(ref string, dirs []string) (string, bool) {
+	if strings.HasPrefix(ref, "data:") {
+		return "", false
+	}
+	file, ok := in.resolve(ref, dirs)
+	if !ok {
+		return "", false
+	}
+	b, err := os.ReadFile(file)
+	if err != nil {
+		in.warn("could not inline %s: %v", ref, err)
+		return "", false
+	}
+	if !in.fits(ref, int64(len(b))) {
+		return "", false
+	}
+	return "data:" + mediaType(file, b) + ";base64," + base64.StdEncoding.EncodeToString(b), true
+}
+
+// resolve finds the file a reference points to, warning about references
+// that can't be inlined.
+func (in *inliner) resolve(ref string, dirs []string) (string, bool) {
+	if u, err := url.Parse(strings.TrimSpace(ref)); err == nil && (u.Host != "" || u.Scheme == "http" || u.Scheme == "https") {
+		in.warn("remote resource %s is not inlined, the page needs a network connection to show it", ref)
+		return "", false
+	}
+	p, ok := LocalPath(ref)
+	if !ok {
+		return "", false
+	}
+	if outside(p) {
+		in.warn("%s is not inlined, it is outside the input directory", ref)
+		return "", false
+	}
+	if contains(in.opts.Skip, p) {
+		return "", false
+	}
+	for _, dir := range append(dirs, in.opts.BaseDir) {
+		file := filepath.Join(dir, filepath.FromSlash(p))
+		if info, err := os.Stat(file); err == nil && !info.IsDir() {
+			return file, true
+		}
+	}
+	in.warn("could not inline %s: file not found", ref)
+	return "", false
+}
+
+func (in *inliner) fits(ref string, size int64) bool {
+	if in.opts.MaxSize > 0 && size > in.opts.MaxSize {
+		in.warn("%s is not inlined, it is %d KiB which is over the %d KiB limit", ref, size/1024, in.opts.MaxSize/1024)
+		return false
+	}
+	return true
+}
+
+func mediaType(file string, b []byte) string {
+	if t := mime.TypeByExtension(strings.ToLower(filepath.Ext(file))); t != "" {
+		return t
+	}
+	return http.DetectContentType(b)
+}
+
+func attr(tok html.Token, key string) string {
+	for _, a := range tok.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func setAttr(tok *html.Token, key, val string) {
+	for i, a := range tok.Attr {
+		if a.Key == key {
+			tok.Attr[i].Val = val
+			return
+		}
+	}
+	tok.Attr = append(tok.Attr, html.Attribute{Key: key, Val: val})
+}
+
+func removeAttr(tok *html.Token, key string) {
+	attrs := tok.Attr[:0]
+	for _, a := range tok.Attr {
+		if a.Key != key {
+			attrs = append(attrs, a)
+		}
+	}
+	tok.Attr = attrs
+}
+
+func hasToken(list, token string) bool {
+	for _, f := range strings.Fields(list) {
+		if f == token {
+			return true
+		}
+	}
+	return false
+}
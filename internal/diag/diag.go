@@ -0,0 +1,141 @@
+// Package diag provides errors that point at a location in a source file,
+// formatted the way compilers report them so editors can jump to them.
+package diag
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// Error is an error located at a line and column of a source file.
+type Error struct {
+	File string // Path of the file the error is in, may be empty.
+	Line int    // 1-based line number.
+	Col  int    // 1-based column, counted in characters.
+	Msg  string // Short description of the problem.
+
+	// Warning marks problems that don't stop the build.
+	Warning bool
+
+	// Excerpt is the offending source line with a caret under Col. It is
+	// empty if the source wasn't available.
+	Excerpt string
+
+	Err error // Underlying error, if any.
+}
+
+// New builds an Error at line and col of src. If col is 0 the caret is put
+// on the first non-blank character of the line.
+func New(file string, src []byte, line, col int, msg string, err error) *Error {
+	e := &Error{File: file, Line: line, Col: col, Msg: msg, Err: err}
+	text, ok := lineText(src, line)
+	if !ok {
+		if e.Col == 0 {
+			e.Col = 1
+		}
+		return e
+	}
+	if e.Col == 0 {
+		e.Col = utf8.RuneCountInString(text) - utf8.RuneCountInString(strings.TrimLeft(text, " \t")) + 1
+	}
+	e.Excerpt = excerpt(text, line, e.Col)
+	return e
+}
+
+// AtOffset builds an Error at byte offset off of src.
+func AtOffset(file string, src []byte, off int, msg string, err error) *Error {
+	line, col := Position(src, off)
+	return New(file, src, line, col, msg, err)
+}
+
+// Position converts a byte offset in src into a 1-based line and column.
+func Position(src []byte, off int) (line, col int) {
+	if off > len(src) {
+		off = len(src)
+	}
+	if off < 0 {
+		off = 0
+	}
+	before := src[:off]
+	line = bytes.Count(before, []byte("\n")) + 1
+	start := bytes.LastIndexByte(before, '\n') + 1
+	col = utf8.RuneCount(before[start:]) + 1
+	return line, col
+}
+
+func (e *Error) Error() string {
+	msg := e.Msg
+	if e.Warning {
+		msg = "warning: " + msg
+	}
+	if e.File == "" {
+		return fmt.Sprintf("%d:%d: %s", e.Line, e.Col, msg)
+	}
+	return fmt.Sprintf("%s:%d:%d: %s", e.File, e.Line, e.Col, msg)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Detail returns the error message followed by the source excerpt.
+func (e *Error) Detail() string {
+	if e.Excerpt == "" {
+		return e.Error()
+	}
+	return e.Error() + "\n" + e.Excerpt
+}
+
+// Print reports err on w. Errors with a source location are printed
+// compiler-style as file:line:col: message, followed by the offending line.
+// Joined errors are printed one after another.
+func Print(w io.Writer, err error) {
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		for _, e := range joined.Unwrap() {
+			Print(w, e)
+		}
+		return
+	}
+	var located *Error
+	if errors.As(err, &located) {
+		fmt.Fprintln(w, located.Detail())
+		return
+	}
+	fmt.Fprintln(w, "Error:", err)
+}
+
+// lineText returns the contents of the 1-based line of src.
+func lineText(src []byte, line int) (string, bool) {
+	if src == nil || line < 1 {
+		return "", false
+	}
+	lines := bytes.Split(src, []byte("\n"))
+	if line > len(lines) {
+		return "", false
+	}
+	return strings.TrimRight(string(lines[line-1]), "\r"), true
+}
+
+func excerpt(text string, line, col int) string {
+	gutter := fmt.Sprintf("%4d | ", line)
+	// Keep tabs so the caret lines up with the source however it is displayed.
+	var pad strings.Builder
+	for i, r := range []rune(text) {
+		if i >= col-1 {
+			break
+		}
+		if r == '\t' {
+			pad.WriteRune('\t')
+		} else {
+			pad.WriteRune(' ')
+		}
+	}
+	if n := col - 1 - utf8.RuneCountInString(text); n > 0 {
+		pad.WriteString(strings.Repeat(" ", n))
+	}
+	return gutter + text + "\n" + strings.Repeat(" ", len(gutter)-2) + "| " + pad.String() + "^"
+}
@@ -0,0 +1,102 @@
+package diag
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestError(t *testing.T) {
+	src := []byte("first line\n  second: [line\nthird")
+
+	t.Run("formats compiler style with file", func(t *testing.T) {
+		err := New("page.md", src, 2, 11, "unclosed bracket", nil)
+		if got, want := err.Error(), "page.md:2:11: unclosed bracket"; got != want {
+			t.Errorf("Error() = %q, want %q", got, want)
+		}
+	})
+
+	t.Run("omits empty file", func(t *testing.T) {
+		err := New("", src, 2, 11, "unclosed bracket", nil)
+		if got, want := err.Error(), "2:11: unclosed bracket"; got != want {
+			t.Errorf("Error() = %q, want %q", got, want)
+		}
+	})
+
+	t.Run("excerpt has caret under column", func(t *testing.T) {
+		err := New("page.md", src, 2, 11, "unclosed bracket", nil)
+		want := "   2 |   second: [line\n" +
+			"     |           ^"
+		if err.Excerpt != want {
+			t.Errorf("Excerpt =\n%s\nwant\n%s", err.Excerpt, want)
+		}
+		if got := err.Detail(); got != err.Error()+"\n"+want {
+			t.Errorf("Detail() = %q", got)
+		}
+	})
+
+	t.Run("unknown column points at first non-blank character", func(t *testing.T) {
+		err := New("page.md", src, 2, 0, "bad", nil)
+		if err.Col != 3 {
+			t.Errorf("Col = %d, want 3", err.Col)
+		}
+	})
+
+	t.Run("line outside source has no excerpt", func(t *testing.T) {
+		err := New("page.md", src, 10, 0, "bad", nil)
+		if err.Excerpt != "" {
+			t.Errorf("Excerpt = %q, want empty", err.Excerpt)
+		}
+		if err.Detail() != err.Error() {
+			t.Errorf("Detail() = %q, want %q", err.Detail(), err.Error())
+		}
+	})
+
+	t.Run("unwraps underlying error", func(t *testing.T) {
+		cause := errors.New("cause")
+		err := New("page.md", src, 1, 1, "bad", cause)
+		if !errors.Is(err, cause) {
+			t.Errorf("errors.Is(err, cause) = false, want true")
+		}
+	})
+}
+
+func TestPosition(t *testing.T) {
+	src := []byte("ab\ncdé\nf")
+	tests := []struct {
+		off       int
+		line, col int
+	}{
+		{0, 1, 1},
+		{2, 1, 3},
+		{3, 2, 1},
+		{7, 2, 4},
+		{8, 3, 1},
+		{100, 3, 2},
+	}
+	for _, tt := range tests {
+		line, col := Position(src, tt.off)
+		if line != tt.line || col != tt.col {
+			t.Errorf("Position(%d) = %d:%d, want %d:%d", tt.off, line, col, tt.line, tt.col)
+		}
+	}
+}
+
+func TestWarning(t *testing.T) {
+	err := New("page.md", []byte("titel: x"), 1, 1, `unknown key "titel"`, nil)
+	err.Warning = true
+	if got, want := err.Error(), `page.md:1:1: warning: unknown key "titel"`; got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+}
+
+func TestPrint(t *testing.T) {
+	located := New("page.md", []byte("titel: x"), 1, 1, `unknown key "titel"`, nil)
+	var b strings.Builder
+	Print(&b, errors.Join(fmt.Errorf("building page.md: %w", located), errors.New("disk full")))
+	want := located.Detail() + "\nError: disk full\n"
+	if b.String() != want {
+		t.Errorf("Print() wrote\n%s\nwant\n%s", b.String(), want)
+	}
+}
@@ -0,0 +1,200 @@
+package generate
+
+import (
+	"bytes"
+	"html"
+	"regexp"
+	"strings"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// alertKinds are the alert types GitHub supports, with their titles and
+// icons. The icons are drawn with currentColor so they follow the alert's
+// text color.
+var alertKinds = map[string]struct{ Title, Icon string }{
+	"note":      {"Note", `<circle cx="8" cy="8" r="6.5"/><path d="M8 7.5v3.5M8 5v.01"/>`},
+	"tip":       {"Tip", `<path d="M5.5 10.5A4.5 4.5 0 1 1 10.5 10.5V12h-5z"/><path d="M6 14.5h4"/>`},
+	"important": {"Important", `<path d="M1.5 2.5h13v9H7l-3 3v-3H1.5z"/><path d="M8 4.5v3.5M8 10v.01"/>`},
+	"warning":   {"Warning", `<path d="M8 1.5l6.75 12.5H1.25z"/><path d="M8 6v4M8 12v.01"/>`},
+	"caution":   {"Caution", `<path d="M5.2 1.5h5.6l3.7 3.7v5.6l-3.7 3.7H5.2l-3.7-3.7V5.2z"/><path d="M8 4.5v4.5M8 11.5v.01"/>`},
+}
+
+// alertMarker matches the first line of a GitHub alert, like "[!NOTE]".
+var alertMarker = regexp.MustCompile(`^\s*\[!(?i:(note|tip|important|warning|caution))\]\s*$`)
+
+// kindAlert is the node kind of alert.
+var kindAlert = ast.NewNodeKind("Alert")
+
+// alert is an admonition: a GitHub "> [!NOTE]" blockquote or a ":::note"
+// container.
+type alert struct {
+	ast.BaseBlock
+	Variant string // One of the keys of alertKinds.
+	Title   string // Overrides the default title of the variant, if set.
+
+	fence int // Length of the opening ":::" fence, for containers.
+}
+
+func (a *alert) Kind() ast.NodeKind { return kindAlert }
+
+func (a *alert) Dump(source []byte, level int) {
+	ast.DumpHelper(a, source, level, map[string]string{"Variant": a.Variant, "Title": a.Title}, nil)
+}
+
+func newAlert(variant string) *alert {
+	return &alert{Variant: strings.ToLower(variant)}
+}
+
+// alertExtension renders GitHub-style alerts and ":::" containers as
+// admonitions.
+type alertExtension struct{}
+
+func (alertExtension) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(
+		parser.WithBlockParsers(util.Prioritized(alertContainerParser{}, 150)),
+		parser.WithParagraphTransformers(util.Prioritized(alertMarkerTransformer{}, 150)),
+		parser.WithASTTransformers(util.Prioritized(alertTransformer{}, 100)),
+	)
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(util.Prioritized(alertRenderer{}, 500)))
+}
+
+var alertsKey = parser.NewContextKey()
+
+// alertMarkerTransformer spots the "[!NOTE]" line at the start of a
+// blockquote while the block is still raw text, before inline parsing turns
+// the marker into a link reference. It removes the line and remembers the
+// blockquote for alertTransformer.
+type alertMarkerTransformer struct{}
+
+func (alertMarkerTransformer) Transform(node *ast.Paragraph, reader text.Reader, pc parser.Context) {
+	quote, ok := node.Parent().(*ast.Blockquote)
+	if !ok || quote.FirstChild() != node {
+		return
+	}
+	lines := node.Lines()
+	if lines.Len() == 0 {
+		return
+	}
+	first := lines.At(0)
+	m := alertMarker.FindSubmatch(first.Value(reader.Source()))
+	if m == nil {
+		return
+	}
+
+	found, _ := pc.Get(alertsKey).(map[*ast.Blockquote]string)
+	if found == nil {
+		found = make(map[*ast.Blockquote]string)
+		pc.Set(alertsKey, found)
+	}
+	found[quote] = string(m[1])
+
+	if lines.Len() == 1 {
+		quote.RemoveChild(quote, node)
+		return
+	}
+	lines.SetSliced(1, lines.Len())
+}
+
+// alertTransformer replaces the blockquotes found by alertMarkerTransformer
+// with alert nodes.
+type alertTransformer struct{}
+
+func (alertTransformer) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	found, _ := pc.Get(alertsKey).(map[*ast.Blockquote]string)
+	for quote, kind := range found {
+		parent := quote.Parent()
+		if parent == nil {
+			continue
+		}
+		a := newAlert(kind)
+		a.SetLines(quote.Lines())
+		for c := quote.FirstChild(); c != nil; {
+			next := c.NextSibling()
+			a.AppendChild(a, c)
+			c = next
+		}
+		parent.ReplaceChild(parent, quote, a)
+	}
+}
+
+// alertContainerParser parses fenced containers:
+//
+//	:::warning Optional title
+//	Content, which can be any markdown.
+//	:::
+//
+// Containers nest when the outer fence is longer, like "::::note".
+type alertContainerParser struct{}
+
+var containerOpen = regexp.MustCompile(`^(:{3,})\s*(\w+)(?:\s+(.*?))?\s*$`)
+
+func (alertContainerParser) Trigger() []byte { return []byte{':'} }
+
+func (alertContainerParser) Open(parent ast.Node, reader text.Reader, pc parser.Context) (ast.Node, parser.State) {
+	line, _ := reader.PeekLine()
+	m := containerOpen.FindSubmatch(util.TrimRightSpace(line[pc.BlockOffset():]))
+	if m == nil {
+		return nil, parser.NoChildren
+	}
+	if _, ok := alertKinds[strings.ToLower(string(m[2]))]; !ok {
+		return nil, parser.NoChildren
+	}
+	a := newAlert(string(m[2]))
+	a.Title = string(m[3])
+	a.fence = len(m[1])
+	reader.AdvanceToEOL()
+	return a, parser.HasChildren
+}
+
+func (alertContainerParser) Continue(node ast.Node, reader text.Reader, pc parser.Context) parser.State {
+	a := node.(*alert)
+	line, _ := reader.PeekLine()
+	trimmed := util.TrimRightSpace(util.TrimLeftSpace(line))
+	if len(trimmed) >= a.fence && len(bytes.Trim(trimmed, ":")) == 0 {
+		reader.AdvanceToEOL()
+		return parser.Close
+	}
+	return parser.Continue | parser.HasChildren
+}
+
+func (alertContainerParser) Close(node ast.Node, reader text.Reader, pc parser.Context) {}
+
+func (alertContainerParser) CanInterruptParagraph() bool { return true }
+
+func (alertContainerParser) CanAcceptIndentedLine() bool { return false }
+
+// alertRenderer writes an alert as
+//
+//	<div class="alert alert-note" role="note">
+//	<p class="alert-title"><svg …></svg>Note</p>
+//	…
+//	</div>
+type alertRenderer struct{}
+
+func (alertRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(kindAlert, renderAlert)
+}
+
+func renderAlert(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		_, _ = w.WriteString("</div>\n")
+		return ast.WalkContinue, nil
+	}
+	a := node.(*alert)
+	kind := alertKinds[a.Variant]
+	title := a.Title
+	if title == "" {
+		title = kind.Title
+	}
+	_, _ = w.WriteString(`<div class="alert alert-` + a.Variant + `" role="note">` + "\n")
+	_, _ = w.WriteString(`<p class="alert-title"><svg class="alert-icon" viewBox="0 0 16 16" width="16" height="16" aria-hidden="true" fill="none" stroke="currentColor" stroke-width="1.5" stroke-linecap="round" stroke-linejoin="round">`)
+	_, _ = w.WriteString(kind.Icon)
+	_, _ = w.WriteString("</svg>" + html.EscapeString(title) + "</p>\n")
+	return ast.WalkContinue, nil
+}
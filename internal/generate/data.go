@@ -0,0 +1,186 @@
+package generate
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/kscarlett/june/internal/diag"
+)
+
+// dataFormats maps the extensions of data files to their format.
+var dataFormats = map[string]string{
+	".yaml": "YAML",
+	".yml":  "YAML",
+	".toml": "TOML",
+	".json": "JSON",
+	".csv":  "CSV",
+	".tsv":  "TSV",
+}
+
+// LoadData reads the data files in dir into a tree keyed by path, so
+// data/team.yaml is .Data.team and data/pricing/tiers.json is
+// .Data.pricing.tiers. CSV and TSV files become a list of rows, each a map
+// from the header row's names to the row's values. An empty dir gives an
+// empty tree. It also returns the files and directories it read.
+func LoadData(dir string) (map[string]any, []string, error) {
+	tree := make(map[string]any)
+	if dir == "" {
+		return tree, nil, nil
+	}
+
+	// origin remembers which file or directory set each key, to report
+	// clashes like team.yaml next to team.json.
+	origin := make(map[string]string)
+	var files []string
+	err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path != dir && strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			files = append(files, path)
+			return nil
+		}
+		format, ok := dataFormats[strings.ToLower(filepath.Ext(path))]
+		if !ok {
+			return nil
+		}
+		files = append(files, path)
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		keys := strings.Split(filepath.ToSlash(strings.TrimSuffix(rel, filepath.Ext(rel))), "/")
+		value, err := readDataFile(path, format)
+		if err != nil {
+			return err
+		}
+
+		node := tree
+		for i, key := range keys {
+			at := strings.Join(keys[:i+1], ".")
+			if i == len(keys)-1 {
+				if prev, ok := origin[at]; ok {
+					return fmt.Errorf("data files %s and %s both define .Data.%s", prev, path, at)
+				}
+				origin[at] = path
+				node[key] = value
+				break
+			}
+			child, ok := node[key].(map[string]any)
+			if !ok {
+				if prev, ok := origin[at]; ok {
+					return fmt.Errorf("data files %s and %s both define .Data.%s", prev, path, at)
+				}
+				child = make(map[string]any)
+				node[key] = child
+				origin[at] = filepath.Join(dir, filepath.FromSlash(strings.Join(keys[:i+1], "/")))
+			}
+			node = child
+		}
+		return nil
+	})
+	var located *diag.Error
+	if errors.As(err, &located) {
+		return nil, files, err
+	} else if err != nil {
+		return nil, files, fmt.Errorf("failed to load data: %w", err)
+	}
+	return tree, files, nil
+}
+
+// readDataFile decodes a single data file.
+func readDataFile(path, format string) (any, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if format == "CSV" || format == "TSV" {
+		return readCSV(path, b, format == "TSV")
+	}
+
+	raw := &rawFrontmatter{Format: format, Data: b, Line: 1}
+	var value any
+	if format == "TOML" {
+		// TOML documents are always tables.
+		var table map[string]any
+		err = raw.decode(&table)
+		value = table
+	} else {
+		err = raw.decode(&value)
+	}
+	if err != nil {
+		located := raw.locate(b, err)
+		located.File = path
+		located.Msg = strings.Replace(located.Msg, "frontmatter", "data", 1)
+		return nil, located
+	}
+	return value, nil
+}
+
+// readCSV parses CSV, or TSV with tabs, into rows keyed by the header row.
+func readCSV(path string, b []byte, tabs bool) ([]map[string]string, error) {
+	header, records, err := readCSVRecords(path, b, tabs)
+	if err != nil {
+		return nil, err
+	}
+	rows := make([]map[string]string, 0, len(records))
+	for _, record := range records {
+		row := make(map[string]string, len(header))
+		for i, name := range header {
+			row[name] = record[i]
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// readCSVRecords parses CSV, or TSV with tabs, into its header row and the
+// records after it. Every record has as many fields as the header.
+func readCSVRecords(path string, b []byte, tabs bool) ([]string, [][]string, error) {
+	r := csv.NewReader(bytes.NewReader(b))
+	if tabs {
+		r.Comma = '\t'
+		r.LazyQuotes = true
+	}
+	header, err := r.Read()
+	if err == io.EOF {
+		return nil, nil, nil
+	} else if err != nil {
+		return nil, nil, locateCSV(path, b, err)
+	}
+	for i, name := range header {
+		header[i] = strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))
+	}
+	var records [][]string
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			return header, records, nil
+		} else if err != nil {
+			return nil, nil, locateCSV(path, b, err)
+		}
+		records = append(records, record)
+	}
+}
+
+// locateCSV turns a csv.ParseError into a diag.Error in the data file.
+func locateCSV(path string, b []byte, err error) error {
+	var parseErr *csv.ParseError
+	if !errors.As(err, &parseErr) {
+		return fmt.Errorf("invalid CSV in %s: %w", path, err)
+	}
+	return diag.New(path, b, parseErr.Line, parseErr.Column, "invalid CSV: "+parseErr.Err.Error(), err)
+}
@@ -0,0 +1,30 @@
+package generate
+
+import "golang.org/x/text/language"
+
+// rtlScripts are the scripts written from right to left, as ISO 15924 codes.
+var rtlScripts = map[string]bool{
+	"Adlm": true, // Adlam
+	"Arab": true, // Arabic, Persian, Urdu, Pashto, Sorani Kurdish
+	"Hebr": true, // Hebrew, Yiddish
+	"Mand": true, // Mandaic
+	"Nkoo": true, // N'Ko
+	"Rohg": true, // Hanifi Rohingya
+	"Samr": true, // Samaritan
+	"Syrc": true, // Syriac
+	"Thaa": true, // Thaana, used for Dhivehi
+}
+
+// textDirection returns "rtl" for languages written right to left and "ltr"
+// otherwise. The script comes from the tag when it has one, as in "az-Arab",
+// and is inferred from the language when it doesn't.
+func textDirection(lang string) string {
+	tag, err := language.Parse(lang)
+	if err != nil {
+		return "ltr"
+	}
+	if script, _ := tag.Script(); rtlScripts[script.String()] {
+		return "rtl"
+	}
+	return "ltr"
+}
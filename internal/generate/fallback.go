@@ -0,0 +1,89 @@
+package generate
+
+import (
+	"html"
+	"strings"
+
+	"github.com/yuin/goldmark/ast"
+
+	templatex "github.com/kscarlett/june/internal/template"
+)
+
+// maxDescLength is the length, in characters, that a description taken from
+// the first paragraph is cut down to. Search engines show about this much.
+const maxDescLength = 160
+
+// Fallbacks selects which page metadata is derived from the document itself
+// when the frontmatter doesn't provide it.
+type Fallbacks struct {
+	// TitleFromHeading uses the text of the first level 1 heading as the
+	// title.
+	TitleFromHeading bool
+
+	// DescFromParagraph uses the first paragraph, as plain text, as the
+	// description.
+	DescFromParagraph bool
+
+	// StripTitleHeading removes the first level 1 heading from the body
+	// when it repeats the title, for templates that render the title
+	// themselves.
+	StripTitleHeading bool
+}
+
+// applyFallbacks fills in missing metadata from the parsed document and,
+// if asked to, drops the heading that duplicates the title.
+func applyFallbacks(doc ast.Node, source []byte, meta *PageMeta, f Fallbacks) {
+	var heading *ast.Heading
+	var paragraph *ast.Paragraph
+	for n := doc.FirstChild(); n != nil; n = n.NextSibling() {
+		switch n := n.(type) {
+		case *ast.Heading:
+			if heading == nil && n.Level == 1 {
+				heading = n
+			}
+		case *ast.Paragraph:
+			if paragraph == nil {
+				paragraph = n
+			}
+		}
+	}
+
+	if heading != nil {
+		text := plainText(heading, source)
+		if meta.Title == "" && f.TitleFromHeading {
+			meta.Title = text
+		}
+		if f.StripTitleHeading && meta.Title == text {
+			doc.RemoveChild(doc, heading)
+		}
+	}
+
+	if paragraph != nil && meta.Desc == "" && f.DescFromParagraph {
+		// Leave room for the ellipsis.
+		meta.Desc = templatex.Truncate(plainText(paragraph, source), maxDescLength-1)
+	}
+}
+
+// plainText returns the text content of n with all markup removed.
+func plainText(n ast.Node, source []byte) string {
+	var b strings.Builder
+	_ = ast.Walk(n, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch n := n.(type) {
+		case *ast.Text:
+			b.Write(n.Segment.Value(source))
+			if n.SoftLineBreak() || n.HardLineBreak() {
+				b.WriteByte(' ')
+			}
+		case *ast.String:
+			// Typographer substitutions are stored as HTML entities.
+			b.WriteString(html.UnescapeString(string(n.Value)))
+		case *ast.RawHTML:
+			return ast.WalkSkipChildren, nil
+		}
+		return ast.WalkContinue, nil
+	})
+	return strings.Join(strings.Fields(b.String()), " ")
+}
@@ -0,0 +1,352 @@
+package generate
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/kscarlett/june/internal/assets"
+	templatex "github.com/kscarlett/june/internal/template"
+)
+
+// FeedConfig controls the RSS and Atom feeds of a site build.
+type FeedConfig struct {
+	Enabled bool // Write rss.xml and atom.xml listing the dated pages.
+
+	// Full puts each page's whole rendered body in the feed instead of its
+	// description.
+	Full bool
+
+	// Tags also writes a feed for every tag, at tags/<slug>/rss.xml and
+	// tags/<slug>/atom.xml.
+	Tags bool
+
+	Limit int // Most entries in a feed, 0 for no limit.
+}
+
+// feed is the content shared by the RSS and Atom versions of a feed.
+type feed struct {
+	Title       string
+	Description string
+	Link        string // The page the feed is about.
+	Dir         string // Directory of the feed files, relative to the site root.
+	Entries     []builtPage
+}
+
+// writeFeeds writes the site's feeds. Only pages with a date are listed,
+// newest first, leaving out drafts and noindex pages.
+func writeFeeds(cfg SiteConfig, pages []builtPage) error {
+	if !cfg.Feeds.Enabled {
+		return nil
+	}
+	if cfg.BaseURL == "" {
+		return fmt.Errorf("feeds need absolute URLs, set a base URL with --base-url")
+	}
+
+	var dated []builtPage
+	for _, p := range pages {
+		if !p.Meta.Date.IsZero() && p.listed() {
+			dated = append(dated, p)
+		}
+	}
+	sort.SliceStable(dated, func(i, j int) bool {
+		return dated[i].Meta.Date.After(dated[j].Meta.Date)
+	})
+
+	feeds := []feed{{
+		Title:       cfg.Title,
+		Description: cfg.Description,
+		Link:        cfg.BaseURL,
+		Entries:     dated,
+	}}
+	if cfg.Feeds.Tags {
+		byTag := make(map[string][]builtPage)
+		names := make(map[string]string)
+		for _, p := range dated {
+			seen := make(map[string]bool)
+			for _, tag := range p.Meta.Tags {
+				slug := templatex.Slugify(tag)
+				if slug == "" || seen[slug] {
+					continue
+				}
+				seen[slug] = true
+				if _, ok := names[slug]; !ok {
+					names[slug] = tag
+				}
+				byTag[slug] = append(byTag[slug], p)
+			}
+		}
+		for _, slug := range sortedKeys(names) {
+			dir := tagPath(slug)
+			link := cfg.BaseURL
+			if cfg.TagPages {
+				link = siteURL(cfg, dir)
+			}
+			title := names[slug]
+			if cfg.Title != "" {
+				title = cfg.Title + ": " + title
+			}
+			feeds = append(feeds, feed{
+				Title:       title,
+				Description: fmt.Sprintf("Pages tagged %s", names[slug]),
+				Link:        link,
+				Dir:         dir,
+				Entries:     byTag[slug],
+			})
+		}
+	}
+
+	for _, f := range feeds {
+		if cfg.Feeds.Limit > 0 && len(f.Entries) > cfg.Feeds.Limit {
+			f.Entries = f.Entries[:cfg.Feeds.Limit]
+		}
+		dir := filepath.Join(cfg.Output, filepath.FromSlash(f.Dir))
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("failed to create feed directory %s: %w", dir, err)
+		}
+		rss, err := rssFeed(cfg, f)
+		if err != nil {
+			return err
+		}
+		atom, err := atomFeed(cfg, f)
+		if err != nil {
+			return err
+		}
+		for name, doc := range map[string]any{"rss.xml": rss, "atom.xml": atom} {
+			if err := writeXML(filepath.Join(dir, name), doc); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// writeXML writes v as an indented XML document.
+func writeXML(path string, v any) error {
+	b, err := xml.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode %s: %w", path, err)
+	}
+	b = append([]byte(xml.Header), append(b, '\n')...)
+	if err := os.WriteFile(path, b, 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
+
+// entryContent returns the page's body with its links made absolute, as feed
+// readers show it away from the site.
+func entryContent(p builtPage) (string, error) {
+	body, err := assets.Absolute(p.Content, p.link())
+	if err != nil {
+		return "", fmt.Errorf("failed to prepare %s for feeds: %w", p.Input, err)
+	}
+	return string(body), nil
+}
+
+// RSS 2.0, as described at https://www.rssboard.org/rss-specification.
+
+type rssDoc struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Atom    string     `xml:"xmlns:atom,attr"`
+	DC      string     `xml:"xmlns:dc,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string   `xml:"title"`
+	Link          string   `xml:"link"`
+	Description   string   `xml:"description"`
+	Self          atomLink `xml:"atom:link"`
+	LastBuildDate string   `xml:"lastBuildDate,omitempty"`
+	Generator     string   `xml:"generator"`
+	Items         []rssItem
+}
+
+type rssItem struct {
+	XMLName     xml.Name `xml:"item"`
+	Title       string   `xml:"title,omitempty"`
+	Link        string   `xml:"link"`
+	GUID        rssGUID  `xml:"guid"`
+	PubDate     string   `xml:"pubDate"`
+	Author      string   `xml:"dc:creator,omitempty"`
+	Description string   `xml:"description,omitempty"`
+	Categories  []string `xml:"category"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+func rssFeed(cfg SiteConfig, f feed) (*rssDoc, error) {
+	title, desc := f.Title, f.Description
+	if title == "" {
+		title = f.Link
+	}
+	if desc == "" {
+		// The channel description is required.
+		desc = title
+	}
+	doc := &rssDoc{
+		Version: "2.0",
+		Atom:    "http://www.w3.org/2005/Atom",
+		DC:      "http://purl.org/dc/elements/1.1/",
+		Channel: rssChannel{
+			Title:       title,
+			Link:        f.Link,
+			Description: desc,
+			Self:        atomLink{Href: siteURL(cfg, f.Dir+"rss.xml"), Rel: "self", Type: "application/rss+xml"},
+			Generator:   "june",
+		},
+	}
+	if len(f.Entries) > 0 {
+		doc.Channel.LastBuildDate = f.Entries[0].Meta.Date.Format(time.RFC1123Z)
+	}
+	for _, p := range f.Entries {
+		link := p.link()
+		item := rssItem{
+			Title:       p.Meta.Title,
+			Link:        link,
+			GUID:        rssGUID{IsPermaLink: true, Value: link},
+			PubDate:     p.Meta.Date.Format(time.RFC1123Z),
+			Description: p.Meta.Desc,
+			Categories:  p.Meta.Tags,
+		}
+		if cfg.Feeds.Full {
+			content, err := entryContent(p)
+			if err != nil {
+				return nil, err
+			}
+			item.Description = content
+		}
+		if item.Title == "" && item.Description == "" {
+			// An item needs one or the other.
+			item.Title = link
+		}
+		// RSS's own author element must be an email address, so names go in
+		// Dublin Core's creator.
+		item.Author = p.Meta.Author
+		doc.Channel.Items = append(doc.Channel.Items, item)
+	}
+	return doc, nil
+}
+
+// Atom, as described in RFC 4287.
+
+type atomDoc struct {
+	XMLName   xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID        string      `xml:"id"`
+	Title     string      `xml:"title"`
+	Subtitle  string      `xml:"subtitle,omitempty"`
+	Updated   string      `xml:"updated"`
+	Author    *atomPerson `xml:"author"`
+	Links     []atomLink  `xml:"link"`
+	Generator string      `xml:"generator"`
+	Entries   []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomPerson struct {
+	Name string `xml:"name"`
+}
+
+type atomText struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+type atomCategory struct {
+	Term  string `xml:"term,attr"`
+	Label string `xml:"label,attr,omitempty"`
+}
+
+type atomEntry struct {
+	ID         string         `xml:"id"`
+	Title      string         `xml:"title"`
+	Updated    string         `xml:"updated"`
+	Published  string         `xml:"published"`
+	Author     *atomPerson    `xml:"author"`
+	Link       atomLink       `xml:"link"`
+	Summary    *atomText      `xml:"summary"`
+	Content    *atomText      `xml:"content"`
+	Categories []atomCategory `xml:"category"`
+}
+
+func atomFeed(cfg SiteConfig, f feed) (*atomDoc, error) {
+	title := f.Title
+	if title == "" {
+		title = f.Link
+	}
+	self := siteURL(cfg, f.Dir+"atom.xml")
+	doc := &atomDoc{
+		// The feed's own URL is unique to it, unlike its page's.
+		ID:       self,
+		Title:    title,
+		Subtitle: f.Description,
+		Links: []atomLink{
+			{Href: self, Rel: "self", Type: "application/atom+xml"},
+			{Href: f.Link, Rel: "alternate", Type: "text/html"},
+		},
+		Generator: "june",
+	}
+	// A feed must have an updated time, so an empty one uses the Unix epoch
+	// rather than the build time, which would change on every build.
+	updated := time.Unix(0, 0).UTC()
+	if len(f.Entries) > 0 {
+		updated = f.Entries[0].Meta.Date
+	}
+	doc.Updated = updated.Format(time.RFC3339)
+
+	// Atom needs an author for every entry, which the feed's author gives
+	// the entries without their own.
+	needAuthor := false
+	for _, p := range f.Entries {
+		needAuthor = needAuthor || p.Meta.Author == ""
+	}
+	if needAuthor {
+		doc.Author = &atomPerson{Name: title}
+	}
+
+	for _, p := range f.Entries {
+		link := p.link()
+		date := p.Meta.Date.Format(time.RFC3339)
+		entry := atomEntry{
+			ID:        link,
+			Title:     p.Meta.Title,
+			Updated:   date,
+			Published: date,
+			Link:      atomLink{Href: link, Rel: "alternate", Type: "text/html"},
+		}
+		if entry.Title == "" {
+			entry.Title = link
+		}
+		if p.Meta.Author != "" {
+			entry.Author = &atomPerson{Name: p.Meta.Author}
+		}
+		if p.Meta.Desc != "" {
+			entry.Summary = &atomText{Type: "text", Value: p.Meta.Desc}
+		}
+		if cfg.Feeds.Full {
+			content, err := entryContent(p)
+			if err != nil {
+				return nil, err
+			}
+			entry.Content = &atomText{Type: "html", Value: content}
+		}
+		for _, tag := range p.Meta.Tags {
+			entry.Categories = append(entry.Categories, atomCategory{Term: templatex.Slugify(tag), Label: tag})
+		}
+		doc.Entries = append(doc.Entries, entry)
+	}
+	return doc, nil
+}
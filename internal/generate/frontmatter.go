@@ -0,0 +1,190 @@
+package generate
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/yuin/goldmark/parser"
+	"go.abhg.dev/goldmark/frontmatter"
+	"gopkg.in/yaml.v3"
+
+	"github.com/kscarlett/june/internal/diag"
+)
+
+// frontmatterFormats are the delimited frontmatter formats handed to goldmark.
+// YAML is fenced by "---" and TOML (as used by Hugo) by "+++". JSON has no
+// fence and is split off before parsing, see splitJSONFrontmatter.
+var frontmatterFormats = []frontmatter.Format{
+	{Name: "YAML", Delim: '-', Unmarshal: capturingUnmarshal("YAML")},
+	{Name: "TOML", Delim: '+', Unmarshal: capturingUnmarshal("TOML")},
+}
+
+// rawFrontmatter is the undecoded frontmatter of a document along with the
+// format it was written in.
+type rawFrontmatter struct {
+	Format string
+	Data   []byte
+	Line   int // Line of the source file that Data starts on.
+}
+
+func (r *rawFrontmatter) decode(dst any) error {
+	switch r.Format {
+	case "YAML":
+		return yaml.Unmarshal(r.Data, dst)
+	case "TOML":
+		return toml.Unmarshal(r.Data, dst)
+	case "JSON":
+		return json.Unmarshal(r.Data, dst)
+	default:
+		return fmt.Errorf("unsupported frontmatter format %q", r.Format)
+	}
+}
+
+// capturingUnmarshal lets us get at the raw frontmatter bytes, which the
+// goldmark extension otherwise keeps private. Decoding into a *rawFrontmatter
+// records the bytes; decoding into anything else uses the real format.
+func capturingUnmarshal(format string) func([]byte, any) error {
+	return func(b []byte, dst any) error {
+		if raw, ok := dst.(*rawFrontmatter); ok {
+			raw.Format = format
+			raw.Data = append([]byte(nil), b...)
+			// Delimited frontmatter must open on the first line.
+			raw.Line = 2
+			return nil
+		}
+		return (&rawFrontmatter{Format: format, Data: b}).decode(dst)
+	}
+}
+
+// frontmatterFromContext returns the YAML or TOML frontmatter collected by the
+// goldmark extension, or nil if the document has none.
+func frontmatterFromContext(ctx parser.Context) *rawFrontmatter {
+	d := frontmatter.Get(ctx)
+	if d == nil {
+		return nil
+	}
+	var raw rawFrontmatter
+	if err := d.Decode(&raw); err != nil {
+		return nil
+	}
+	return &raw
+}
+
+// jsonFrontmatterStart matches the start of a JSON object: a brace followed
+// by a key or the closing brace. Pages opening with a shortcode or include,
+// like {{< youtube >}} or {{#include}}, don't match.
+var jsonFrontmatterStart = regexp.MustCompile(`^\{\s*["}]`)
+
+// splitJSONFrontmatter extracts a JSON object at the very start of the input.
+// The object is replaced by the same number of newlines so that line numbers
+// in the remaining markdown still match the source file.
+func splitJSONFrontmatter(input []byte) (*rawFrontmatter, []byte) {
+	if !jsonFrontmatterStart.Match(input) {
+		return nil, input
+	}
+
+	end := -1
+	dec := json.NewDecoder(bytes.NewReader(input))
+	var obj json.RawMessage
+	if err := dec.Decode(&obj); err == nil {
+		end = int(dec.InputOffset())
+		// The object must be the only thing on its closing line.
+		rest := input[end:]
+		if nl := bytes.IndexByte(rest, '\n'); nl >= 0 {
+			rest = rest[:nl]
+		}
+		if len(bytes.TrimSpace(rest)) != 0 {
+			return nil, input
+		}
+	} else {
+		// Malformed JSON that starts like an object. If there is a closing
+		// brace on a line of its own, treat everything up to it as
+		// frontmatter so the decode error gets reported rather than the
+		// braces silently ending up in the page.
+		end = closingBraceLine(input)
+		if end < 0 {
+			return nil, input
+		}
+	}
+
+	data := input[:end]
+	body := make([]byte, 0, len(input))
+	body = append(body, bytes.Repeat([]byte("\n"), bytes.Count(data, []byte("\n")))...)
+	body = append(body, input[end:]...)
+	return &rawFrontmatter{Format: "JSON", Data: data, Line: 1}, body
+}
+
+// closingBraceLine returns the offset just past the first line of b that
+// consists solely of "}", or -1 if there is none.
+func closingBraceLine(b []byte) int {
+	offset := 0
+	for _, line := range bytes.SplitAfter(b, []byte("\n")) {
+		if string(bytes.TrimSpace(line)) == "}" {
+			return offset + bytes.IndexByte(line, '}') + 1
+		}
+		offset += len(line)
+	}
+	return -1
+}
+
+// lineMessage matches the "line N: message" shape used by the YAML and TOML
+// decoders for errors that don't carry a structured position.
+var lineMessage = regexp.MustCompile(`(?m)^\s*(?:yaml: |toml: )?line (\d+)(?: \(last key "[^"]*"\))?: (.*)$`)
+
+// yamlParserProblems are the yaml.v3 parser (as opposed to scanner) errors.
+// For these the reported line is the 0-based line the enclosing construct
+// started on, where scanner and type errors use 1-based lines.
+var yamlParserProblems = map[string]bool{
+	"did not find expected ',' or ']'":       true,
+	"did not find expected ',' or '}'":       true,
+	"did not find expected '-' indicator":    true,
+	"did not find expected key":              true,
+	"did not find expected node content":     true,
+	"did not find expected <document start>": true,
+	"did not find expected <stream-start>":   true,
+	"found undefined tag handle":             true,
+	"found duplicate %TAG directive":         true,
+	"found duplicate %YAML directive":        true,
+	"found incompatible YAML document":       true,
+}
+
+// locate turns a decode error into a diag.Error pointing into src, the full
+// source of the document that the frontmatter was read from.
+func (r *rawFrontmatter) locate(src []byte, err error) *diag.Error {
+	line, col, msg := 0, 0, ""
+
+	var tomlErr toml.ParseError
+	var jsonSyntax *json.SyntaxError
+	var jsonType *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &tomlErr):
+		line, col = diag.Position(r.Data, tomlErr.Position.Start)
+		msg = tomlErr.Message
+	case errors.As(err, &jsonSyntax):
+		line, col = diag.Position(r.Data, int(jsonSyntax.Offset)-1)
+		msg = jsonSyntax.Error()
+	case errors.As(err, &jsonType):
+		line, col = diag.Position(r.Data, int(jsonType.Offset)-1)
+		msg = fmt.Sprintf("cannot use %s as %s for %q", jsonType.Value, jsonType.Type, jsonType.Field)
+	default:
+		if m := lineMessage.FindStringSubmatch(err.Error()); m != nil {
+			line, _ = strconv.Atoi(m[1])
+			msg = m[2]
+			if r.Format == "YAML" && yamlParserProblems[msg] {
+				line++
+			}
+		} else {
+			line = 1
+			msg = strings.TrimPrefix(strings.TrimPrefix(err.Error(), "yaml: "), "toml: ")
+		}
+	}
+
+	msg = fmt.Sprintf("invalid %s frontmatter: %s", r.Format, msg)
+	return diag.New("", src, r.Line+line-1, col, msg, err)
+}
@@ -2,18 +2,23 @@ package generate
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"html/template"
 	"os"
 	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"time"
 
-	"github.com/microcosm-cc/bluemonday"
 	"github.com/yuin/goldmark"
-	"github.com/yuin/goldmark/extension"
 	"github.com/yuin/goldmark/parser"
-	"github.com/yuin/goldmark/renderer/html"
+	"github.com/yuin/goldmark/text"
 	"go.abhg.dev/goldmark/frontmatter"
 
+	"github.com/kscarlett/june/internal/assets"
+	"github.com/kscarlett/june/internal/diag"
 	templatex "github.com/kscarlett/june/internal/template"
 )
 
@@ -23,67 +28,332 @@ var (
 	date    = "unknown"
 )
 
+// PageMeta is the metadata of a page. parseMarkdown fills it in by hand
+// from the decoded frontmatter, after checking each value's type.
 type PageMeta struct {
-	Title string   `yaml:"title"`
-	Desc  string   `yaml:"description"`
-	Lang  string   `yaml:"lang"`
-	Tags  []string `yaml:"tags"`
+	Title string
+	Desc  string
+	Lang  string
+	Tags  []string
+
+	// Dir is the text direction, "ltr" or "rtl", derived from Lang unless
+	// the frontmatter sets it. "auto" leaves it to the browser.
+	Dir string
+
+	// These feed the Open Graph, Twitter Card and JSON-LD metadata.
+	Image  string
+	URL    string
+	Type   string
+	Author string
+	Date   time.Time
+
+	// Layout picks one of the template's layouts instead of its base.
+	Layout string
+
+	// Draft and NoIndex keep the page out of site maps and feeds, and ask
+	// search engines not to index it.
+	Draft   bool
+	NoIndex bool
+
+	// Priority, from 0 to 1, and ChangeFreq are hints for the sitemap.
+	// Priority is nil when the frontmatter doesn't set it.
+	Priority   *float64
+	ChangeFreq string
+
+	// Params holds any frontmatter keys that don't map to a field above,
+	// so custom templates can still use them as .Params.<key>.
+	Params map[string]any
 }
 
 func VersionString() string {
 	return fmt.Sprintf("june version %s - commit %s (built at %s)", version, commit, date)
 }
 
-func parseMarkdown(input []byte) (PageMeta, []byte, error) {
-	md := goldmark.New(
-		goldmark.WithExtensions(extension.GFM,
-			extension.Typographer,
-			extension.Footnote,
-			&frontmatter.Extender{}),
-		goldmark.WithParserOptions(
-			parser.WithAutoHeadingID(),
-		),
-		goldmark.WithRendererOptions(
-			html.WithUnsafe(),
-		),
-	)
+// parseOptions controls how a markdown document is parsed and checked.
+type parseOptions struct {
+	// File is the path the source was read from, used in error locations.
+	File string
 
-	var buf bytes.Buffer
+	// Schema adds user-defined frontmatter keys to the built-in ones.
+	Schema *Schema
+
+	// Strict turns warnings, like frontmatter validation problems, into
+	// errors.
+	Strict bool
+
+	// Warn receives warnings when Strict is off.
+	Warn func(*diag.Error)
+
+	Fallbacks Fallbacks
+
+	// Markdown selects extensions and options, before any overrides in
+	// the page's frontmatter.
+	Markdown Markdown
+
+	// Typography overrides the built-in punctuation conventions of the
+	// page language.
+	Typography Typographies
+
+	// ReadInclude reads the files named by include directives. Includes
+	// are left as text when it is nil, as in --ugc mode.
+	ReadInclude func(path string) ([]byte, error)
+
+	// Shortcodes are the templates shortcodes render with. Shortcodes are
+	// left as text when it is nil, as in --ugc mode.
+	Shortcodes Shortcodes
+
+	// Data is the tree of data files shortcodes get as .Data.
+	Data map[string]any
+
+	// CheckLayout reports whether the page template has the layout the
+	// frontmatter asks for. Layouts aren't checked when it is nil.
+	CheckLayout func(layout string) error
+}
+
+// frontmatterOnly finds the frontmatter, which has to be read before the
+// document can be parsed with the extensions it asks for.
+var frontmatterOnly = goldmark.New(
+	goldmark.WithExtensions(&frontmatter.Extender{Formats: frontmatterFormats}),
+)
+
+func parseMarkdown(source []byte, opts parseOptions) (PageMeta, []byte, error) {
+	fm, input := splitJSONFrontmatter(source)
+	if fm == nil {
+		ctx := parser.NewContext()
+		frontmatterOnly.Parser().Parse(text.NewReader(input), parser.WithContext(ctx))
+		fm = frontmatterFromContext(ctx)
+	}
+
+	var all map[string]any
+	if fm != nil {
+		if err := fm.decode(&all); err != nil {
+			return PageMeta{}, nil, opts.locate(fm, source, err)
+		}
+	}
+
+	if problems := validateFrontmatter(opts.Schema, fm, all, source); len(problems) > 0 {
+		errs := make([]error, 0, len(problems))
+		for _, p := range problems {
+			p.File = opts.File
+			p.Warning = !opts.Strict
+			if opts.Strict {
+				errs = append(errs, p)
+			} else if opts.Warn != nil {
+				opts.Warn(p)
+			}
+		}
+		if len(errs) > 0 {
+			return PageMeta{}, nil, errors.Join(errs...)
+		}
+	}
+
+	features, key, err := opts.Markdown.with(all["markdown"])
+	if err != nil {
+		line, col := fm.keyPosition(key)
+		return PageMeta{}, nil, diag.New(opts.File, source, line, col, err.Error(), err)
+	}
+	if layout, _ := toString(all["layout"]); opts.CheckLayout != nil {
+		if err := opts.CheckLayout(layout); err != nil {
+			line, col := fm.keyPosition("layout")
+			return PageMeta{}, nil, diag.New(opts.File, source, line, col, err.Error(), err)
+		}
+	}
+	lang, _ := all["lang"].(string)
+	if lang == "" {
+		lang = "en"
+	}
+	spans := sourceMap{{File: opts.File, Src: input}}
+	if opts.ReadInclude != nil {
+		if input, spans, err = expandDirectives(opts.File, input, opts.ReadInclude); err != nil {
+			return PageMeta{}, nil, err
+		}
+	}
+
+	md := newMarkdown(features, typographyFor(lang, opts.Typography))
+	if opts.Shortcodes != nil {
+		shortcodeExtension{Shortcodes: opts.Shortcodes, Data: opts.Data}.Extend(md)
+	}
 	ctx := parser.NewContext()
-	if err := md.Convert(input, &buf, parser.WithContext(ctx)); err != nil {
-		return PageMeta{}, nil, err
+	doc := md.Parser().Parse(text.NewReader(input), parser.WithContext(ctx))
+	if problems := sourceErrors(ctx); len(problems) > 0 {
+		// Blocks are parsed before the text inside them, so problems are
+		// sorted back into source order.
+		sort.SliceStable(problems, func(i, j int) bool { return problems[i].Offset < problems[j].Offset })
+		errs := make([]error, 0, len(problems))
+		for _, p := range problems {
+			file, src, off := spans.locate(p.Offset)
+			located := diag.AtOffset(file, src, off, p.Msg, p.Err)
+			if p.Warning && !opts.Strict {
+				located.Warning = true
+				if opts.Warn != nil {
+					opts.Warn(located)
+				}
+				continue
+			}
+			errs = append(errs, located)
+		}
+		if len(errs) > 0 {
+			return PageMeta{}, nil, errors.Join(errs...)
+		}
 	}
 
 	var metadata PageMeta
-	d := frontmatter.Get(ctx)
-
-	if d == nil {
+	if fm == nil {
 		// No frontmatter found, set defaults
 		metadata.Lang = "en"
 		// Other fields (Title, Desc, Tags) will be their zero values
 	} else {
-		// Frontmatter exists, try to decode it
-		if err := d.Decode(&metadata); err != nil {
-			return PageMeta{}, nil, fmt.Errorf("error decoding frontmatter: %w", err)
+		// Frontmatter exists. Values of the wrong type have already been
+		// reported by validation. Numbers and booleans in text fields are
+		// still used as text, so "title: 1984" keeps its title; other
+		// values are left at their zero value.
+		metadata.Title, _ = toString(all["title"])
+		metadata.Desc, _ = toString(all["description"])
+		metadata.Lang, _ = all["lang"].(string)
+		metadata.Image, _ = toString(all["image"])
+		metadata.URL, _ = toString(all["url"])
+		metadata.Type, _ = toString(all["type"])
+		metadata.Author, _ = toString(all["author"])
+		metadata.Date, _ = toDate(all["date"])
+		metadata.Layout, _ = toString(all["layout"])
+		metadata.Draft, _ = all["draft"].(bool)
+		metadata.NoIndex, _ = all["noindex"].(bool)
+		if p, ok := toNumber(all["priority"]); ok && p >= 0 && p <= 1 {
+			metadata.Priority = &p
+		}
+		if freq, _ := all["changefreq"].(string); checkValue(builtinFields["changefreq"], freq) == "" {
+			metadata.ChangeFreq = freq
+		}
+		if tags, ok := all["tags"].([]any); ok {
+			metadata.Tags = make([]string, 0, len(tags))
+			for _, tag := range tags {
+				metadata.Tags = append(metadata.Tags, fmt.Sprint(tag))
+			}
+		}
+		for k, v := range all {
+			if _, ok := builtinFields[k]; ok {
+				continue
+			}
+			if metadata.Params == nil {
+				metadata.Params = make(map[string]any)
+			}
+			metadata.Params[k] = v
 		}
 		// Ensure lang defaults to "en" if specified as empty in frontmatter
 		if metadata.Lang == "" {
 			metadata.Lang = "en"
 		}
+		if dir, _ := all["dir"].(string); checkValue(builtinFields["dir"], dir) == "" {
+			metadata.Dir = dir
+		}
+	}
+	if metadata.Dir == "" {
+		metadata.Dir = textDirection(metadata.Lang)
+	}
+
+	applyFallbacks(doc, input, &metadata, opts.Fallbacks)
+
+	var buf bytes.Buffer
+	if err := md.Renderer().Render(&buf, input, doc); err != nil {
+		var located *sourceError
+		if errors.As(err, &located) {
+			file, src, off := spans.locate(located.Offset)
+			return PageMeta{}, nil, diag.AtOffset(file, src, off, located.Msg, located.Err)
+		}
+		return PageMeta{}, nil, err
 	}
 
 	return metadata, buf.Bytes(), nil
 }
 
+func (opts parseOptions) locate(fm *rawFrontmatter, source []byte, err error) error {
+	located := fm.locate(source, err)
+	located.File = opts.File
+	return located
+}
+
 type GenerateConfig struct {
-	Input    string
-	Output   string
+	Input  string
+	Output string
+
+	// Style and Template are paths, or "embedded:<name>" for one built into
+	// june. Empty selects the embedded default. Paths that don't exist are
+	// errors.
 	Style    string
 	Template string
 	Ugc      bool
+	Schema   string // Path to a frontmatter schema file, optional.
+	Strict   bool
+
+	// Static is a directory whose contents are copied next to Output. If
+	// empty, a "static" directory beside Input is used when there is one.
+	Static string
+
+	// CopyAssets copies local files referenced by images and links into
+	// the output directory, at the same relative path. Ignored with Ugc.
+	CopyAssets bool
+
+	// SelfContained embeds local images, stylesheets and scripts in the
+	// output so it works offline as a single file. With Ugc, files that the
+	// page's content references are left out.
+	SelfContained bool
+	InlineLimit   int64 // Largest file in bytes to embed, 0 for no limit.
+	InlineFonts   bool  // Also embed fonts referenced from CSS.
+	InlineSVG     bool  // Embed SVG images as markup instead of data URIs.
+
+	// Minify minifies the output HTML along with its inline CSS, scripts
+	// and SVG.
+	Minify bool
+
+	Fallbacks Fallbacks
+
+	// Markdown turns markdown extensions and options on or off. Pages can
+	// override it in their frontmatter.
+	Markdown Markdown
+
+	// Typography is a file of per-locale punctuation overrides, optional.
+	Typography string
+
+	// Shortcodes is a directory of shortcode templates. If empty, a
+	// "shortcodes" directory beside Input is used when there is one.
+	// Shortcodes are off with Ugc.
+	Shortcodes string
+
+	// Data is a directory of YAML, TOML, JSON and CSV files that templates
+	// and shortcodes get as .Data. If empty, a "data" directory beside Input
+	// is used when there is one.
+	Data string
+}
+
+// Result describes a finished, or failed, build.
+type Result struct {
+	// Sources lists the files the page was built from: the input and the
+	// files it includes, data files, schema, template and stylesheet with
+	// everything it imports. Watch mode rebuilds when any of them changes.
+	Sources []string
+
+	// Meta and Content are the page's metadata and rendered body, which
+	// site builds list in feeds.
+	Meta    PageMeta
+	Content []byte
 }
 
 func Generate(cfg GenerateConfig) error {
+	_, err := Build(cfg)
+	return err
+}
+
+// Build generates the page like Generate and also reports which files it
+// read. The result is filled in as far as the build got, even on error.
+func Build(cfg GenerateConfig) (Result, error) {
+	res := Result{Sources: []string{cfg.Input}}
+	err := build(cfg, nil, &res)
+	return res, err
+}
+
+// build generates a page. For site builds, site describes the page's place
+// in the site; it is nil for a single page.
+func build(cfg GenerateConfig, site *sitePage, res *Result) error {
 	source, err := os.ReadFile(cfg.Input)
 	if err != nil {
 		return fmt.Errorf("failed to read input file %s: %w", cfg.Input, err)
@@ -99,46 +369,250 @@ func Generate(cfg GenerateConfig) error {
 		return fmt.Errorf("failed to stat output directory %s: %w", outputDir, err)
 	}
 
+	if err := cfg.Markdown.Validate(); err != nil {
+		return err
+	}
 
-	metadata, generated, err := parseMarkdown(source)
+	opts := parseOptions{
+		File:      cfg.Input,
+		Strict:    cfg.Strict,
+		Fallbacks: cfg.Fallbacks,
+		Markdown:  cfg.Markdown,
+		Warn: func(w *diag.Error) {
+			fmt.Fprintln(os.Stderr, w.Detail())
+		},
+	}
+	if !cfg.Ugc {
+		opts.ReadInclude = func(path string) ([]byte, error) {
+			b, err := os.ReadFile(path)
+			if err == nil {
+				res.Sources = append(res.Sources, path)
+			}
+			return b, err
+		}
+	}
+	dataDir := cfg.Data
+	if dataDir == "" {
+		dataDir = filepath.Join(filepath.Dir(cfg.Input), "data")
+		if info, err := os.Stat(dataDir); err != nil || !info.IsDir() {
+			dataDir = ""
+		}
+	}
+	var dataFiles []string
+	opts.Data, dataFiles, err = LoadData(dataDir)
+	res.Sources = append(res.Sources, dataFiles...)
 	if err != nil {
-		return fmt.Errorf("failed to parse markdown: %w", err)
+		return err
 	}
-
-	if cfg.Ugc {
-		p := bluemonday.UGCPolicy()
-		generated = p.SanitizeBytes(generated)
+	if !cfg.Ugc {
+		dir := cfg.Shortcodes
+		if dir == "" {
+			dir = filepath.Join(filepath.Dir(cfg.Input), "shortcodes")
+			if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+				dir = ""
+			}
+		}
+		var files []string
+		opts.Shortcodes, files, err = LoadShortcodes(dir)
+		res.Sources = append(res.Sources, files...)
+		if err != nil {
+			return err
+		}
+	}
+	if cfg.Schema != "" {
+		res.Sources = append(res.Sources, cfg.Schema)
+		if opts.Schema, err = LoadSchema(cfg.Schema); err != nil {
+			return err
+		}
 	}
 
+	var located *diag.Error
 	tmpl, err := templatex.LoadTemplate(cfg.Template)
-	if err != nil {
+	if tmpl != nil {
+		res.Sources = append(res.Sources, tmpl.Files...)
+	}
+	if errors.As(err, &located) {
+		return err
+	} else if err != nil {
 		return fmt.Errorf("failed to load template: %w", err)
 	}
+	opts.CheckLayout = tmpl.CheckLayout
 
-	css, err := templatex.LoadStyle(cfg.Style)
-	if err != nil {
+	if cfg.Typography != "" {
+		res.Sources = append(res.Sources, cfg.Typography)
+		if opts.Typography, err = LoadTypography(cfg.Typography); err != nil {
+			return err
+		}
+	}
+
+	metadata, generated, err := parseMarkdown(source, opts)
+	if errors.As(err, &located) {
+		return err
+	} else if err != nil {
+		return fmt.Errorf("failed to parse markdown: %w", err)
+	}
+
+	if cfg.Ugc {
+		generated = ugcPolicy().SanitizeBytes(generated)
+	}
+	if site != nil && metadata.URL == "" && isAbsoluteURL(site.URL) {
+		// Without a base URL the site's address isn't known, and a
+		// site-absolute path isn't a canonical URL.
+		metadata.URL = site.URL
+	}
+	res.Meta, res.Content = metadata, generated
+
+	style, err := templatex.LoadStylesheet(cfg.Style)
+	res.Sources = append(res.Sources, style.Files...)
+	if errors.As(err, &located) {
+		return err
+	} else if err != nil {
 		return fmt.Errorf("failed to load style: %w", err)
 	}
 
-	data := struct {
-		PageMeta
-		Content template.HTML
-		Style   template.CSS
-	}{
+	data := pageData{
 		PageMeta: metadata,
+		Tags:     pageTags(metadata.Tags, site),
 		Content:  template.HTML(generated),
-		Style:    template.CSS(css),
+		Style:    template.CSS(style.CSS),
+		HeadMeta: headMeta(metadata),
+		Data:     opts.Data,
+	}
+
+	page, err := writePage(cfg, tmpl, metadata.Layout, data)
+	if err != nil {
+		return err
 	}
+	// Site builds copy the static directory once, for all pages.
+	return copyAssets(cfg, generated, page, site == nil)
+}
+
+// pageData is what page templates are executed with.
+type pageData struct {
+	PageMeta
 
+	// Tags replaces PageMeta.Tags with links to the tag pages.
+	Tags []Tag
+
+	Content  template.HTML
+	Style    template.CSS
+	HeadMeta template.HTML
+	Data     map[string]any
+
+	// Tag is the tag listed on a tag page, and AllTags every tag on the
+	// tag index. They are empty on other pages.
+	Tag     *Tag
+	AllTags []Tag
+}
+
+// writePage executes the template for a page and writes the result to
+// cfg.Output, embedding assets and minifying it as configured. It returns
+// the page as written.
+func writePage(cfg GenerateConfig, tmpl *templatex.Template, layout string, data pageData) ([]byte, error) {
 	var out bytes.Buffer
-	if err := tmpl.Execute(&out, data); err != nil {
-		return fmt.Errorf("failed to execute template: %w", err)
+	if err := tmpl.ExecuteLayout(&out, layout, data); err != nil {
+		return nil, fmt.Errorf("failed to execute template: %w", err)
+	}
+
+	page := out.Bytes()
+	var err error
+	if cfg.SelfContained {
+		opts := assets.InlineOptions{
+			BaseDir: filepath.Dir(cfg.Input),
+			MaxSize: cfg.InlineLimit,
+			Fonts:   cfg.InlineFonts,
+			SVG:     cfg.InlineSVG,
+		}
+		if info, err := os.Stat(cfg.Style); err == nil && !info.IsDir() {
+			opts.StyleDir = filepath.Dir(cfg.Style)
+		}
+		if cfg.Ugc {
+			opts.Skip = assets.References([]byte(data.Content))
+		}
+		var warnings []string
+		page, warnings, err = assets.Inline(page, opts)
+		for _, w := range warnings {
+			fmt.Fprintln(os.Stderr, "Warning:", w)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to inline assets: %w", err)
+		}
+	}
+
+	if cfg.Minify {
+		if page, err = minifyPage(page); err != nil {
+			return nil, fmt.Errorf("failed to minify output: %w", err)
+		}
 	}
 
-	err = os.WriteFile(cfg.Output, out.Bytes(), 0644)
+	err = os.WriteFile(cfg.Output, page, 0644)
 	if err != nil {
-		return fmt.Errorf("failed to write output file %s: %w", cfg.Output, err)
+		return nil, fmt.Errorf("failed to write output file %s: %w", cfg.Output, err)
 	}
 	fmt.Printf("Successfully wrote to %s\n", cfg.Output)
+	return page, nil
+}
+
+// copyAssets copies the files referenced from the page body and, with
+// static, the static directory into the output directory. page is the
+// written page: files embedded in a self-contained one aren't copied.
+func copyAssets(cfg GenerateConfig, body, page []byte, static bool) error {
+	outputDir := filepath.Dir(cfg.Output)
+	inputDir := filepath.Dir(cfg.Input)
+
+	if static {
+		if err := copyStatic(cfg.Static, inputDir, outputDir); err != nil {
+			return err
+		}
+	}
+
+	if !cfg.CopyAssets || cfg.Ugc {
+		return nil
+	}
+	refs := assets.References(body)
+	if cfg.SelfContained {
+		// Links to embedded files, and files too large to embed, are still
+		// referenced from the page.
+		left := assets.References(page)
+		refs = slices.DeleteFunc(refs, func(ref string) bool { return !slices.Contains(left, ref) })
+	}
+	warnings, err := assets.CopyReferences(inputDir, outputDir, refs)
+	for _, w := range warnings {
+		fmt.Fprintln(os.Stderr, "Warning:", w)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to copy assets: %w", err)
+	}
 	return nil
 }
+
+// copyStatic copies the static directory into outputDir. If static is
+// empty, a "static" directory in inputDir is used when there is one.
+func copyStatic(static, inputDir, outputDir string) error {
+	static = staticDir(static, inputDir)
+	if static == "" {
+		return nil
+	}
+	if info, err := os.Stat(static); err != nil {
+		return fmt.Errorf("failed to read static directory: %w", err)
+	} else if !info.IsDir() {
+		return fmt.Errorf("static path %s is not a directory", static)
+	}
+	if err := assets.CopyDir(static, outputDir); err != nil {
+		return fmt.Errorf("failed to copy static directory %s: %w", static, err)
+	}
+	return nil
+}
+
+// staticDir returns the static directory to copy: static if set, otherwise
+// the "static" directory in inputDir, or "" if there isn't one.
+func staticDir(static, inputDir string) string {
+	if static != "" {
+		return static
+	}
+	static = filepath.Join(inputDir, "static")
+	if info, err := os.Stat(static); err != nil || !info.IsDir() {
+		return ""
+	}
+	return static
+}
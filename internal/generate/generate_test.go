@@ -1,9 +1,18 @@
 package generate
 
 import (
+	"encoding/xml"
+	"errors"
+	"html/template"
+	"os"
+	"path/filepath"
 	"reflect"
+	"slices"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/kscarlett/june/internal/diag"
 )
 
 func TestParseMarkdown(t *testing.T) {
@@ -17,7 +26,7 @@ tags: [tag1, tag2]
 # Hello World
 This is content.`)
 
-		meta, html, err := parseMarkdown(input)
+		meta, html, err := parseMarkdown(input, parseOptions{})
 
 		if err != nil {
 			t.Errorf("parseMarkdown() error = %v, wantErr nil", err)
@@ -27,6 +36,7 @@ This is content.`)
 			Title: "Test Title",
 			Desc:  "Test Description",
 			Lang:  "fr",
+			Dir:   "ltr",
 			Tags:  []string{"tag1", "tag2"},
 		}
 		if !reflect.DeepEqual(meta, expectedMeta) {
@@ -49,7 +59,7 @@ title: Minimal Title
 ## Subheading
 Minimal content.`)
 
-		meta, html, err := parseMarkdown(input)
+		meta, html, err := parseMarkdown(input, parseOptions{})
 
 		if err != nil {
 			t.Errorf("parseMarkdown() error = %v, wantErr nil", err)
@@ -75,7 +85,6 @@ Minimal content.`)
 			t.Errorf("parseMarkdown() meta.Tags = %+v, want nil or empty", meta.Tags)
 		}
 
-
 		if len(html) == 0 {
 			t.Errorf("parseMarkdown() html is empty, want non-empty")
 		}
@@ -89,7 +98,7 @@ Minimal content.`)
 		input := []byte(`# Just Content
 No frontmatter here.`)
 
-		meta, html, err := parseMarkdown(input)
+		meta, html, err := parseMarkdown(input, parseOptions{})
 
 		if err != nil {
 			t.Errorf("parseMarkdown() error = %v, wantErr nil", err)
@@ -101,6 +110,7 @@ No frontmatter here.`)
 			Desc:  "",
 			Lang:  "en", // Default
 			Tags:  nil,
+			Dir:   "ltr",
 		}
 		if !reflect.DeepEqual(meta, expectedMeta) {
 			t.Errorf("parseMarkdown() meta = %+v, want %+v", meta, expectedMeta)
@@ -124,15 +134,22 @@ tags: [tag1, tag2
 # Hello World
 This is content.`) // Invalid YAML: unclosed bracket in tags
 
-		_, _, err := parseMarkdown(input)
+		_, _, err := parseMarkdown(input, parseOptions{})
 
 		if err == nil {
 			t.Errorf("parseMarkdown() error = nil, wantErr for malformed frontmatter")
 		}
 		// Check if the error message indicates a frontmatter decoding issue
-		// The actual error comes from the YAML parser used by goldmark-frontmatter
-		if !strings.Contains(err.Error(), "error decoding frontmatter") && !strings.Contains(err.Error(), "yaml:") {
-			t.Errorf("parseMarkdown() error = %v, want error related to frontmatter decoding or yaml", err)
+		// and points at the line with the unclosed bracket
+		if !strings.Contains(err.Error(), "YAML frontmatter") {
+			t.Errorf("parseMarkdown() error = %v, want error related to YAML frontmatter decoding", err)
+		}
+		var located *diag.Error
+		if !errors.As(err, &located) {
+			t.Fatalf("parseMarkdown() error = %T, want *diag.Error", err)
+		}
+		if located.Line != 4 {
+			t.Errorf("parseMarkdown() error line = %d, want 4", located.Line)
 		}
 	})
 
@@ -172,7 +189,7 @@ Content`,
 
 		for _, tt := range tests {
 			t.Run(tt.name, func(t *testing.T) {
-				meta, _, err := parseMarkdown([]byte(tt.input))
+				meta, _, err := parseMarkdown([]byte(tt.input), parseOptions{})
 				if err != nil {
 					t.Fatalf("parseMarkdown() error = %v, wantErr nil for this case", err)
 				}
@@ -183,3 +200,2425 @@ Content`,
 		}
 	})
 }
+
+func TestParseMarkdownFrontmatterFormats(t *testing.T) {
+	expectedMeta := PageMeta{
+		Title: "Test Title",
+		Desc:  "Test Description",
+		Lang:  "fr",
+		Tags:  []string{"tag1", "tag2"},
+		Dir:   "ltr",
+	}
+
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{
+			name: "yaml",
+			input: `---
+title: Test Title
+description: Test Description
+lang: fr
+tags: [tag1, tag2]
+---
+# Hello World`,
+		},
+		{
+			name: "toml",
+			input: `+++
+title = "Test Title"
+description = "Test Description"
+lang = "fr"
+tags = ["tag1", "tag2"]
++++
+# Hello World`,
+		},
+		{
+			name: "json",
+			input: `{
+  "title": "Test Title",
+  "description": "Test Description",
+  "lang": "fr",
+  "tags": ["tag1", "tag2"]
+}
+# Hello World`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meta, html, err := parseMarkdown([]byte(tt.input), parseOptions{})
+			if err != nil {
+				t.Fatalf("parseMarkdown() error = %v, wantErr nil", err)
+			}
+			if !reflect.DeepEqual(meta, expectedMeta) {
+				t.Errorf("parseMarkdown() meta = %+v, want %+v", meta, expectedMeta)
+			}
+			if !strings.Contains(string(html), ">Hello World</h1>") {
+				t.Errorf("parseMarkdown() html = %s, want content containing the heading", string(html))
+			}
+			if strings.Contains(string(html), "Test Title") {
+				t.Errorf("parseMarkdown() html = %s, frontmatter leaked into the body", string(html))
+			}
+		})
+	}
+}
+
+func TestParseMarkdownFrontmatterExtraFields(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{
+			name: "yaml",
+			input: `---
+title: Extra
+editor: Jane
+featured: true
+---
+Content`,
+		},
+		{
+			name: "toml",
+			input: `+++
+title = "Extra"
+editor = "Jane"
+featured = true
++++
+Content`,
+		},
+		{
+			name: "json",
+			input: `{"title": "Extra", "editor": "Jane", "featured": true}
+Content`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meta, _, err := parseMarkdown([]byte(tt.input), parseOptions{})
+			if err != nil {
+				t.Fatalf("parseMarkdown() error = %v, wantErr nil", err)
+			}
+			if meta.Title != "Extra" {
+				t.Errorf("parseMarkdown() meta.Title = %q, want %q", meta.Title, "Extra")
+			}
+			if meta.Params["editor"] != "Jane" {
+				t.Errorf("parseMarkdown() meta.Params[editor] = %v, want %q", meta.Params["editor"], "Jane")
+			}
+			if meta.Params["featured"] != true {
+				t.Errorf("parseMarkdown() meta.Params[featured] = %v, want true", meta.Params["featured"])
+			}
+			if _, ok := meta.Params["title"]; ok {
+				t.Errorf("parseMarkdown() meta.Params contains known key title")
+			}
+		})
+	}
+}
+
+func TestParseMarkdownFrontmatterScalarText(t *testing.T) {
+	for name, input := range map[string]string{
+		"yaml": "---\ntitle: 1984\nauthor: true\ndescription: 2.5\n---\nContent",
+		"toml": "+++\ntitle = 1984\nauthor = true\ndescription = 2.5\n+++\nContent",
+		"json": "{\"title\": 1984, \"author\": true, \"description\": 2.5}\nContent",
+	} {
+		t.Run(name, func(t *testing.T) {
+			meta, _, err := parseMarkdown([]byte(input), parseOptions{})
+			if err != nil {
+				t.Fatalf("parseMarkdown() error = %v", err)
+			}
+			if meta.Title != "1984" || meta.Author != "true" || meta.Desc != "2.5" {
+				t.Errorf("parseMarkdown() title, author, description = %q, %q, %q, want 1984, true, 2.5", meta.Title, meta.Author, meta.Desc)
+			}
+		})
+	}
+}
+
+func TestParseMarkdownMalformedFrontmatterFormats(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		wantErr string
+	}{
+		{
+			name: "toml",
+			input: `+++
+title = "Unclosed
++++
+Content`,
+			wantErr: "TOML frontmatter",
+		},
+		{
+			name: "json",
+			input: `{
+  "title": "Missing comma"
+  "lang": "en"
+}
+Content`,
+			wantErr: "JSON frontmatter",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := parseMarkdown([]byte(tt.input), parseOptions{})
+			if err == nil {
+				t.Fatalf("parseMarkdown() error = nil, wantErr for malformed frontmatter")
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("parseMarkdown() error = %v, want error mentioning %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	t.Run("json-looking paragraph is not frontmatter", func(t *testing.T) {
+		meta, html, err := parseMarkdown([]byte(`{braces} in the first paragraph`), parseOptions{})
+		if err != nil {
+			t.Fatalf("parseMarkdown() error = %v, wantErr nil", err)
+		}
+		if meta.Title != "" {
+			t.Errorf("parseMarkdown() meta.Title = %q, want empty", meta.Title)
+		}
+		if !strings.Contains(string(html), "{braces}") {
+			t.Errorf("parseMarkdown() html = %s, want the paragraph preserved", string(html))
+		}
+	})
+
+	// A lone "}" later in the page, as in a code block, used to be taken as
+	// the end of malformed JSON frontmatter.
+	code := "\n\n```go\nfunc main() {\n}\n```\n"
+
+	t.Run("shortcode at the start is not frontmatter", func(t *testing.T) {
+		shortcodes, _, err := LoadShortcodes("")
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, html, err := parseMarkdown([]byte(`{{< youtube id="abc" >}}`+code), parseOptions{Shortcodes: shortcodes})
+		if err != nil {
+			t.Fatalf("parseMarkdown() error = %v, wantErr nil", err)
+		}
+		if !strings.Contains(string(html), "youtube-nocookie.com/embed/abc") || !strings.Contains(string(html), "func main() {\n}") {
+			t.Errorf("parseMarkdown() html = %s, want the video and the code block", html)
+		}
+	})
+
+	t.Run("include at the start is not frontmatter", func(t *testing.T) {
+		read := func(path string) ([]byte, error) { return []byte("Included."), nil }
+		_, html, err := parseMarkdown([]byte("{{#include snip.md}}"+code), parseOptions{File: "page.md", ReadInclude: read})
+		if err != nil {
+			t.Fatalf("parseMarkdown() error = %v, wantErr nil", err)
+		}
+		if !strings.Contains(string(html), "<p>Included.</p>") || !strings.Contains(string(html), "func main() {\n}") {
+			t.Errorf("parseMarkdown() html = %s, want the include and the code block", html)
+		}
+	})
+}
+
+func TestParseMarkdownFrontmatterErrorLocation(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		wantLine int
+		wantCol  int // 0 means don't check
+	}{
+		{
+			name: "yaml type error",
+			input: `---
+title: Test
+tags: notalist
+---
+Content`,
+			wantLine: 3,
+		},
+		{
+			name: "toml parse error",
+			input: `+++
+title = "Test"
+lang = en
++++
+Content`,
+			wantLine: 3,
+			wantCol:  8,
+		},
+		{
+			name: "json syntax error",
+			input: `{
+  "title": "Test",
+  "lang": en
+}
+Content`,
+			wantLine: 3,
+			wantCol:  11,
+		},
+		{
+			name: "json type error",
+			input: `{
+  "title": 42
+}
+Content`,
+			wantLine: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := parseMarkdown([]byte(tt.input), parseOptions{Strict: true})
+			var located *diag.Error
+			if !errors.As(err, &located) {
+				t.Fatalf("parseMarkdown() error = %v (%T), want *diag.Error", err, err)
+			}
+			if located.Line != tt.wantLine {
+				t.Errorf("error line = %d, want %d (%v)", located.Line, tt.wantLine, err)
+			}
+			if tt.wantCol != 0 && located.Col != tt.wantCol {
+				t.Errorf("error col = %d, want %d (%v)", located.Col, tt.wantCol, err)
+			}
+			if located.Excerpt == "" {
+				t.Errorf("error excerpt is empty, want source line")
+			}
+		})
+	}
+}
+
+func TestValidateFrontmatter(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  string
+		schema *Schema
+		want   []string // substrings of the expected problems, in order
+	}{
+		{
+			name: "valid frontmatter",
+			input: `---
+title: Fine
+lang: fr-CA
+tags: [a]
+---
+Content`,
+		},
+		{
+			name: "unknown key with suggestion",
+			input: `---
+titel: Typo
+---
+Content`,
+			want: []string{`2:1: unknown frontmatter key "titel" (did you mean "title"?)`},
+		},
+		{
+			name: "invalid language tag",
+			input: `---
+title: Lang
+lang: english
+---
+Content`,
+			want: []string{`3:1: lang: "english" is not a valid BCP 47 language tag`},
+		},
+		{
+			name: "wrong type",
+			input: `+++
+title = 42
++++
+Content`,
+			want: []string{`2:1: title: expected string, got number`},
+		},
+		{
+			name: "missing required field from schema",
+			input: `{"title": "No author"}
+Content`,
+			schema: &Schema{Fields: map[string]Field{"author": {Type: "string", Required: true}}},
+			want:   []string{`1:1: missing required frontmatter key "author"`},
+		},
+		{
+			name:   "missing required field without frontmatter",
+			input:  `# Just content`,
+			schema: &Schema{Fields: map[string]Field{"title": {Required: true}}},
+			want:   []string{`1:1: missing required frontmatter key "title"`},
+		},
+		{
+			name: "schema values and types",
+			input: `---
+title: Typed
+status: pending
+date: 2024-02-30
+---
+Content`,
+			schema: &Schema{Fields: map[string]Field{
+				"status": {Values: []string{"draft", "published"}},
+				"date":   {Type: "date"},
+			}},
+			want: []string{
+				`3:1: status: "pending" is not one of draft, published`,
+				`4:1: date: expected date, got string`,
+			},
+		},
+		{
+			name: "sitemap hints",
+			input: `---
+title: Hints
+priority: 1.5
+changefreq: sometimes
+noindex: true
+---
+Content`,
+			want: []string{
+				`3:1: priority: 1.5 is not between 0 and 1`,
+				`4:1: changefreq: "sometimes" is not one of always, hourly, daily, weekly, monthly, yearly, never`,
+			},
+		},
+		{
+			name: "allow unknown",
+			input: `---
+editor: Jane
+---
+Content`,
+			schema: &Schema{AllowUnknown: true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var warnings []string
+			_, _, err := parseMarkdown([]byte(tt.input), parseOptions{
+				Schema: tt.schema,
+				Warn:   func(w *diag.Error) { warnings = append(warnings, w.Error()) },
+			})
+			if err != nil {
+				t.Fatalf("parseMarkdown() error = %v, want warnings only", err)
+			}
+			if len(warnings) != len(tt.want) {
+				t.Fatalf("parseMarkdown() warnings = %q, want %d", warnings, len(tt.want))
+			}
+			for i, w := range tt.want {
+				if !strings.Contains(warnings[i], "warning: ") || !strings.Contains(warnings[i], strings.SplitN(w, ": ", 2)[1]) || !strings.HasPrefix(warnings[i], strings.SplitN(w, ": ", 2)[0]) {
+					t.Errorf("warning[%d] = %q, want %q", i, warnings[i], w)
+				}
+			}
+
+			_, _, err = parseMarkdown([]byte(tt.input), parseOptions{Schema: tt.schema, Strict: true})
+			if len(tt.want) == 0 && err != nil {
+				t.Errorf("parseMarkdown() strict error = %v, want nil", err)
+			}
+			if len(tt.want) > 0 {
+				var located *diag.Error
+				if !errors.As(err, &located) {
+					t.Errorf("parseMarkdown() strict error = %v, want *diag.Error", err)
+				} else if located.Warning {
+					t.Errorf("parseMarkdown() strict error is marked as a warning")
+				}
+			}
+		})
+	}
+}
+
+func TestLoadSchema(t *testing.T) {
+	dir := t.TempDir()
+
+	t.Run("declarative yaml", func(t *testing.T) {
+		path := filepath.Join(dir, "schema.yaml")
+		content := `allow_unknown: false
+fields:
+  author: {type: string, required: true}
+  status: {values: [draft, published]}
+`
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		schema, err := LoadSchema(path)
+		if err != nil {
+			t.Fatalf("LoadSchema() error = %v", err)
+		}
+		want := map[string]Field{
+			"author": {Type: "string", Required: true},
+			"status": {Values: []string{"draft", "published"}},
+		}
+		if !reflect.DeepEqual(schema.Fields, want) {
+			t.Errorf("LoadSchema() fields = %+v, want %+v", schema.Fields, want)
+		}
+	})
+
+	t.Run("json schema", func(t *testing.T) {
+		path := filepath.Join(dir, "schema.json")
+		content := `{
+  "$schema": "https://json-schema.org/draft/2020-12/schema",
+  "type": "object",
+  "properties": {
+    "author": {"type": "string"},
+    "date": {"type": "string", "format": "date"},
+    "weight": {"type": "integer"},
+    "draft": {"type": "boolean"}
+  },
+  "required": ["author"],
+  "additionalProperties": false
+}`
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		schema, err := LoadSchema(path)
+		if err != nil {
+			t.Fatalf("LoadSchema() error = %v", err)
+		}
+		want := &Schema{Fields: map[string]Field{
+			"author": {Type: "string", Required: true},
+			"date":   {Type: "date"},
+			"weight": {Type: "integer"},
+			"draft":  {Type: "bool"},
+		}}
+		if !reflect.DeepEqual(schema, want) {
+			t.Errorf("LoadSchema() = %+v, want %+v", schema, want)
+		}
+	})
+
+	t.Run("unknown type", func(t *testing.T) {
+		path := filepath.Join(dir, "bad.toml")
+		content := `[fields.author]
+type = "text"
+`
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadSchema(path); err == nil || !strings.Contains(err.Error(), `unknown type "text"`) {
+			t.Errorf("LoadSchema() error = %v, want unknown type error", err)
+		}
+	})
+}
+
+func TestParseMarkdownFallbacks(t *testing.T) {
+	input := `# The *Real* Title
+
+June turns "Markdown" into HTML.
+It keeps things [simple](https://june.run).
+
+## Later
+
+Second paragraph.`
+
+	t.Run("disabled", func(t *testing.T) {
+		meta, _, err := parseMarkdown([]byte(input), parseOptions{})
+		if err != nil {
+			t.Fatalf("parseMarkdown() error = %v", err)
+		}
+		if meta.Title != "" || meta.Desc != "" {
+			t.Errorf("parseMarkdown() meta = %+v, want no derived title or description", meta)
+		}
+	})
+
+	t.Run("title and description", func(t *testing.T) {
+		meta, html, err := parseMarkdown([]byte(input), parseOptions{
+			Fallbacks: Fallbacks{TitleFromHeading: true, DescFromParagraph: true},
+		})
+		if err != nil {
+			t.Fatalf("parseMarkdown() error = %v", err)
+		}
+		if meta.Title != "The Real Title" {
+			t.Errorf("parseMarkdown() meta.Title = %q, want %q", meta.Title, "The Real Title")
+		}
+		if want := "June turns “Markdown” into HTML. It keeps things simple."; meta.Desc != want {
+			t.Errorf("parseMarkdown() meta.Desc = %q, want %q", meta.Desc, want)
+		}
+		if !strings.Contains(string(html), "</h1>") {
+			t.Errorf("parseMarkdown() html = %s, want heading kept", string(html))
+		}
+	})
+
+	t.Run("frontmatter wins", func(t *testing.T) {
+		meta, _, err := parseMarkdown([]byte("---\ntitle: Set\ndescription: Also set\n---\n"+input), parseOptions{
+			Fallbacks: Fallbacks{TitleFromHeading: true, DescFromParagraph: true},
+		})
+		if err != nil {
+			t.Fatalf("parseMarkdown() error = %v", err)
+		}
+		if meta.Title != "Set" || meta.Desc != "Also set" {
+			t.Errorf("parseMarkdown() meta = %+v, want frontmatter values", meta)
+		}
+	})
+
+	t.Run("strip title heading", func(t *testing.T) {
+		meta, html, err := parseMarkdown([]byte(input), parseOptions{
+			Fallbacks: Fallbacks{TitleFromHeading: true, StripTitleHeading: true},
+		})
+		if err != nil {
+			t.Fatalf("parseMarkdown() error = %v", err)
+		}
+		if meta.Title != "The Real Title" {
+			t.Errorf("parseMarkdown() meta.Title = %q, want %q", meta.Title, "The Real Title")
+		}
+		if strings.Contains(string(html), "</h1>") {
+			t.Errorf("parseMarkdown() html = %s, want title heading removed", string(html))
+		}
+		if !strings.Contains(string(html), ">Later</h2>") {
+			t.Errorf("parseMarkdown() html = %s, want other headings kept", string(html))
+		}
+	})
+
+	t.Run("strip keeps heading that differs from title", func(t *testing.T) {
+		_, html, err := parseMarkdown([]byte("---\ntitle: Other\n---\n"+input), parseOptions{
+			Fallbacks: Fallbacks{StripTitleHeading: true},
+		})
+		if err != nil {
+			t.Fatalf("parseMarkdown() error = %v", err)
+		}
+		if !strings.Contains(string(html), "</h1>") {
+			t.Errorf("parseMarkdown() html = %s, want heading kept", string(html))
+		}
+	})
+
+	t.Run("long description is truncated", func(t *testing.T) {
+		long := strings.Repeat("word ", 60)
+		meta, _, err := parseMarkdown([]byte(long), parseOptions{
+			Fallbacks: Fallbacks{DescFromParagraph: true},
+		})
+		if err != nil {
+			t.Fatalf("parseMarkdown() error = %v", err)
+		}
+		if n := len([]rune(meta.Desc)); n > maxDescLength {
+			t.Errorf("parseMarkdown() meta.Desc has %d characters, want at most %d", n, maxDescLength)
+		}
+		if !strings.HasSuffix(meta.Desc, "word…") {
+			t.Errorf("parseMarkdown() meta.Desc = %q, want cut at a word with an ellipsis", meta.Desc)
+		}
+	})
+}
+
+func TestHeadMeta(t *testing.T) {
+	meta, _, err := parseMarkdown([]byte(`---
+title: Launch <Day>
+description: Everything "new"
+lang: en-GB
+tags: [release, june]
+image: img/cover.png
+url: https://june.run/blog/launch/
+author: Jane Doe
+date: 2024-05-01
+---
+Content`), parseOptions{})
+	if err != nil {
+		t.Fatalf("parseMarkdown() error = %v", err)
+	}
+	if meta.Date.Format("2006-01-02") != "2024-05-01" {
+		t.Errorf("parseMarkdown() meta.Date = %v, want 2024-05-01", meta.Date)
+	}
+
+	got := string(headMeta(meta))
+	for _, want := range []string{
+		`<meta name="author" content="Jane Doe">`,
+		`<link rel="canonical" href="https://june.run/blog/launch/">`,
+		`<meta property="og:title" content="Launch &lt;Day&gt;">`,
+		`<meta property="og:description" content="Everything &#34;new&#34;">`,
+		`<meta property="og:type" content="article">`,
+		`<meta property="og:image" content="https://june.run/blog/launch/img/cover.png">`,
+		`<meta property="og:locale" content="en_GB">`,
+		`"inLanguage":"en-GB"`,
+		`<meta property="article:published_time" content="2024-05-01T00:00:00Z">`,
+		`<meta property="article:tag" content="release">`,
+		`<meta name="twitter:card" content="summary_large_image">`,
+		`"@type":"Article"`,
+		`"headline":"Launch \u003cDay\u003e"`,
+		`"author":{"@type":"Person","name":"Jane Doe"}`,
+		`"keywords":"release, june"`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("headMeta() does not contain %q:\n%s", want, got)
+		}
+	}
+
+	t.Run("minimal page", func(t *testing.T) {
+		got := string(headMeta(PageMeta{Title: "Home", Lang: "en"}))
+		if !strings.Contains(got, `<meta property="og:type" content="website">`) {
+			t.Errorf("headMeta() = %s, want website type", got)
+		}
+		if !strings.Contains(got, `<meta name="twitter:card" content="summary">`) {
+			t.Errorf("headMeta() = %s, want summary card", got)
+		}
+		if strings.Contains(got, "og:image") || strings.Contains(got, "canonical") {
+			t.Errorf("headMeta() = %s, want no tags for missing fields", got)
+		}
+		got = string(headMeta(PageMeta{Title: "Home", URL: "/blog/post.html"}))
+		if strings.Contains(got, "canonical") || strings.Contains(got, "og:url") {
+			t.Errorf("headMeta() = %s, want no canonical URL for a relative one", got)
+		}
+		if !strings.Contains(got, `"@type":"WebPage"`) || !strings.Contains(got, `"name":"Home"`) {
+			t.Errorf("headMeta() = %s, want WebPage JSON-LD", got)
+		}
+		if strings.Contains(got, "robots") {
+			t.Errorf("headMeta() = %s, want no robots tag", got)
+		}
+	})
+
+	t.Run("locale", func(t *testing.T) {
+		for lang, want := range map[string]string{"en-GB": "en_GB", "en-gb": "en_GB", "pt": "pt", "zh-Hant-TW": "zh_TW"} {
+			got := string(headMeta(PageMeta{Title: "Home", Lang: lang}))
+			if tag := `<meta property="og:locale" content="` + want + `">`; !strings.Contains(got, tag) {
+				t.Errorf("headMeta() for lang %q = %s, want %s", lang, got, tag)
+			}
+		}
+	})
+
+	t.Run("noindex", func(t *testing.T) {
+		for _, input := range []string{"---\ndraft: true\n---\nContent", "---\nnoindex: true\n---\nContent"} {
+			meta, _, err := parseMarkdown([]byte(input), parseOptions{})
+			if err != nil {
+				t.Fatalf("parseMarkdown() error = %v", err)
+			}
+			if got := string(headMeta(meta)); !strings.Contains(got, `<meta name="robots" content="noindex">`) {
+				t.Errorf("headMeta() = %s, want a noindex robots tag for %q", got, input)
+			}
+		}
+	})
+}
+
+func TestMinifyPage(t *testing.T) {
+	page := []byte(`<!DOCTYPE html>
+<html lang="en">
+  <head>
+    <!-- comment -->
+    <style>
+      body  {
+        color : #ff0000 ;
+      }
+    </style>
+    <script type="application/ld+json">{ "@type" : "WebPage" }</script>
+  </head>
+  <body>
+    <p>Some   text</p>
+    <pre><code>func main() {
+    fmt.Println("  spaced  ")
+}</code></pre>
+    <script>
+      const answer = 40 + 2;
+      console.log( answer );
+    </script>
+    <svg viewBox="0 0 10 10">   <rect   width="10" height="10" />   </svg>
+  </body>
+</html>`)
+
+	out, err := minifyPage(page)
+	if err != nil {
+		t.Fatalf("minifyPage() error = %v", err)
+	}
+	got := string(out)
+	if len(got) >= len(page) {
+		t.Errorf("minifyPage() output is not smaller: %d >= %d", len(got), len(page))
+	}
+	for _, want := range []string{
+		"<html lang=\"en\">",
+		"<style>body{color:red}</style>",
+		`{"@type":"WebPage"}`,
+		"<p>Some text</p>",
+		"<pre><code>func main() {\n    fmt.Println(\"  spaced  \")\n}</code></pre>",
+		"</body></html>",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("minifyPage() output does not contain %q:\n%s", want, got)
+		}
+	}
+	for _, unwanted := range []string{"<!-- comment -->", "console.log( answer )", "   <rect"} {
+		if strings.Contains(got, unwanted) {
+			t.Errorf("minifyPage() output still contains %q:\n%s", unwanted, got)
+		}
+	}
+}
+
+func TestParseMarkdownFeatures(t *testing.T) {
+	tests := []struct {
+		name     string
+		markdown Markdown
+		input    string
+		want     []string
+		unwanted []string
+	}{
+		{
+			name:  "defaults",
+			input: "\"Quoted\" text and ~~old~~\n\n| a |\n|---|\n| 1 |\n",
+			want:  []string{"&ldquo;Quoted&rdquo;", "<del>old</del>", "<table>"},
+		},
+		{
+			name:     "typographer off",
+			markdown: Markdown{"typographer": false},
+			input:    "\"Quoted\" -- text\n",
+			want:     []string{"&quot;Quoted&quot; -- text"},
+			unwanted: []string{"&ldquo;"},
+		},
+		{
+			name:     "gfm off but tables on",
+			markdown: Markdown{"gfm": false, "table": true},
+			input:    "~~old~~\n\n| a |\n|---|\n| 1 |\n",
+			want:     []string{"~~old~~", "<table>"},
+		},
+		{
+			name:     "frontmatter overrides config",
+			markdown: Markdown{"typographer": false},
+			input:    "---\nmarkdown:\n  typographer: true\n  definition_list: true\n---\n\"Quoted\"\n\nTerm\n: Definition\n",
+			want:     []string{"&ldquo;Quoted&rdquo;", "<dl>", "<dt>Term</dt>", "<dd>Definition</dd>"},
+		},
+		{
+			name:     "cjk",
+			markdown: Markdown{"cjk": true},
+			input:    "日本語の\n文章\n",
+			want:     []string{"日本語の文章"},
+		},
+		{
+			name:     "hard wraps and xhtml",
+			markdown: Markdown{"hard-wraps": true, "xhtml": true},
+			input:    "one\ntwo\n",
+			want:     []string{"one<br />\ntwo"},
+		},
+		{
+			name:     "unsafe off",
+			markdown: Markdown{"unsafe": false},
+			input:    "<div>raw</div>\n",
+			want:     []string{"<!-- raw HTML omitted -->"},
+		},
+		{
+			name:     "heading attributes",
+			markdown: Markdown{"attributes": true},
+			input:    "## Setup {#install .wide}\n",
+			want:     []string{`<h2 id="install" class="wide">Setup</h2>`},
+		},
+		{
+			name:     "attribute block after a list",
+			markdown: Markdown{"attributes": true},
+			input:    "- one\n- two\n\n{.checklist #steps}\n",
+			want:     []string{`<ul class="checklist" id="steps">`},
+			unwanted: []string{"{.checklist"},
+		},
+		{
+			name:     "attribute list ending a paragraph",
+			markdown: Markdown{"attributes": true},
+			input:    "A note.\n{.note data-level=\"2\"}\n",
+			want:     []string{`<p class="note" data-level="2">A note.</p>`},
+		},
+		{
+			name:  "attributes off",
+			input: "A note.\n{.note}\n",
+			want:  []string{"{.note}"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, html, err := parseMarkdown([]byte(tt.input), parseOptions{Markdown: tt.markdown})
+			if err != nil {
+				t.Fatalf("parseMarkdown() error = %v", err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(string(html), want) {
+					t.Errorf("parseMarkdown() html = %s, want it to contain %s", html, want)
+				}
+			}
+			for _, unwanted := range tt.unwanted {
+				if strings.Contains(string(html), unwanted) {
+					t.Errorf("parseMarkdown() html = %s, want no %s", html, unwanted)
+				}
+			}
+		})
+	}
+
+	t.Run("unknown feature in frontmatter", func(t *testing.T) {
+		input := "---\ntitle: Features\nmarkdown:\n  typograph: false\n---\n# Hi\n"
+		_, _, err := parseMarkdown([]byte(input), parseOptions{File: "page.md"})
+		var located *diag.Error
+		if !errors.As(err, &located) {
+			t.Fatalf("parseMarkdown() error = %v (%T), want *diag.Error", err, err)
+		}
+		if located.Line != 4 || !strings.Contains(located.Msg, `unknown markdown feature "typograph"`) {
+			t.Errorf("parseMarkdown() error = %v, want unknown feature at line 4", located)
+		}
+	})
+
+	t.Run("unknown feature in config", func(t *testing.T) {
+		if err := (Markdown{"footnotes": true}).Validate(); err == nil {
+			t.Errorf("Validate() error = nil, want unknown feature")
+		}
+	})
+}
+
+func TestParseMarkdownTypography(t *testing.T) {
+	tests := []struct {
+		name       string
+		lang       string
+		typography Typographies
+		input      string
+		want       string
+	}{
+		{name: "english", lang: "en", input: `"Hello" 'world'`, want: "&ldquo;Hello&rdquo; &lsquo;world&rsquo;"},
+		{name: "german", lang: "de", input: `"Hallo" 'Welt'`, want: "„Hallo“ ‚Welt‘"},
+		{name: "swiss german", lang: "de-CH", input: `"Grüezi"`, want: "«Grüezi»"},
+		{name: "french quotes", lang: "fr", input: `"Bonjour"`, want: "«\u00a0Bonjour\u00a0»"},
+		{
+			name:  "french punctuation",
+			lang:  "fr",
+			input: "Vraiment ? Oui : c'est ça ; enfin !",
+			want:  "Vraiment\u202f? Oui\u00a0: c&rsquo;est ça\u202f; enfin\u202f!",
+		},
+		{name: "french code is left alone", lang: "fr", input: "`a ? b : c`", want: "<code>a ? b : c</code>"},
+		{name: "unknown language falls back to english", lang: "tlh", input: `"Qapla" it's`, want: "&ldquo;Qapla&rdquo; it&rsquo;s"},
+		{
+			name:       "override",
+			lang:       "fr-CA",
+			typography: Typographies{"fr-ca": {LeftDoubleQuote: "«", RightDoubleQuote: "»", SpaceBefore: map[string]string{"?": "", "!": ""}}},
+			input:      `"Allo" ? Oui !`,
+			want:       "«Allo» ? Oui !",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := "---\nlang: " + tt.lang + "\n---\n" + tt.input + "\n"
+			_, html, err := parseMarkdown([]byte(input), parseOptions{Typography: tt.typography})
+			if err != nil {
+				t.Fatalf("parseMarkdown() error = %v", err)
+			}
+			if !strings.Contains(string(html), tt.want) {
+				t.Errorf("parseMarkdown() html = %q, want it to contain %q", html, tt.want)
+			}
+		})
+	}
+
+	t.Run("load overrides", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "typography.yaml")
+		content := "de:\n  left_double_quote: \"»\"\n  right_double_quote: \"«\"\n"
+		if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		typo, err := LoadTypography(file)
+		if err != nil {
+			t.Fatalf("LoadTypography() error = %v", err)
+		}
+		got := typographyFor("de-AT", typo)
+		if got.LeftDoubleQuote != "»" || got.LeftSingleQuote != "‚" {
+			t.Errorf("typographyFor() = %+v, want overridden double quotes and built-in single quotes", got)
+		}
+	})
+}
+
+func TestParseMarkdownDirection(t *testing.T) {
+	tests := []struct {
+		frontmatter string
+		want        string
+	}{
+		{frontmatter: "", want: "ltr"},
+		{frontmatter: "lang: en", want: "ltr"},
+		{frontmatter: "lang: ar", want: "rtl"},
+		{frontmatter: "lang: he-IL", want: "rtl"},
+		{frontmatter: "lang: fa", want: "rtl"},
+		{frontmatter: "lang: ur", want: "rtl"},
+		{frontmatter: "lang: az-Arab", want: "rtl"},
+		{frontmatter: "lang: az", want: "ltr"},
+		{frontmatter: "lang: ar\ndir: ltr", want: "ltr"},
+		{frontmatter: "lang: en\ndir: auto", want: "auto"},
+		{frontmatter: "lang: ar\ndir: sideways", want: "rtl"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.frontmatter, func(t *testing.T) {
+			input := "# Page\n"
+			if tt.frontmatter != "" {
+				input = "---\n" + tt.frontmatter + "\n---\n" + input
+			}
+			meta, _, err := parseMarkdown([]byte(input), parseOptions{})
+			if err != nil {
+				t.Fatalf("parseMarkdown() error = %v", err)
+			}
+			if meta.Dir != tt.want {
+				t.Errorf("parseMarkdown() meta.Dir = %q, want %q", meta.Dir, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseMarkdownAlerts(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		want     []string
+		unwanted []string
+	}{
+		{
+			name:     "github note",
+			input:    "> [!NOTE]\n> Useful *information*.\n",
+			want:     []string{`<div class="alert alert-note" role="note">`, `<p class="alert-title"><svg class="alert-icon"`, "</svg>Note</p>", "<p>Useful <em>information</em>.</p>"},
+			unwanted: []string{"[!NOTE]", "<blockquote>"},
+		},
+		{
+			name:  "marker on its own paragraph",
+			input: "> [!Warning]\n>\n> Careful.\n",
+			want:  []string{`<div class="alert alert-warning" role="note">`, "</svg>Warning</p>\n<p>Careful.</p>"},
+		},
+		{
+			name:  "plain blockquote",
+			input: "> Just a quote.\n",
+			want:  []string{"<blockquote>\n<p>Just a quote.</p>"},
+		},
+		{
+			name:  "unknown marker",
+			input: "> [!DANGER]\n> Text.\n",
+			want:  []string{"<blockquote>"},
+		},
+		{
+			name:  "container with title",
+			input: ":::tip Pro tip\nSome **content**.\n:::\n\nAfter.\n",
+			want:  []string{`<div class="alert alert-tip" role="note">`, "</svg>Pro tip</p>\n<p>Some <strong>content</strong>.</p>\n</div>\n<p>After.</p>"},
+		},
+		{
+			name:  "nested containers",
+			input: "::::caution\nOuter\n:::important\nInner\n:::\nStill outer\n::::\n",
+			want:  []string{"<p>Inner</p>\n</div>\n<p>Still outer</p>\n</div>"},
+		},
+		{
+			name:     "unknown container",
+			input:    ":::spoiler\nText\n:::\n",
+			want:     []string{"<p>:::spoiler"},
+			unwanted: []string{"alert"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, html, err := parseMarkdown([]byte(tt.input), parseOptions{})
+			if err != nil {
+				t.Fatalf("parseMarkdown() error = %v", err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(string(html), want) {
+					t.Errorf("parseMarkdown() html = %s, want it to contain %s", html, want)
+				}
+			}
+			for _, unwanted := range tt.unwanted {
+				if strings.Contains(string(html), unwanted) {
+					t.Errorf("parseMarkdown() html = %s, want no %s", html, unwanted)
+				}
+			}
+		})
+	}
+
+	t.Run("off", func(t *testing.T) {
+		_, html, err := parseMarkdown([]byte("> [!NOTE]\n> Text.\n"), parseOptions{Markdown: Markdown{"alerts": false}})
+		if err != nil {
+			t.Fatalf("parseMarkdown() error = %v", err)
+		}
+		if !strings.Contains(string(html), "<blockquote>") {
+			t.Errorf("parseMarkdown() html = %s, want a blockquote", html)
+		}
+	})
+
+	t.Run("survives ugc sanitizing", func(t *testing.T) {
+		_, html, err := parseMarkdown([]byte("> [!NOTE]\n> Text.\n"), parseOptions{})
+		if err != nil {
+			t.Fatalf("parseMarkdown() error = %v", err)
+		}
+		got := string(ugcPolicy().SanitizeBytes(html))
+		for _, want := range []string{`<div class="alert alert-note" role="note">`, `<p class="alert-title">`, "<svg", "<circle", "<path d="} {
+			if !strings.Contains(got, want) {
+				t.Errorf("sanitized html = %s, want it to contain %s", got, want)
+			}
+		}
+		evil := string(ugcPolicy().SanitizeBytes([]byte(`<div class="evil" role="alert" onclick="x()">Hi</div>`)))
+		if strings.Contains(evil, "evil") || strings.Contains(evil, "role") || strings.Contains(evil, "onclick") {
+			t.Errorf("sanitized html = %s, want user classes, roles and handlers removed", evil)
+		}
+	})
+}
+
+func TestParseMarkdownMath(t *testing.T) {
+	on := Markdown{"math": true}
+	tests := []struct {
+		name     string
+		input    string
+		want     []string
+		unwanted []string
+	}{
+		{
+			name:  "inline",
+			input: "Euler: $e^{i\\pi} + 1 = 0$.\n",
+			want:  []string{`<p>Euler: <math xmlns="http://www.w3.org/1998/Math/MathML"><semantics><mrow><msup><mi>e</mi>`, `<annotation encoding="application/x-tex">e^{i\pi} + 1 = 0</annotation></semantics></math>.</p>`},
+		},
+		{
+			name:  "display block",
+			input: "$$\n\\sum_{k=1}^n k = \\frac{n(n+1)}{2}\n$$\n\nAfter.\n",
+			want:  []string{`<math xmlns="http://www.w3.org/1998/Math/MathML" display="block"><semantics><mrow><munderover><mo>∑</mo>`, "</math>\n<p>After.</p>"},
+		},
+		{
+			name:  "display on one line",
+			input: "$$ E = mc^2 $$\n",
+			want:  []string{`display="block"`, "<mi>E</mi><mo>=</mo>"},
+		},
+		{
+			name:  "inline display",
+			input: "So $$x^2$$ here.\n",
+			want:  []string{`<p>So <math xmlns="http://www.w3.org/1998/Math/MathML" display="block">`},
+		},
+		{
+			name:     "prices",
+			input:    "It costs $5 and $10.\n",
+			want:     []string{"<p>It costs $5 and $10.</p>"},
+			unwanted: []string{"<math"},
+		},
+		{
+			name:     "shell variables",
+			input:    "Prices $5 and $10. Add $HOME/bin:$PATH to your path.\n",
+			want:     []string{"<p>Prices $5 and $10. Add $HOME/bin:$PATH to your path.</p>"},
+			unwanted: []string{"<math"},
+		},
+		{
+			name:     "across lines",
+			input:    "It was $x and\nthen y$ later.\n",
+			want:     []string{"<p>It was $x and\nthen y$ later.</p>"},
+			unwanted: []string{"<math"},
+		},
+		{
+			name:  "unknown commands",
+			input: "Run $\\foo$ with $x$.\n\n$$\n\\begin{foo} x \\end{foo}\n$$\n",
+			want:  []string{"<p>Run $\\foo$ with <math", "<p>$$\n\\begin{foo} x \\end{foo}\n$$</p>"},
+		},
+		{
+			name:     "escaped dollar",
+			input:    "Just \\$x$ text.\n",
+			unwanted: []string{"<math"},
+		},
+		{
+			name:     "code span",
+			input:    "Use `$x$` for math.\n",
+			want:     []string{"<code>$x$</code>"},
+			unwanted: []string{"<math"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, html, err := parseMarkdown([]byte(tt.input), parseOptions{Markdown: on})
+			if err != nil {
+				t.Fatalf("parseMarkdown() error = %v", err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(string(html), want) {
+					t.Errorf("parseMarkdown() html = %s, want it to contain %s", html, want)
+				}
+			}
+			for _, unwanted := range tt.unwanted {
+				if strings.Contains(string(html), unwanted) {
+					t.Errorf("parseMarkdown() html = %s, want no %s", html, unwanted)
+				}
+			}
+		})
+	}
+
+	t.Run("errors point at the formula", func(t *testing.T) {
+		input := "---\ntitle: Maths\n---\n\nFine $x$.\n\n$$\na = \\frac{1}{2\n$$\n\nAnd $x^$.\n"
+		_, _, err := parseMarkdown([]byte(input), parseOptions{File: "page.md", Markdown: on})
+		if err == nil {
+			t.Fatal("parseMarkdown() error = nil, want math errors")
+		}
+		for _, want := range []string{
+			"page.md:8:13: invalid math: missing } to close this {",
+			"page.md:11:8: invalid math: missing argument for ^",
+		} {
+			if !strings.Contains(err.Error(), want) {
+				t.Errorf("parseMarkdown() error = %v, want it to contain %q", err, want)
+			}
+		}
+	})
+
+	t.Run("unknown commands warn", func(t *testing.T) {
+		input := "Run $\\foo$.\n\n$$\nx + \\quux\n$$\n"
+		var warnings []string
+		opts := parseOptions{File: "page.md", Markdown: on, Warn: func(w *diag.Error) {
+			warnings = append(warnings, w.Error())
+		}}
+		if _, _, err := parseMarkdown([]byte(input), opts); err != nil {
+			t.Fatalf("parseMarkdown() error = %v", err)
+		}
+		want := []string{
+			`page.md:1:6: warning: math left as text: unknown command \foo`,
+			`page.md:4:5: warning: math left as text: unknown command \quux`,
+		}
+		if !reflect.DeepEqual(warnings, want) {
+			t.Errorf("parseMarkdown() warnings = %q, want %q", warnings, want)
+		}
+
+		opts.Strict = true
+		if _, _, err := parseMarkdown([]byte(input), opts); err == nil || !strings.Contains(err.Error(), `page.md:4:5: math left as text: unknown command \quux`) {
+			t.Errorf("parseMarkdown() strict error = %v, want the unknown command", err)
+		}
+	})
+
+	t.Run("unclosed display math", func(t *testing.T) {
+		_, _, err := parseMarkdown([]byte("Text.\n\n$$\nx\n"), parseOptions{File: "page.md", Markdown: on})
+		if err == nil || !strings.Contains(err.Error(), "page.md:3:1: missing closing $$ for display math") {
+			t.Errorf("parseMarkdown() error = %v, want unclosed display math", err)
+		}
+	})
+
+	t.Run("off by default", func(t *testing.T) {
+		_, html, err := parseMarkdown([]byte("$x^2$\n"), parseOptions{})
+		if err != nil {
+			t.Fatalf("parseMarkdown() error = %v", err)
+		}
+		if strings.Contains(string(html), "<math") {
+			t.Errorf("parseMarkdown() html = %s, want no math", html)
+		}
+	})
+
+	t.Run("survives ugc sanitizing", func(t *testing.T) {
+		_, html, err := parseMarkdown([]byte("$$\n\\left( \\mathbb{R}^n \\right) \\quad \\begin{cases} 1 & x \\\\ 0 & y \\end{cases}\n$$\n"), parseOptions{Markdown: on})
+		if err != nil {
+			t.Fatalf("parseMarkdown() error = %v", err)
+		}
+		if got := string(ugcPolicy().SanitizeBytes(html)); got != string(html) {
+			t.Errorf("sanitized html =\n%s\nwant unchanged\n%s", got, html)
+		}
+		evil := string(ugcPolicy().SanitizeBytes([]byte(`<math><mi href="javascript:x()" mathvariant="url(x)">x</mi></math>`)))
+		if strings.Contains(evil, "href") || strings.Contains(evil, "url(") {
+			t.Errorf("sanitized html = %s, want links and bad values removed", evil)
+		}
+	})
+}
+
+func TestParseMarkdownIncludes(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"contact.md":            "---\ntitle: Ignored\n---\n## Contact\n\nMail us.\n",
+		"shared/changelog.md":   "# Changes\n\n{{#include entries/one.md}}\n```md\n{{#include nope.md}}\n# Not a heading\n```\n",
+		"shared/entries/one.md": "## v1.0\n\nFirst release.",
+		"a.md":                  "A\n\n{{#include b.md}}\n",
+		"b.md":                  "B\n\n{{#include a.md}}\n",
+		"self.md":               "{{#include self.md}}\n",
+		"math.md":               "Broken $\\frac{1$.\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	page := filepath.Join(dir, "page.md")
+	var read []string
+	opts := parseOptions{File: page, Markdown: Markdown{"math": true}, ReadInclude: func(path string) ([]byte, error) {
+		read = append(read, filepath.ToSlash(strings.TrimPrefix(path, dir+string(filepath.Separator))))
+		return os.ReadFile(path)
+	}}
+
+	t.Run("expands relative to the including file", func(t *testing.T) {
+		read = nil
+		input := "---\ntitle: Page\n---\n# Page\n\n{{#include contact.md}}\n\n{{#include \"shared/changelog.md\" shift=1}}\n"
+		meta, html, err := parseMarkdown([]byte(input), opts)
+		if err != nil {
+			t.Fatalf("parseMarkdown() error = %v", err)
+		}
+		if meta.Title != "Page" {
+			t.Errorf("Title = %q, want the page's own", meta.Title)
+		}
+		for _, want := range []string{
+			`<h2 id="contact">Contact</h2>`,
+			"<p>Mail us.</p>",
+			`<h2 id="changes">Changes</h2>`,
+			`<h3 id="v10">v1.0</h3>`,
+			"<p>First release.</p>",
+			"{{#include nope.md}}\n# Not a heading\n</code>",
+		} {
+			if !strings.Contains(string(html), want) {
+				t.Errorf("parseMarkdown() html = %s, want it to contain %s", html, want)
+			}
+		}
+		if strings.Contains(string(html), "Ignored") {
+			t.Errorf("parseMarkdown() html = %s, want included frontmatter dropped", html)
+		}
+		if want := []string{"contact.md", "shared/changelog.md", "shared/entries/one.md"}; !reflect.DeepEqual(read, want) {
+			t.Errorf("read %v, want %v", read, want)
+		}
+	})
+
+	tests := []struct {
+		name, input, want string
+	}{
+		{"missing file", "Text.\n\n{{#include missing.md}}\n", "page.md:3:1: failed to include missing.md"},
+		{"cycle", "{{#include a.md}}\n", "b.md:3:1: include cycle: " + filepath.Join(dir, "a.md") + " → " + filepath.Join(dir, "b.md") + " → " + filepath.Join(dir, "a.md")},
+		{"self", "{{#include self.md}}\n", "self.md:1:1: include cycle"},
+		{"errors in included files", "Fine $x$.\n\n{{#include math.md}}\n", "math.md:1:14: invalid math: missing } to close this {"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := parseMarkdown([]byte(tt.input), opts)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("parseMarkdown() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+
+	t.Run("depth limit", func(t *testing.T) {
+		// chain includes n files below the page, each in the directory of
+		// the one before.
+		chain := func(n int) func(string) ([]byte, error) {
+			return func(path string) ([]byte, error) {
+				if strings.Count(filepath.ToSlash(path), "deeper/") < n-1 {
+					return []byte("{{#include deeper/x.md}}\n"), nil
+				}
+				return []byte("Bottom.\n"), nil
+			}
+		}
+		_, html, err := parseMarkdown([]byte("{{#include x.md}}\n"), parseOptions{File: page, ReadInclude: chain(maxIncludeDepth - 1)})
+		if err != nil || !strings.Contains(string(html), "Bottom.") {
+			t.Errorf("parseMarkdown() = %s, %v, want files nested right up to the limit", html, err)
+		}
+		_, _, err = parseMarkdown([]byte("{{#include x.md}}\n"), parseOptions{File: page, ReadInclude: chain(maxIncludeDepth)})
+		if err == nil || !strings.Contains(err.Error(), "includes are nested more than 16 deep") {
+			t.Errorf("parseMarkdown() error = %v, want depth limit", err)
+		}
+	})
+
+	t.Run("off without a reader", func(t *testing.T) {
+		_, html, err := parseMarkdown([]byte("{{#include contact.md}}\n"), parseOptions{File: page})
+		if err != nil {
+			t.Fatalf("parseMarkdown() error = %v", err)
+		}
+		if want := "<p>{{#include contact.md}}</p>"; !strings.Contains(string(html), want) {
+			t.Errorf("parseMarkdown() html = %s, want %s", html, want)
+		}
+	})
+}
+
+// TestBuildUgc checks that includes and shortcodes, which read other files,
+// are off in --ugc mode.
+func TestBuildUgc(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "page.md")
+	snippet := filepath.Join(dir, "snippet.md")
+	if err := os.WriteFile(input, []byte("# Page\n\n{{#include snippet.md}}\n\n{{< details summary=More />}}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(snippet, []byte("Shared *text*.\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, ugc := range []bool{false, true} {
+		output := filepath.Join(dir, "out.html")
+		res, err := Build(GenerateConfig{Input: input, Output: output, Ugc: ugc})
+		if err != nil {
+			t.Fatalf("Build(ugc=%t) error = %v", ugc, err)
+		}
+		html, err := os.ReadFile(output)
+		if err != nil {
+			t.Fatal(err)
+		}
+		included := strings.Contains(string(html), "<p>Shared <em>text</em>.</p>")
+		shortcode := strings.Contains(string(html), "<details><summary>More</summary></details>")
+		watched := false
+		for _, s := range res.Sources {
+			watched = watched || s == snippet
+		}
+		if included == ugc || shortcode == ugc || watched == ugc {
+			t.Errorf("Build(ugc=%t) included = %t, shortcode = %t, watched = %t, want %t", ugc, included, shortcode, watched, !ugc)
+		}
+	}
+}
+
+func TestBuildSelfContainedAssets(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "src")
+	output := filepath.Join(dir, "out")
+	writeFiles(t, input, map[string]string{
+		"page.md":    "![Logo](logo.png)\n\n![Photo](photo.png)\n\n[Manual](manual.pdf)\n",
+		"logo.png":   "\x89PNG\r\n\x1a\nlogo",
+		"photo.png":  "\x89PNG\r\n\x1a\n" + strings.Repeat("x", 100),
+		"manual.pdf": "%PDF-1.4",
+	})
+	if err := os.MkdirAll(output, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := Build(GenerateConfig{
+		Input:         filepath.Join(input, "page.md"),
+		Output:        filepath.Join(output, "page.html"),
+		CopyAssets:    true,
+		SelfContained: true,
+		InlineLimit:   50,
+	})
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+	for file, want := range map[string]bool{"logo.png": false, "photo.png": true, "manual.pdf": true} {
+		_, err := os.Stat(filepath.Join(output, file))
+		if copied := err == nil; copied != want {
+			t.Errorf("Build() copied %s = %t, want %t", file, copied, want)
+		}
+	}
+
+	t.Run("untrusted pages", func(t *testing.T) {
+		writeFiles(t, dir, map[string]string{
+			"secret/key.png": "\x89PNG\r\n\x1a\nTOPSECRET",
+			"src/ugc.md":     "![Key](../secret/key.png)\n\n![Logo](logo.png)\n",
+		})
+		out := filepath.Join(output, "ugc.html")
+		if _, err := Build(GenerateConfig{Input: filepath.Join(input, "ugc.md"), Output: out, Ugc: true, SelfContained: true}); err != nil {
+			t.Fatalf("Build() error = %v", err)
+		}
+		html, err := os.ReadFile(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(string(html), "data:image/png") {
+			t.Errorf("Build() output = %s, want no files embedded from an untrusted page", html)
+		}
+	})
+}
+
+func TestParseMarkdownCodeIncludes(t *testing.T) {
+	dir := t.TempDir()
+	src := "package main\n\nimport \"fmt\"\n\nfunc main() {\n\t// #region greet\n\tname := \"june\"\n\t// #region inner\n\tfmt.Println(\"hi\", name)\n\t// #endregion\n\t// #endregion\n}\n"
+	if err := os.MkdirAll(filepath.Join(dir, "docs"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "main.go"), []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "fence.md"), []byte("```\n~~~\n```\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	page := filepath.Join(dir, "docs", "page.md")
+	var read []string
+	opts := parseOptions{File: page, Markdown: Markdown{"math": true}, ReadInclude: func(path string) ([]byte, error) {
+		read = append(read, filepath.Base(path))
+		return os.ReadFile(path)
+	}}
+
+	tests := []struct {
+		name, input, want string
+	}{
+		{
+			name:  "whole file",
+			input: "```go file=../main.go\n```\n",
+			want:  "<pre><code class=\"language-go\">package main\n\nimport &quot;fmt&quot;\n",
+		},
+		{
+			name:  "line range",
+			input: "```go file=../main.go lines=5-6\nplaceholder\n```\n\nAfter.\n",
+			want:  "<pre><code class=\"language-go\">func main() {\n\t// #region greet\n</code></pre>\n<p>After.</p>",
+		},
+		{
+			name:  "open range",
+			input: "```go file=../main.go lines=12-\n```\n",
+			want:  "<code class=\"language-go\">}\n</code>",
+		},
+		{
+			name:  "region is dedented without markers",
+			input: "```go file=\"../main.go\" region=greet\n```\n",
+			want:  "<code class=\"language-go\">name := &quot;june&quot;\nfmt.Println(&quot;hi&quot;, name)\n</code>",
+		},
+		{
+			name:  "language from the extension",
+			input: "```file=../main.go lines=1\n```\n",
+			want:  "<code class=\"language-go\">package main\n</code>",
+		},
+		{
+			name:  "fences in the code",
+			input: "```md file=../fence.md\n```\n",
+			want:  "<code class=\"language-md\">```\n~~~\n```\n</code>",
+		},
+		{
+			name:  "plain code blocks",
+			input: "```go\nx := 1\n```\n",
+			want:  "<code class=\"language-go\">x := 1\n</code>",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, html, err := parseMarkdown([]byte(tt.input), opts)
+			if err != nil {
+				t.Fatalf("parseMarkdown() error = %v", err)
+			}
+			if !strings.Contains(string(html), tt.want) {
+				t.Errorf("parseMarkdown() html = %s, want it to contain %s", html, tt.want)
+			}
+		})
+	}
+
+	errTests := []struct {
+		name, input, want string
+	}{
+		{"missing file", "Text.\n\n```go file=nope.go\n```\n", "page.md:3:1: failed to include nope.go"},
+		{"range past the end", "```go file=../main.go lines=10-99\n```\n", "page.md:1:1: lines=10-99 is outside ../main.go, which has 12 lines"},
+		{"bad range", "```go file=../main.go lines=a-b\n```\n", "lines=a-b is not a range like 10-40, 10- or 10"},
+		{"missing region", "```go file=../main.go region=nope\n```\n", `no region "nope" in ../main.go`},
+	}
+	for _, tt := range errTests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := parseMarkdown([]byte(tt.input), opts)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("parseMarkdown() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+
+	t.Run("read through the include reader", func(t *testing.T) {
+		read = nil
+		if _, _, err := parseMarkdown([]byte("```go file=../main.go\n```\n"), opts); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(read, []string{"main.go"}) {
+			t.Errorf("read %v, want [main.go]", read)
+		}
+	})
+
+	t.Run("off without a reader", func(t *testing.T) {
+		_, html, err := parseMarkdown([]byte("```go file=../main.go\nwritten\n```\n"), parseOptions{File: page})
+		if err != nil {
+			t.Fatalf("parseMarkdown() error = %v", err)
+		}
+		if want := "<code class=\"language-go\">written\n</code>"; !strings.Contains(string(html), want) {
+			t.Errorf("parseMarkdown() html = %s, want %s", html, want)
+		}
+	})
+}
+
+func TestParseMarkdownShortcodes(t *testing.T) {
+	shortcodes, _, err := LoadShortcodes("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	shortcodes["grid"] = template.Must(template.New("grid").Parse(`<div class="grid" data-cols="{{ .Args.cols }}">` + "\n" + `{{ .Content }}</div>`))
+	shortcodes["raw"] = template.Must(template.New("raw").Parse(`<pre>{{ .Inner }}</pre>`))
+	opts := parseOptions{File: "page.md", Shortcodes: shortcodes}
+
+	tests := []struct {
+		name, input, want string
+	}{
+		{
+			name:  "built-in on its own line",
+			input: "{{< youtube id=\"abc\" start=30 >}}\n\nAfter.\n",
+			want:  `<div class="embed embed-video"><iframe src="https://www.youtube-nocookie.com/embed/abc?start=30" title="YouTube video"`,
+		},
+		{
+			name:  "inline with inner markdown",
+			input: "Click {{< button href=/go >}}**here**{{< /button >}} now.\n",
+			want:  `<p>Click <a class="button" href="/go"><strong>here</strong></a> now.</p>`,
+		},
+		{
+			name:  "block with inner markdown",
+			input: "{{< grid cols=2 >}}\n## Inside\n\n- a\n{{< /grid >}}\n\nAfter.\n",
+			want:  "<div class=\"grid\" data-cols=\"2\">\n<h2 id=\"inside\">Inside</h2>\n<ul>\n<li>a</li>\n</ul>\n</div>\n<p>After.</p>",
+		},
+		{
+			name:  "closing tag in a later code block",
+			input: "{{< youtube id=\"abc\" >}}\n\nAfter.\n\n```md\n{{< /youtube >}}\n```\n",
+			want:  "</iframe></div>\n<p>After.</p>\n<pre><code class=\"language-md\">{{&lt; /youtube &gt;}}\n</code></pre>",
+		},
+		{
+			name:  "closing tag in an inner code block",
+			input: "{{< grid cols=1 >}}\n```md\n{{< /grid >}}\n```\n{{< /grid >}}\n",
+			want:  "<div class=\"grid\" data-cols=\"1\">\n<pre><code class=\"language-md\">{{&lt; /grid &gt;}}\n</code></pre>\n</div>",
+		},
+		{
+			name:  "nested with the same name",
+			input: "{{< grid cols=1 >}}\n{{< grid cols=2 >}}\nA\n{{< /grid >}}\nB\n{{< /grid >}}\n",
+			want:  "<div class=\"grid\" data-cols=\"1\">\n<div class=\"grid\" data-cols=\"2\">\n<p>A</p>\n</div>\n<p>B</p>\n</div>",
+		},
+		{
+			name:  "self-closing",
+			input: "{{< details summary='More info' />}}\n",
+			want:  "<details><summary>More info</summary></details>\n",
+		},
+		{
+			name:  "raw inner text",
+			input: "{{< raw >}}\n*not emphasis*\n{{< /raw >}}\n",
+			want:  "<pre>*not emphasis*\n</pre>",
+		},
+		{
+			name:  "arguments are escaped",
+			input: "{{< figure src=a.png alt=\"<b>\" caption=\"A & B\" />}}\n",
+			want:  `<figure><img src="a.png" alt="&lt;b&gt;"><figcaption>A &amp; B</figcaption></figure>`,
+		},
+		{
+			name:  "code is left alone",
+			input: "`{{< youtube >}}`\n",
+			want:  "<code>{{&lt; youtube &gt;}}</code>",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, html, err := parseMarkdown([]byte(tt.input), opts)
+			if err != nil {
+				t.Fatalf("parseMarkdown() error = %v", err)
+			}
+			if !strings.Contains(string(html), tt.want) {
+				t.Errorf("parseMarkdown() html = %s, want it to contain %s", html, tt.want)
+			}
+		})
+	}
+
+	errTests := []struct {
+		name, input, want string
+	}{
+		{"unknown", "Text.\n\nSee {{< tweet id=1 >}}.\n", `page.md:3:5: unknown shortcode "tweet", expected one of button, details, figure, grid, raw, video, youtube`},
+		{"missing argument", "Intro.\n\n{{< youtube >}}\n", `page.md:3:1: shortcode "youtube": missing argument "id"`},
+		{"positional argument", "{{< youtube abc >}}\n", `page.md:1:1: shortcode "youtube": argument abc must be written as name=value`},
+		{"stray closing tag", "{{< /grid >}}\n", "page.md:1:1: closing shortcode {{< /grid >}} without an opening one"},
+		{"unknown inside inner content", "Go {{< button href=/ >}}{{< nope />}}{{< /button >}}\n", `page.md:1:25: unknown shortcode "nope"`},
+	}
+	for _, tt := range errTests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := parseMarkdown([]byte(tt.input), opts)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("parseMarkdown() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+
+	t.Run("off without templates", func(t *testing.T) {
+		_, html, err := parseMarkdown([]byte("{{< youtube id=abc >}}\n"), parseOptions{})
+		if err != nil {
+			t.Fatalf("parseMarkdown() error = %v", err)
+		}
+		if want := "<p>{{&lt; youtube id=abc &gt;}}</p>"; !strings.Contains(string(html), want) {
+			t.Errorf("parseMarkdown() html = %s, want %s", html, want)
+		}
+	})
+}
+
+func TestLoadShortcodes(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "youtube.html"), []byte(`<lite-youtube videoid="{{ .Get "id" }}"></lite-youtube>`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "callout.gohtml"), []byte(`<aside>{{ .Content }}</aside>`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "notes.txt"), []byte(`ignored`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	shortcodes, files, err := LoadShortcodes(dir)
+	if err != nil {
+		t.Fatalf("LoadShortcodes() error = %v", err)
+	}
+	if _, ok := shortcodes["callout"]; !ok {
+		t.Error("LoadShortcodes() didn't load callout.gohtml")
+	}
+	if _, ok := shortcodes["figure"]; !ok {
+		t.Error("LoadShortcodes() dropped the built-in figure")
+	}
+	if _, ok := shortcodes["notes"]; ok {
+		t.Error("LoadShortcodes() loaded a .txt file")
+	}
+	if len(files) != 3 || files[0] != dir {
+		t.Errorf("LoadShortcodes() files = %v, want the directory and its two templates", files)
+	}
+	_, html, err := parseMarkdown([]byte("{{< youtube id=abc />}}\n"), parseOptions{Shortcodes: shortcodes})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `<lite-youtube videoid="abc"></lite-youtube>`; !strings.Contains(string(html), want) {
+		t.Errorf("parseMarkdown() html = %s, want the user's youtube shortcode", html)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "broken.html"), []byte(`{{ .Args`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := LoadShortcodes(dir); err == nil || !strings.Contains(err.Error(), "failed to parse shortcode") {
+		t.Errorf("LoadShortcodes() error = %v, want a parse error", err)
+	}
+	if _, _, err := LoadShortcodes(filepath.Join(dir, "missing")); err == nil {
+		t.Error("LoadShortcodes() of a missing directory succeeded")
+	}
+}
+
+func TestBuildLayouts(t *testing.T) {
+	dir := t.TempDir()
+	templates := filepath.Join(dir, "templates")
+	if err := os.MkdirAll(filepath.Join(templates, "layouts"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	layout := filepath.Join(templates, "layouts", "post.gohtml")
+	if err := os.WriteFile(layout, []byte(`{{ define "main" }}<article>{{ .Content }}</article>{{ end }}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	input := filepath.Join(dir, "page.md")
+	output := filepath.Join(dir, "out.html")
+
+	if err := os.WriteFile(input, []byte("---\nlayout: post\n---\n\nHello.\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	res, err := Build(GenerateConfig{Input: input, Output: output, Template: templates})
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+	html, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(html), "<article><p>Hello.</p>\n</article>") {
+		t.Errorf("Build() output = %s, want the post layout", html)
+	}
+	if !slices.Contains(res.Sources, layout) {
+		t.Errorf("Build() sources = %v, want them to include %s", res.Sources, layout)
+	}
+
+	if err := os.WriteFile(input, []byte("---\ntitle: Page\nlayout: pots\n---\n\nHello.\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, err = Build(GenerateConfig{Input: input, Output: output, Template: templates})
+	var located *diag.Error
+	if !errors.As(err, &located) {
+		t.Fatalf("Build() error = %v (%T), want *diag.Error", err, err)
+	}
+	if located.Line != 3 || located.Msg != `unknown layout "pots", expected one of default, post` {
+		t.Errorf("Build() error = %v at line %d, want the unknown layout on line 3", located.Msg, located.Line)
+	}
+}
+
+func TestLoadData(t *testing.T) {
+	write := func(t *testing.T, dir string, files map[string]string) {
+		t.Helper()
+		for name, content := range files {
+			path := filepath.Join(dir, filepath.FromSlash(name))
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	t.Run("keyed by path", func(t *testing.T) {
+		dir := t.TempDir()
+		write(t, dir, map[string]string{
+			"team.yaml":           "- name: Ada\n  role: Lead\n- name: Lin\n",
+			"site.toml":           "title = \"June\"\n",
+			"pricing/tiers.json":  `[{"name": "Free", "price": 0}, {"name": "Pro", "price": 9.5}]`,
+			"releases.csv":        "\ufeffversion,date\n1.0,2024-01-02\n\"1.1, hotfix\",2024-02-03\n",
+			"notes.txt":           "ignored",
+			".hidden/secret.yaml": "a: 1\n",
+		})
+		tree, files, err := LoadData(dir)
+		if err != nil {
+			t.Fatalf("LoadData() error = %v", err)
+		}
+		want := map[string]any{
+			"team": []any{
+				map[string]any{"name": "Ada", "role": "Lead"},
+				map[string]any{"name": "Lin"},
+			},
+			"site": map[string]any{"title": "June"},
+			"pricing": map[string]any{
+				"tiers": []any{
+					map[string]any{"name": "Free", "price": float64(0)},
+					map[string]any{"name": "Pro", "price": 9.5},
+				},
+			},
+			"releases": []map[string]string{
+				{"version": "1.0", "date": "2024-01-02"},
+				{"version": "1.1, hotfix", "date": "2024-02-03"},
+			},
+		}
+		if !reflect.DeepEqual(tree, want) {
+			t.Errorf("LoadData() = %#v, want %#v", tree, want)
+		}
+		wantFiles := []string{
+			dir,
+			filepath.Join(dir, "pricing"),
+			filepath.Join(dir, "pricing", "tiers.json"),
+			filepath.Join(dir, "releases.csv"),
+			filepath.Join(dir, "site.toml"),
+			filepath.Join(dir, "team.yaml"),
+		}
+		if !reflect.DeepEqual(files, wantFiles) {
+			t.Errorf("LoadData() files = %v, want %v", files, wantFiles)
+		}
+	})
+
+	t.Run("empty without a directory", func(t *testing.T) {
+		tree, files, err := LoadData("")
+		if err != nil || len(tree) != 0 || files != nil {
+			t.Errorf("LoadData(\"\") = %v, %v, %v, want an empty tree", tree, files, err)
+		}
+	})
+
+	t.Run("clashing keys", func(t *testing.T) {
+		dir := t.TempDir()
+		write(t, dir, map[string]string{"team.yaml": "a: 1\n", "team.json": `{"a": 1}`})
+		_, _, err := LoadData(dir)
+		if err == nil || !strings.Contains(err.Error(), "both define .Data.team") {
+			t.Errorf("LoadData() error = %v, want a clash", err)
+		}
+	})
+
+	t.Run("errors are located", func(t *testing.T) {
+		tests := map[string]struct {
+			content string
+			line    int
+			msg     string
+		}{
+			"bad.yaml": {"a: 1\nb: [\n", 3, "invalid YAML data"},
+			"bad.csv":  {"a,b\n1,2\n3\n", 3, "invalid CSV: wrong number of fields"},
+		}
+		for name, tt := range tests {
+			dir := t.TempDir()
+			write(t, dir, map[string]string{name: tt.content})
+			_, _, err := LoadData(dir)
+			var located *diag.Error
+			if !errors.As(err, &located) {
+				t.Fatalf("LoadData(%s) error = %v (%T), want *diag.Error", name, err, err)
+			}
+			if located.File != filepath.Join(dir, name) || located.Line != tt.line || !strings.HasPrefix(located.Msg, tt.msg) {
+				t.Errorf("LoadData(%s) error = %s:%d: %s, want line %d: %s", name, located.File, located.Line, located.Msg, tt.line, tt.msg)
+			}
+		}
+	})
+}
+
+func TestBuildData(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "data"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	data := filepath.Join(dir, "data", "team.yaml")
+	if err := os.WriteFile(data, []byte("- name: Ada\n- name: Lin\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	shortcodes := filepath.Join(dir, "shortcodes")
+	if err := os.MkdirAll(shortcodes, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(shortcodes, "team.html"), []byte(`<ul>{{ range .Data.team }}<li>{{ .name }}</li>{{ end }}</ul>`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tmpl := filepath.Join(dir, "page.gohtml")
+	if err := os.WriteFile(tmpl, []byte(`{{ .Content }}<footer>{{ len .Data.team }} people</footer>`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	input := filepath.Join(dir, "page.md")
+	if err := os.WriteFile(input, []byte("{{< team />}}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	output := filepath.Join(dir, "out.html")
+
+	res, err := Build(GenerateConfig{Input: input, Output: output, Template: tmpl})
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+	html, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "<ul><li>Ada</li><li>Lin</li></ul>\n<footer>2 people</footer>"; string(html) != want {
+		t.Errorf("Build() output = %q, want %q", html, want)
+	}
+	if !slices.Contains(res.Sources, data) {
+		t.Errorf("Build() sources = %v, want them to include %s", res.Sources, data)
+	}
+}
+
+func TestParseMarkdownTables(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"data/plans.csv":     "name,price,users\nFree,0,12034\nPro,9.5,1500\nTeam,49,\n",
+		"data/plans.tsv":     "name\tnote\nFree\t*not* a | pipe\n",
+		"data/releases.json": `[{"version": "1.1", "date": "2024-03-01"}, {"date": "2024-01-02", "version": "1.0", "tags": ["lts"]}]`,
+		"data/bad.csv":       "a,b\n1,2\n3\n",
+		"data/empty.csv":     "",
+		"data/header.csv":    "a,b\n",
+		"data/twice.csv":     "a,b,a\n1,2,3\n",
+		"data/empty.json":    "[]",
+		"data/object.json":   `{"a": 1}`,
+		"data/notes.txt":     "x",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	opts := parseOptions{File: filepath.Join(dir, "page.md"), ReadInclude: os.ReadFile}
+	render := func(t *testing.T, input string) string {
+		t.Helper()
+		_, html, err := parseMarkdown([]byte(input), opts)
+		if err != nil {
+			t.Fatalf("parseMarkdown() error = %v", err)
+		}
+		return string(html)
+	}
+
+	t.Run("matches a hand-written table", func(t *testing.T) {
+		got := render(t, "{{#table data/plans.csv}}\n")
+		want := render(t, "| name | price | users |\n| --- | --- | --- |\n| Free | 0 | 12034 |\n| Pro | 9.5 | 1500 |\n| Team | 49 | |\n")
+		if got != want {
+			t.Errorf("table =\n%s\nwant\n%s", got, want)
+		}
+	})
+
+	t.Run("columns, headers, sorting, formats and alignment", func(t *testing.T) {
+		got := render(t, "Plans:\n{{#table data/plans.csv columns=name,users,price headers=\"name:Plan,price:Price (USD)\" sort=-price format=\"price:$%'.2f,users:%'d\" align=price:right}}\nMore text.\n")
+		want := render(t, "Plans:\n\n| Plan | users | Price (USD) |\n| --- | --- | ---: |\n| Team | | $49.00 |\n| Pro | 1,500 | $9.50 |\n| Free | 12,034 | $0.00 |\n\nMore text.\n")
+		if got != want {
+			t.Errorf("table =\n%s\nwant\n%s", got, want)
+		}
+	})
+
+	t.Run("cells are text", func(t *testing.T) {
+		got := render(t, "{{#table data/plans.tsv}}\n")
+		if !strings.Contains(got, "<td>*not* a | pipe</td>") {
+			t.Errorf("table = %s, want the cell as written", got)
+		}
+	})
+
+	t.Run("json keeps key order", func(t *testing.T) {
+		got := render(t, "{{#table data/releases.json sort=date}}\n")
+		want := render(t, "| version | date | tags |\n| --- | --- | --- |\n| 1.0 | 2024-01-02 | [\\\"lts\\\"] |\n| 1.1 | 2024-03-01 | |\n")
+		if got != want {
+			t.Errorf("table =\n%s\nwant\n%s", got, want)
+		}
+	})
+
+	errorTests := []struct {
+		name  string
+		input string
+		file  string
+		line  int
+		msg   string
+	}{
+		{"unknown column", "# T\n\n{{#table data/plans.csv columns=name,cost}}\n", "page.md", 3, `columns: data/plans.csv has no column "cost", expected one of name, price, users`},
+		{"unknown argument", "{{#table data/plans.csv filter=x}}\n", "page.md", 1, `unknown table argument "filter", expected one of columns, headers, sort, format, align`},
+		{"bad format", "{{#table data/plans.csv format=price:2}}\n", "page.md", 1, "format=price:2 needs a single number verb, like %.2f or %'d"},
+		{"bad alignment", "{{#table data/plans.csv align=price:up}}\n", "page.md", 1, "align=price:up must be left, center or right"},
+		{"unsupported file", "{{#table data/notes.txt}}\n", "page.md", 1, "tables can be made from .csv, .tsv or .json files, not data/notes.txt"},
+		{"missing file", "{{#table data/nope.csv}}\n", "page.md", 1, "failed to read table data/nope.csv"},
+		{"bad csv", "Intro.\n\n{{#table data/bad.csv}}\n", "page.md", 3, "table data/bad.csv, line 3: invalid CSV: wrong number of fields"},
+		{"empty csv", "{{#table data/empty.csv}}\n", "page.md", 1, "table data/empty.csv is empty"},
+		{"header only", "{{#table data/header.csv}}\n", "page.md", 1, "table data/header.csv has a header but no rows"},
+		{"repeated column", "{{#table data/twice.csv}}\n", "page.md", 1, `table data/twice.csv has two columns named "a"`},
+		{"empty json", "{{#table data/empty.json}}\n", "page.md", 1, "table data/empty.json is empty"},
+		{"json object", "{{#table data/object.json}}\n", "page.md", 1, "invalid JSON table data/object.json: expected an array of objects"},
+	}
+	for _, tt := range errorTests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := parseMarkdown([]byte(tt.input), opts)
+			var located *diag.Error
+			if !errors.As(err, &located) {
+				t.Fatalf("parseMarkdown() error = %v (%T), want *diag.Error", err, err)
+			}
+			if located.File != filepath.Join(dir, filepath.FromSlash(tt.file)) || located.Line != tt.line || !strings.HasPrefix(located.Msg, tt.msg) {
+				t.Errorf("parseMarkdown() error = %s:%d: %s, want %s:%d: %s", located.File, located.Line, located.Msg, tt.file, tt.line, tt.msg)
+			}
+		})
+	}
+}
+
+// writeFiles writes files, keyed by slash-separated path, under dir.
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestBuildSite(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "site")
+	output := filepath.Join(dir, "public")
+	writeFiles(t, input, map[string]string{
+		"index.md":             "---\ntitle: Home\n---\n\nWelcome.\n",
+		"about.md":             "# About\n",
+		"blog/index.md":        "# Blog\n",
+		"blog/post.md":         "---\ntitle: Post\n---\n\n{{< note />}}\n",
+		"_drafts/wip.md":       "# Not yet\n",
+		".hidden.md":           "# Hidden\n",
+		"static/style.css":     "body {}\n",
+		"static/readme.md":     "# Not a page\n",
+		"shortcodes/note.html": "<aside>note</aside>",
+		"templates/unused.md":  "# Not a page\n",
+		"blog/notes.txt":       "not markdown\n",
+	})
+
+	res, err := BuildSite(SiteConfig{Input: input, Output: output, BaseURL: "https://example.com/docs"})
+	if err != nil {
+		t.Fatalf("BuildSite() error = %v", err)
+	}
+	var got []string
+	err = filepath.WalkDir(output, func(path string, d os.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			rel, _ := filepath.Rel(output, path)
+			got = append(got, filepath.ToSlash(rel))
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(got)
+	want := []string{"about.html", "blog/index.html", "blog/post.html", "index.html", "readme.md", "style.css"}
+	if !slices.Equal(got, want) {
+		t.Errorf("BuildSite() wrote %v, want %v", got, want)
+	}
+
+	post, err := os.ReadFile(filepath.Join(output, "blog", "post.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(post), `<link rel="canonical" href="https://example.com/docs/blog/post.html">`) {
+		t.Errorf("BuildSite() post = %s, want a canonical link from the base URL", post)
+	}
+	if !strings.Contains(string(post), "<aside>note</aside>") {
+		t.Errorf("BuildSite() post = %s, want the site's shortcodes", post)
+	}
+	if !slices.Contains(res.Sources, filepath.Join(input, "blog", "post.md")) {
+		t.Errorf("BuildSite() sources = %v, want them to include the pages", res.Sources)
+	}
+
+	_, err = BuildSite(SiteConfig{Input: input, Output: output, BaseURL: "example.com"})
+	if err == nil || !strings.Contains(err.Error(), "not an absolute URL") {
+		t.Errorf("BuildSite() error = %v, want a relative base URL rejected", err)
+	}
+
+	t.Run("without a base URL", func(t *testing.T) {
+		local := filepath.Join(dir, "local")
+		if _, err := BuildSite(SiteConfig{Input: input, Output: local}); err != nil {
+			t.Fatalf("BuildSite() error = %v", err)
+		}
+		post, err := os.ReadFile(filepath.Join(local, "blog", "post.html"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, unwanted := range []string{"canonical", "og:url", `"url"`} {
+			if strings.Contains(string(post), unwanted) {
+				t.Errorf("BuildSite() post = %s, want no %s without a base URL", post, unwanted)
+			}
+		}
+	})
+}
+
+func TestBuildSiteFeeds(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "site")
+	output := filepath.Join(dir, "public")
+	writeFiles(t, input, map[string]string{
+		"index.md":        "---\ntitle: Notes\ndescription: Things I write down\n---\n\nWelcome.\n",
+		"about.md":        "# About\n\nUndated pages aren't in feeds.\n",
+		"posts/first.md":  "---\ntitle: First & foremost\ndate: 2024-03-01\ntags: [Go, Web Dev]\nauthor: Kim\ndescription: The first post\n---\n\n![Chart](chart.png) and [more](../about.html).\n",
+		"posts/second.md": "---\ntitle: Second\ndate: 2024-04-01T10:30:00Z\ntags: [Go]\n---\n\nShort one.\n",
+		"posts/third.md":  "---\ntitle: Third\ndate: 2024-05-01\n---\n\nNo tags.\n",
+	})
+	cfg := SiteConfig{
+		Page:    GenerateConfig{Fallbacks: Fallbacks{DescFromParagraph: true}},
+		Input:   input,
+		Output:  output,
+		BaseURL: "https://example.com/notes/",
+		Feeds:   FeedConfig{Enabled: true, Tags: true},
+	}
+
+	type rssItem struct {
+		Title       string   `xml:"title"`
+		Link        string   `xml:"link"`
+		GUID        string   `xml:"guid"`
+		PubDate     string   `xml:"pubDate"`
+		Creator     string   `xml:"http://purl.org/dc/elements/1.1/ creator"`
+		Description string   `xml:"description"`
+		Categories  []string `xml:"category"`
+	}
+	type rss struct {
+		Version string `xml:"version,attr"`
+		Channel struct {
+			Title       string `xml:"title"`
+			Description string `xml:"description"`
+			// Links holds both the channel's link and the atom:link to the
+			// feed itself, told apart by their namespace.
+			Links []struct {
+				XMLName xml.Name
+				Href    string `xml:"href,attr"`
+				Rel     string `xml:"rel,attr"`
+				Value   string `xml:",chardata"`
+			} `xml:"link"`
+			Items []rssItem `xml:"item"`
+		} `xml:"channel"`
+	}
+	rssLinks := func(feed rss) (link, self string) {
+		for _, l := range feed.Channel.Links {
+			if l.XMLName.Space == "" {
+				link = l.Value
+			} else if l.XMLName.Space == "http://www.w3.org/2005/Atom" && l.Rel == "self" {
+				self = l.Href
+			}
+		}
+		return link, self
+	}
+	type atomLink struct {
+		Href string `xml:"href,attr"`
+		Rel  string `xml:"rel,attr"`
+	}
+	type atomEntry struct {
+		ID        string     `xml:"id"`
+		Title     string     `xml:"title"`
+		Updated   string     `xml:"updated"`
+		Published string     `xml:"published"`
+		Author    string     `xml:"author>name"`
+		Links     []atomLink `xml:"link"`
+		Summary   string     `xml:"summary"`
+		Content   struct {
+			Type  string `xml:"type,attr"`
+			Value string `xml:",chardata"`
+		} `xml:"content"`
+	}
+	type atom struct {
+		XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+		ID      string      `xml:"id"`
+		Title   string      `xml:"title"`
+		Updated string      `xml:"updated"`
+		Author  string      `xml:"author>name"`
+		Links   []atomLink  `xml:"link"`
+		Entries []atomEntry `xml:"entry"`
+	}
+	read := func(t *testing.T, name string, v any) {
+		t.Helper()
+		b, err := os.ReadFile(filepath.Join(output, filepath.FromSlash(name)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := xml.Unmarshal(b, v); err != nil {
+			t.Fatalf("%s is not valid XML: %v", name, err)
+		}
+	}
+	// checkRSS checks what the RSS 2.0 specification requires, and that every
+	// link is absolute.
+	checkRSS := func(t *testing.T, name string) rss {
+		t.Helper()
+		var feed rss
+		read(t, name, &feed)
+		c := feed.Channel
+		link, self := rssLinks(feed)
+		if feed.Version != "2.0" || c.Title == "" || c.Description == "" || !strings.HasPrefix(link, "https://") {
+			t.Errorf("%s channel = %+v, want version 2.0 with a title, link and description", name, c)
+		}
+		if self != "https://example.com/notes/"+name {
+			t.Errorf("%s self link = %q, want the feed's own URL", name, self)
+		}
+		for _, item := range c.Items {
+			if item.Title == "" && item.Description == "" {
+				t.Errorf("%s item %+v has neither title nor description", name, item)
+			}
+			if _, err := time.Parse(time.RFC1123Z, item.PubDate); err != nil {
+				t.Errorf("%s item pubDate %q is not an RFC 822 date: %v", name, item.PubDate, err)
+			}
+			if !strings.HasPrefix(item.Link, "https://") || item.GUID != item.Link {
+				t.Errorf("%s item link %q and guid %q, want the same absolute URL", name, item.Link, item.GUID)
+			}
+		}
+		return feed
+	}
+	// checkAtom checks what RFC 4287 requires, and that every link is
+	// absolute.
+	checkAtom := func(t *testing.T, name string) atom {
+		t.Helper()
+		var feed atom
+		read(t, name, &feed)
+		if feed.ID == "" || feed.Title == "" {
+			t.Errorf("%s feed id %q and title %q, want both", name, feed.ID, feed.Title)
+		}
+		if _, err := time.Parse(time.RFC3339, feed.Updated); err != nil {
+			t.Errorf("%s updated %q is not an RFC 3339 date: %v", name, feed.Updated, err)
+		}
+		if !slices.Contains(feed.Links, atomLink{Href: "https://example.com/notes/" + name, Rel: "self"}) {
+			t.Errorf("%s links = %+v, want a self link", name, feed.Links)
+		}
+		for _, e := range feed.Entries {
+			if e.ID == "" || e.Title == "" {
+				t.Errorf("%s entry id %q and title %q, want both", name, e.ID, e.Title)
+			}
+			if e.Author == "" && feed.Author == "" {
+				t.Errorf("%s entry %q has no author, and neither has the feed", name, e.ID)
+			}
+			for _, date := range []string{e.Updated, e.Published} {
+				if _, err := time.Parse(time.RFC3339, date); err != nil {
+					t.Errorf("%s entry date %q is not an RFC 3339 date: %v", name, date, err)
+				}
+			}
+			if len(e.Links) != 1 || e.Links[0].Rel != "alternate" || e.Links[0].Href != e.ID || !strings.HasPrefix(e.ID, "https://") {
+				t.Errorf("%s entry links = %+v, want an absolute alternate link", name, e.Links)
+			}
+		}
+		return feed
+	}
+
+	if _, err := BuildSite(cfg); err != nil {
+		t.Fatalf("BuildSite() error = %v", err)
+	}
+
+	feed := checkRSS(t, "rss.xml")
+	if feed.Channel.Title != "Notes" || feed.Channel.Description != "Things I write down" {
+		t.Errorf("rss.xml channel = %+v, want the home page's title and description", feed.Channel)
+	}
+	wantFirst := rssItem{
+		Title:       "First & foremost",
+		Link:        "https://example.com/notes/posts/first.html",
+		GUID:        "https://example.com/notes/posts/first.html",
+		PubDate:     "Fri, 01 Mar 2024 00:00:00 +0000",
+		Creator:     "Kim",
+		Description: "The first post",
+		Categories:  []string{"Go", "Web Dev"},
+	}
+	if n := len(feed.Channel.Items); n != 3 {
+		t.Fatalf("rss.xml has %d items, want the 3 dated pages", n)
+	}
+	var titles []string
+	for _, item := range feed.Channel.Items {
+		titles = append(titles, item.Title)
+	}
+	if want := []string{"Third", "Second", "First & foremost"}; !slices.Equal(titles, want) {
+		t.Errorf("rss.xml items = %v, want %v, newest first", titles, want)
+	}
+	if got := feed.Channel.Items[2]; !reflect.DeepEqual(got, wantFirst) {
+		t.Errorf("rss.xml item = %+v, want %+v", got, wantFirst)
+	}
+
+	af := checkAtom(t, "atom.xml")
+	if af.ID != "https://example.com/notes/atom.xml" || af.Updated != "2024-05-01T00:00:00Z" || len(af.Entries) != 3 {
+		t.Errorf("atom.xml = %+v, want the site's 3 dated pages updated with the newest", af)
+	}
+	if e := af.Entries[1]; e.Updated != "2024-04-01T10:30:00Z" || e.Summary != "Short one." || e.Content.Value != "" {
+		t.Errorf("atom.xml entry = %+v, want the summary only", e)
+	}
+
+	tagged := checkRSS(t, "tags/go/rss.xml")
+	if link, _ := rssLinks(tagged); tagged.Channel.Title != "Notes: Go" || link != "https://example.com/notes/" || len(tagged.Channel.Items) != 2 {
+		t.Errorf("tags/go/rss.xml = %+v, want the 2 pages tagged Go", tagged.Channel)
+	}
+	if af := checkAtom(t, "tags/web-dev/atom.xml"); len(af.Entries) != 1 || af.Entries[0].Author != "Kim" {
+		t.Errorf("tags/web-dev/atom.xml = %+v, want the first post", af)
+	}
+
+	t.Run("full content", func(t *testing.T) {
+		cfg := cfg
+		cfg.Feeds = FeedConfig{Enabled: true, Full: true, Limit: 1}
+		cfg.Title = "My notes"
+		if _, err := BuildSite(cfg); err != nil {
+			t.Fatalf("BuildSite() error = %v", err)
+		}
+		feed := checkRSS(t, "rss.xml")
+		if feed.Channel.Title != "My notes" || len(feed.Channel.Items) != 1 {
+			t.Errorf("rss.xml channel = %+v, want the configured title and 1 item", feed.Channel)
+		}
+		af := checkAtom(t, "atom.xml")
+		if len(af.Entries) != 1 || af.Entries[0].Content.Type != "html" || af.Entries[0].Content.Value != "<p>No tags.</p>\n" {
+			t.Errorf("atom.xml entries = %+v, want the newest page's HTML", af.Entries)
+		}
+
+		cfg.Feeds.Limit = 0
+		if _, err := BuildSite(cfg); err != nil {
+			t.Fatalf("BuildSite() error = %v", err)
+		}
+		feed = checkRSS(t, "rss.xml")
+		want := `<p><img src="https://example.com/notes/posts/chart.png" alt="Chart"> and <a href="https://example.com/notes/about.html">more</a>.</p>` + "\n"
+		if got := feed.Channel.Items[2].Description; got != want {
+			t.Errorf("rss.xml description = %q, want %q with absolute URLs", got, want)
+		}
+	})
+
+	t.Run("no base URL", func(t *testing.T) {
+		cfg := cfg
+		cfg.BaseURL = ""
+		_, err := BuildSite(cfg)
+		if err == nil || !strings.Contains(err.Error(), "base URL") {
+			t.Errorf("BuildSite() error = %v, want feeds to need a base URL", err)
+		}
+	})
+}
+
+func TestBuildSiteSitemap(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "site")
+	output := filepath.Join(dir, "public")
+	writeFiles(t, input, map[string]string{
+		"index.md":  "---\ntitle: Home\npriority: 1\nchangefreq: daily\n---\n\nWelcome.\n",
+		"about.md":  "# About\n",
+		"post.md":   "---\ntitle: Post\ndate: 2024-03-01\n---\n\nHello.\n",
+		"draft.md":  "---\ntitle: Draft\ndraft: true\ndate: 2024-04-01\n---\n\nNot yet.\n",
+		"hidden.md": "---\ntitle: Hidden\nnoindex: true\n---\n\nShh.\n",
+	})
+	modified := time.Date(2024, 2, 3, 4, 5, 6, 0, time.UTC)
+	if err := os.Chtimes(filepath.Join(input, "about.md"), modified, modified); err != nil {
+		t.Fatal(err)
+	}
+	cfg := SiteConfig{
+		Input:   input,
+		Output:  output,
+		BaseURL: "https://example.com/",
+		Feeds:   FeedConfig{Enabled: true},
+		Sitemap: true,
+		Robots:  RobotsConfig{Enabled: true, Disallow: []string{"/private/", "tmp/"}},
+	}
+	if _, err := BuildSite(cfg); err != nil {
+		t.Fatalf("BuildSite() error = %v", err)
+	}
+
+	b, err := os.ReadFile(filepath.Join(output, "sitemap.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sitemap struct {
+		XMLName xml.Name     `xml:"http://www.sitemaps.org/schemas/sitemap/0.9 urlset"`
+		URLs    []sitemapURL `xml:"url"`
+	}
+	if err := xml.Unmarshal(b, &sitemap); err != nil {
+		t.Fatalf("sitemap.xml is not a valid sitemap: %v\n%s", err, b)
+	}
+	want := []sitemapURL{
+		{Loc: "https://example.com/", ChangeFreq: "daily", Priority: "1"},
+		{Loc: "https://example.com/about.html", LastMod: "2024-02-03T04:05:06Z"},
+		{Loc: "https://example.com/post.html", LastMod: "2024-03-01T00:00:00Z"},
+	}
+	if len(sitemap.URLs) != len(want) {
+		t.Fatalf("sitemap.xml urls = %+v, want %+v", sitemap.URLs, want)
+	}
+	for i, u := range sitemap.URLs {
+		if _, err := time.Parse(time.RFC3339, u.LastMod); err != nil {
+			t.Errorf("sitemap.xml lastmod %q is not a W3C date: %v", u.LastMod, err)
+		}
+		if i == 0 {
+			// The home page's lastmod is when the test wrote it.
+			u.LastMod = ""
+		}
+		if u != want[i] {
+			t.Errorf("sitemap.xml url = %+v, want %+v", u, want[i])
+		}
+	}
+
+	robots, err := os.ReadFile(filepath.Join(output, "robots.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "User-agent: *\nDisallow: /private/\nDisallow: /tmp/\n\nSitemap: https://example.com/sitemap.xml\n"; string(robots) != want {
+		t.Errorf("robots.txt = %q, want %q", robots, want)
+	}
+
+	feed, err := os.ReadFile(filepath.Join(output, "rss.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(feed), "Draft") || !strings.Contains(string(feed), "Post") {
+		t.Errorf("rss.xml = %s, want the post without the draft", feed)
+	}
+
+	t.Run("robots file", func(t *testing.T) {
+		writeFiles(t, input, map[string]string{"static/robots.txt": "User-agent: *\nDisallow: /admin/"})
+		if _, err := BuildSite(cfg); err != nil {
+			t.Fatalf("BuildSite() error = %v", err)
+		}
+		robots, err := os.ReadFile(filepath.Join(output, "robots.txt"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := "User-agent: *\nDisallow: /admin/\n\nSitemap: https://example.com/sitemap.xml\n"; string(robots) != want {
+			t.Errorf("robots.txt = %q, want %q", robots, want)
+		}
+
+		cfg := cfg
+		cfg.BaseURL = ""
+		cfg.Feeds.Enabled = false
+		output := filepath.Join(dir, "local")
+		cfg.Output = output
+		if _, err := BuildSite(cfg); err != nil {
+			t.Fatalf("BuildSite() error = %v", err)
+		}
+		if _, err := os.Stat(filepath.Join(output, "sitemap.xml")); !os.IsNotExist(err) {
+			t.Errorf("BuildSite() wrote sitemap.xml without a base URL")
+		}
+		robots, err = os.ReadFile(filepath.Join(output, "robots.txt"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(robots) != "User-agent: *\nDisallow: /admin/" {
+			t.Errorf("robots.txt = %q, want the static file as it is", robots)
+		}
+	})
+}
+
+func TestBuildSiteTags(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "site")
+	output := filepath.Join(dir, "public")
+	writeFiles(t, input, map[string]string{
+		"index.md":       "---\ntitle: Home\nlang: fr\n---\n\nBienvenue.\n",
+		"blog/first.md":  "---\ntitle: First\ndate: 2024-03-01\ntags: [Go, Web Dev]\n---\n\nHello.\n",
+		"blog/second.md": "---\ntitle: Second\ndate: 2024-04-01\ntags: [go, Go]\n---\n\nAgain.\n",
+		"notes.md":       "---\ntitle: Notes\ntags: [Web Dev]\n---\n\nUndated.\n",
+		"draft.md":       "---\ntitle: Draft\ndraft: true\ntags: [Secret, Go]\n---\n\nNot yet.\n",
+	})
+	cfg := SiteConfig{Input: input, Output: output, TagPages: true}
+	read := func(t *testing.T, name string) string {
+		t.Helper()
+		b, err := os.ReadFile(filepath.Join(output, filepath.FromSlash(name)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(b)
+	}
+
+	if _, err := BuildSite(cfg); err != nil {
+		t.Fatalf("BuildSite() error = %v", err)
+	}
+	if got, want := read(t, "blog/first.html"), `<ul class="tags">
+  <li><a href="../tags/go/index.html" rel="tag">Go</a></li>
+  <li><a href="../tags/web-dev/index.html" rel="tag">Web Dev</a></li>
+</ul>`; !strings.Contains(got, want) {
+		t.Errorf("BuildSite() page = %s, want tag links %s", got, want)
+	}
+	if got, want := read(t, "tags/go/index.html"), `<h1>Go</h1>
+<ul class="tag-pages">
+<li><a href="../../blog/second.html">Second</a> <time datetime="2024-04-01">1 April 2024</time></li>
+<li><a href="../../blog/first.html">First</a> <time datetime="2024-03-01">1 March 2024</time></li>
+</ul>`; !strings.Contains(got, want) {
+		t.Errorf("BuildSite() tag page = %s, want %s", got, want)
+	}
+	if got := read(t, "tags/go/index.html"); !strings.Contains(got, `<html lang="fr" dir="ltr">`) || !strings.Contains(got, "<title>Go</title>") {
+		t.Errorf("BuildSite() tag page = %s, want the site's language and the tag as title", got)
+	}
+	if got, want := read(t, "tags/index.html"), `<ul class="tag-index">
+<li><a href="../tags/go/index.html" rel="tag">Go</a> <span class="count">2</span></li>
+<li><a href="../tags/web-dev/index.html" rel="tag">Web Dev</a> <span class="count">2</span></li>
+</ul>`; !strings.Contains(got, want) {
+		t.Errorf("BuildSite() tag index = %s, want %s", got, want)
+	}
+	if _, err := os.Stat(filepath.Join(output, "tags", "secret")); !os.IsNotExist(err) {
+		t.Errorf("BuildSite() wrote a tag page for a draft's tag")
+	}
+
+	t.Run("layouts", func(t *testing.T) {
+		cfg := cfg
+		cfg.BaseURL = "https://example.com/"
+		cfg.Sitemap = true
+		cfg.Page.Template = filepath.Join(dir, "theme")
+		writeFiles(t, cfg.Page.Template, map[string]string{
+			"base.gohtml":         `<main>{{ block "main" . }}{{ .Content }}{{ end }}</main>{{ range .Tags }}[{{ .URL }}]{{ end }}{{ join "," .Tags }}{{ if contains "Go" .Tags }} in Go{{ end }}`,
+			"layouts/tag.gohtml":  `{{ define "main" }}{{ .Tag.Name }}: {{ .Tag.Count }}{{ range .Tag.Pages }} {{ .URL }}{{ end }}{{ end }}`,
+			"layouts/tags.gohtml": `{{ define "main" }}{{ range .AllTags }}{{ .Slug }}={{ .Count }} {{ end }}{{ end }}`,
+		})
+		if _, err := BuildSite(cfg); err != nil {
+			t.Fatalf("BuildSite() error = %v", err)
+		}
+		if got, want := read(t, "blog/first.html"), "<main><p>Hello.</p>\n</main>[https://example.com/tags/go/][https://example.com/tags/web-dev/]Go,Web Dev in Go"; got != want {
+			t.Errorf("BuildSite() page = %q, want %q", got, want)
+		}
+		if got, want := read(t, "tags/web-dev/index.html"), "<main>Web Dev: 2 https://example.com/blog/first.html https://example.com/notes.html</main>"; got != want {
+			t.Errorf("BuildSite() tag page = %q, want %q", got, want)
+		}
+		if got, want := read(t, "tags/index.html"), "<main>go=2 web-dev=2 </main>"; got != want {
+			t.Errorf("BuildSite() tag index = %q, want %q", got, want)
+		}
+		if sitemap := read(t, "sitemap.xml"); !strings.Contains(sitemap, "<loc>https://example.com/tags/go/</loc>\n    <lastmod>2024-04-01T00:00:00Z</lastmod>") {
+			t.Errorf("sitemap.xml = %s, want the tag pages", sitemap)
+		}
+	})
+
+	t.Run("clash", func(t *testing.T) {
+		writeFiles(t, input, map[string]string{"tags/index.md": "# My tags\n"})
+		_, err := BuildSite(cfg)
+		if err == nil || !strings.Contains(err.Error(), "clashes with the tag index") {
+			t.Errorf("BuildSite() error = %v, want a clash with the tag index", err)
+		}
+	})
+}
@@ -0,0 +1,409 @@
+package generate
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/kscarlett/june/internal/diag"
+)
+
+// maxIncludeDepth limits how deeply included files can include others,
+// counting the page they start from.
+const maxIncludeDepth = 16
+
+// includeDirective matches an include on a line of its own:
+//
+//	{{#include snippets/contact.md}}
+//	{{#include "shared/change log.md" shift=1}}
+var includeDirective = regexp.MustCompile(`^ {0,3}\{\{#include\s+("[^"]+"|[^\s"}]+)(?:\s+shift=([+-]?\d+))?\s*\}\}\s*$`)
+
+var (
+	fenceOpen  = regexp.MustCompile("^ {0,3}(`{3,}|~{3,})")
+	atxHeading = regexp.MustCompile(`^ {0,3}(#{1,6})(?:[ \t]|$)`)
+	newline    = []byte("\n")
+)
+
+// sourceSpan maps a stretch of the expanded document, from Start up to the
+// next span, back to the file it was read from.
+type sourceSpan struct {
+	Start  int
+	File   string
+	Src    []byte
+	Offset int // Offset in Src that Start corresponds to.
+}
+
+// sourceMap locates offsets of a document with its includes expanded.
+type sourceMap []sourceSpan
+
+// locate returns the file, its source and the offset within it for an
+// offset of the expanded document.
+func (m sourceMap) locate(off int) (string, []byte, int) {
+	i := len(m) - 1
+	for i > 0 && m[i].Start > off {
+		i--
+	}
+	s := m[i]
+	return s.File, s.Src, s.Offset + off - s.Start
+}
+
+// includer expands include and table directives into a single document.
+type includer struct {
+	read  func(path string) ([]byte, error)
+	out   []byte
+	spans sourceMap
+	stack []string // Files being expanded, outermost first, for cycles.
+}
+
+// expandDirectives replaces the include directives in the markdown src with
+// the files they name, and table directives with the tables they make.
+// Paths are relative to the including file, so the top level resolves them
+// against the directory of file. The frontmatter of src is kept; that of
+// included files is dropped.
+func expandDirectives(file string, src []byte, read func(string) ([]byte, error)) ([]byte, sourceMap, error) {
+	in := &includer{read: read}
+	end := frontmatterEnd(src)
+	in.copy(file, src, 0, src[:end])
+	if err := in.expand(file, src, end, 0); err != nil {
+		return nil, nil, err
+	}
+	return in.out, in.spans, nil
+}
+
+// copy appends text, which starts at offset off of the file src.
+func (in *includer) copy(file string, src []byte, off int, text []byte) {
+	if n := len(in.spans); n == 0 || in.spans[n-1].File != file ||
+		in.spans[n-1].Offset+len(in.out)-in.spans[n-1].Start != off {
+		in.spans = append(in.spans, sourceSpan{Start: len(in.out), File: file, Src: src, Offset: off})
+	}
+	in.out = append(in.out, text...)
+}
+
+// expand copies src from offset start, expanding includes and shifting
+// ATX headings by shift levels. Code blocks are copied untouched.
+func (in *includer) expand(file string, src []byte, start, shift int) error {
+	in.stack = append(in.stack, file)
+	defer func() { in.stack = in.stack[:len(in.stack)-1] }()
+
+	var fence []byte
+	// replaced is the fence written in place of a code block whose contents
+	// come from a source file, or "" for a code block copied as is.
+	var replaced string
+	for off := start; off < len(src); {
+		end := len(src)
+		if i := bytes.IndexByte(src[off:], '\n'); i >= 0 {
+			end = off + i + 1
+		}
+		line := src[off:end]
+		trimmed := bytes.TrimRight(line, "\r\n")
+
+		switch {
+		case fence != nil:
+			closed := closesFence(trimmed, fence)
+			if closed {
+				fence = nil
+			}
+			switch {
+			case replaced == "":
+				in.copy(file, src, off, line)
+			case closed:
+				in.out = append(in.out, replaced+"\n"...)
+				replaced = ""
+			}
+		case fenceOpen.Match(trimmed):
+			m := fenceOpen.FindSubmatchIndex(trimmed)
+			fence = trimmed[m[2]:m[3]]
+			info := parseCodeInfo(string(trimmed[m[1]:]))
+			if info.File == "" {
+				in.copy(file, src, off, line)
+				break
+			}
+			code, err := in.code(file, src, off, info)
+			if err != nil {
+				return err
+			}
+			replaced = codeFence(string(fence), code)
+			in.out = append(in.out, replaced+info.Rest+"\n"+code...)
+		case includeDirective.Match(trimmed):
+			m := includeDirective.FindSubmatch(trimmed)
+			target := strings.Trim(string(m[1]), `"`)
+			n := shift
+			if m[2] != nil {
+				s, _ := strconv.Atoi(string(m[2]))
+				n += s
+			}
+			if err := in.include(file, src, off, target, n); err != nil {
+				return err
+			}
+			if !bytes.HasSuffix(in.out, newline) {
+				in.out = append(in.out, '\n')
+			}
+		case tableDirective.Match(trimmed):
+			m := tableDirective.FindSubmatch(trimmed)
+			if err := in.table(file, src, off, string(m[1])); err != nil {
+				return err
+			}
+		default:
+			if m := atxHeading.FindSubmatchIndex(trimmed); m != nil && shift != 0 {
+				level := min(max(m[3]-m[2]+shift, 1), 6)
+				in.copy(file, src, off, line[:m[2]])
+				in.out = append(in.out, strings.Repeat("#", level)...)
+				in.copy(file, src, off+m[3], line[m[3]:])
+			} else {
+				in.copy(file, src, off, line)
+			}
+		}
+		off = end
+	}
+	return nil
+}
+
+// include expands the file named by the directive at offset off of src.
+func (in *includer) include(file string, src []byte, off int, target string, shift int) error {
+	path := filepath.Join(filepath.Dir(file), filepath.FromSlash(target))
+	fail := func(format string, args ...any) error {
+		return diag.AtOffset(file, src, off, fmt.Sprintf(format, args...), nil)
+	}
+
+	for i, f := range in.stack {
+		if samePath(f, path) {
+			chain := append(append([]string(nil), in.stack[i:]...), path)
+			return fail("include cycle: %s", strings.Join(chain, " → "))
+		}
+	}
+	if len(in.stack) >= maxIncludeDepth {
+		return fail("includes are nested more than %d deep", maxIncludeDepth)
+	}
+
+	b, err := in.read(path)
+	if err != nil {
+		return diag.AtOffset(file, src, off, fmt.Sprintf("failed to include %s: %v", target, err), err)
+	}
+	// JSON frontmatter is blanked out line for line, YAML and TOML skipped.
+	_, b = splitJSONFrontmatter(b)
+	return in.expand(path, b, frontmatterEnd(b), shift)
+}
+
+// codeInfo is the info string of a fenced code block that takes its
+// contents from a source file:
+//
+//	```go file=../main.go lines=10-40
+//	```
+//
+// or, for the lines between "#region handler" and "#endregion" markers,
+//
+//	```go file=../main.go region=handler
+//	```
+type codeInfo struct {
+	File   string
+	Lines  string
+	Region string
+	Rest   string // The info string without the keys above.
+}
+
+var codeInfoKey = regexp.MustCompile(`^(file|lines|region)=("[^"]*"|\S+)$`)
+
+func parseCodeInfo(s string) codeInfo {
+	var info codeInfo
+	var rest []string
+	for _, field := range strings.Fields(s) {
+		m := codeInfoKey.FindStringSubmatch(field)
+		if m == nil {
+			rest = append(rest, field)
+			continue
+		}
+		v := strings.Trim(m[2], `"`)
+		switch m[1] {
+		case "file":
+			info.File = v
+		case "lines":
+			info.Lines = v
+		case "region":
+			info.Region = v
+		}
+	}
+	// Without a language, the file extension stands in for one.
+	if len(rest) == 0 && info.File != "" {
+		if ext := strings.TrimPrefix(path.Ext(info.File), "."); ext != "" {
+			rest = append(rest, ext)
+		}
+	}
+	info.Rest = strings.Join(rest, " ")
+	return info
+}
+
+// code reads the lines of a source file selected by info, for the code
+// block opened at offset off of src.
+func (in *includer) code(file string, src []byte, off int, info codeInfo) (string, error) {
+	fail := func(format string, args ...any) error {
+		return diag.AtOffset(file, src, off, fmt.Sprintf(format, args...), nil)
+	}
+	if info.Lines != "" && info.Region != "" {
+		return "", fail("use either lines= or region= to include part of %s, not both", info.File)
+	}
+
+	path := filepath.Join(filepath.Dir(file), filepath.FromSlash(info.File))
+	b, err := in.read(path)
+	if err != nil {
+		return "", diag.AtOffset(file, src, off, fmt.Sprintf("failed to include %s: %v", info.File, err), err)
+	}
+	lines := strings.SplitAfter(string(b), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	switch {
+	case info.Lines != "":
+		first, last, ok := lineRange(info.Lines, len(lines))
+		if !ok {
+			return "", fail("lines=%s is not a range like 10-40, 10- or 10", info.Lines)
+		}
+		if first < 1 || last > len(lines) || first > last {
+			return "", fail("lines=%s is outside %s, which has %d lines", info.Lines, info.File, len(lines))
+		}
+		lines = lines[first-1 : last]
+	case info.Region != "":
+		var found bool
+		if lines, found = region(lines, info.Region); !found {
+			return "", fail("no region %q in %s, mark it with #region %s and #endregion", info.Region, info.File, info.Region)
+		}
+	}
+
+	code := dedent(lines)
+	if code != "" && !strings.HasSuffix(code, "\n") {
+		code += "\n"
+	}
+	return code, nil
+}
+
+// lineRange parses "10-40", "10-", "-40" or "10" into 1-based inclusive
+// line numbers, for a file of n lines.
+func lineRange(s string, n int) (int, int, bool) {
+	from, to, isRange := strings.Cut(s, "-")
+	first, last := 1, n
+	var err error
+	if from != "" {
+		if first, err = strconv.Atoi(from); err != nil {
+			return 0, 0, false
+		}
+	}
+	if !isRange {
+		last = first
+	} else if to != "" {
+		if last, err = strconv.Atoi(to); err != nil {
+			return 0, 0, false
+		}
+	}
+	return first, last, from != "" || to != ""
+}
+
+var regionMarker = regexp.MustCompile(`#(end)?region\b\s*([\w.-]*)`)
+
+// region returns the lines between "#region name" and the matching
+// "#endregion", leaving out the marker lines of any regions inside it.
+func region(lines []string, name string) ([]string, bool) {
+	var out []string
+	depth := 0
+	for _, line := range lines {
+		m := regionMarker.FindStringSubmatch(line)
+		switch {
+		case m == nil:
+			if depth > 0 {
+				out = append(out, line)
+			}
+		case m[1] == "" && depth > 0:
+			depth++
+		case m[1] == "" && m[2] == name:
+			depth = 1
+		case m[1] != "" && depth > 0:
+			depth--
+			if depth == 0 {
+				return out, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// dedent removes the indentation that all non-blank lines share.
+func dedent(lines []string) string {
+	prefix := ""
+	first := true
+	for _, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		indent := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+		if first {
+			prefix, first = indent, false
+			continue
+		}
+		for !strings.HasPrefix(indent, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	var b strings.Builder
+	for _, line := range lines {
+		b.WriteString(strings.TrimPrefix(line, prefix))
+	}
+	return b.String()
+}
+
+// codeFence returns a fence like the original that is longer than any run
+// of the same character in code, so the code can't close the block early.
+func codeFence(fence, code string) string {
+	longest := 0
+	run := 0
+	for i := 0; i < len(code); i++ {
+		if code[i] == fence[0] {
+			run++
+			longest = max(longest, run)
+		} else {
+			run = 0
+		}
+	}
+	return strings.Repeat(fence[:1], max(len(fence), longest+1))
+}
+
+// closesFence reports whether line ends a code block opened with fence.
+func closesFence(line, fence []byte) bool {
+	t := bytes.TrimSpace(line)
+	return len(t) >= len(fence) && len(bytes.Trim(t, string(fence[:1]))) == 0
+}
+
+func samePath(a, b string) bool {
+	if abs, err := filepath.Abs(a); err == nil {
+		a = abs
+	}
+	if abs, err := filepath.Abs(b); err == nil {
+		b = abs
+	}
+	return a == b
+}
+
+// frontmatterEnd returns the offset just past a YAML or TOML frontmatter
+// block at the start of src, or 0 if there is none.
+func frontmatterEnd(src []byte) int {
+	first, rest, ok := bytes.Cut(src, newline)
+	delim := string(bytes.TrimRight(first, " \t\r"))
+	if !ok || delim != "---" && delim != "+++" {
+		return 0
+	}
+	off := len(first) + 1
+	for len(rest) > 0 {
+		line, next, found := bytes.Cut(rest, newline)
+		off += len(line)
+		if found {
+			off++
+		}
+		if string(bytes.TrimRight(line, " \t\r")) == delim {
+			return off
+		}
+		rest = next
+	}
+	return 0
+}
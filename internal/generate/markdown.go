@@ -0,0 +1,296 @@
+package generate
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/renderer/html"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+	"go.abhg.dev/goldmark/frontmatter"
+)
+
+// Markdown turns goldmark extensions and parser and renderer options on or
+// off by name. Features that aren't listed keep their default, see
+// markdownFeatures. It can be set from the command line and overridden per
+// page with a "markdown" frontmatter map. Options that take a value aren't
+// covered, only toggles.
+type Markdown map[string]bool
+
+// markdownFeature is an extension or option that can be toggled.
+type markdownFeature struct {
+	Default  bool
+	Extend   []goldmark.Option
+	Parser   []parser.Option
+	Renderer []renderer.Option
+}
+
+// markdownFeatures lists everything Markdown can toggle. The defaults match
+// what june has always rendered.
+var markdownFeatures = map[string]markdownFeature{
+	// The parts of GitHub Flavored Markdown. "gfm" toggles all four.
+	"table":         {Default: true, Extend: ext(extension.Table)},
+	"strikethrough": {Default: true, Extend: ext(extension.Strikethrough)},
+	"linkify":       {Default: true, Extend: ext(extension.Linkify)},
+	"tasklist":      {Default: true, Extend: ext(extension.TaskList)},
+
+	// The typographer is set up for the page language by newMarkdown.
+	"typographer":     {Default: true},
+	"footnote":        {Default: true, Extend: ext(extension.Footnote)},
+	"definition-list": {Extend: ext(extension.DefinitionList)},
+	"cjk":             {Extend: ext(extension.CJK)},
+	"alerts":          {Default: true, Extend: ext(alertExtension{})},
+	"math":            {Extend: ext(mathExtension{})},
+	"attributes": {Parser: []parser.Option{
+		parser.WithAttribute(),
+		parser.WithParagraphTransformers(util.Prioritized(attributeBlocks{}, 50)),
+	}},
+
+	"auto-heading-id": {Default: true, Parser: []parser.Option{parser.WithAutoHeadingID()}},
+	"hard-wraps":      {Renderer: []renderer.Option{html.WithHardWraps()}},
+	"xhtml":           {Renderer: []renderer.Option{html.WithXHTML()}},
+	"unsafe":          {Default: true, Renderer: []renderer.Option{html.WithUnsafe()}},
+}
+
+// markdownGroups are names that stand for several features at once.
+var markdownGroups = map[string][]string{
+	"gfm": {"table", "strikethrough", "linkify", "tasklist"},
+}
+
+func ext(e goldmark.Extender) []goldmark.Option {
+	return []goldmark.Option{goldmark.WithExtensions(e)}
+}
+
+// MarkdownFeatures returns the names Markdown accepts, sorted.
+func MarkdownFeatures() []string {
+	names := make([]string, 0, len(markdownFeatures)+len(markdownGroups))
+	for name := range markdownFeatures {
+		names = append(names, name)
+	}
+	for name := range markdownGroups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// normalizeFeature lets frontmatter use "definition_list" as well as
+// "definition-list".
+func normalizeFeature(name string) string {
+	return strings.ReplaceAll(strings.ToLower(strings.TrimSpace(name)), "_", "-")
+}
+
+// Validate reports the first feature name that june doesn't know.
+func (m Markdown) Validate() error {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := checkFeature(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkFeature(name string) error {
+	n := normalizeFeature(name)
+	if _, ok := markdownFeatures[n]; ok {
+		return nil
+	}
+	if _, ok := markdownGroups[n]; ok {
+		return nil
+	}
+	return fmt.Errorf("unknown markdown feature %q, expected one of %s", name, strings.Join(MarkdownFeatures(), ", "))
+}
+
+// with returns m overridden by a "markdown" frontmatter map. On error it also
+// returns the key at fault so it can be located in the frontmatter.
+func (m Markdown) with(v any) (Markdown, string, error) {
+	if v == nil {
+		return m, "", nil
+	}
+	overrides, ok := v.(map[string]any)
+	if !ok {
+		// Frontmatter validation has already reported the wrong type.
+		return m, "", nil
+	}
+	merged := make(Markdown, len(m)+len(overrides))
+	for name, on := range m {
+		merged[name] = on
+	}
+	keys := make([]string, 0, len(overrides))
+	for k := range overrides {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if err := checkFeature(k); err != nil {
+			return nil, k, fmt.Errorf("markdown: %w", err)
+		}
+		on, ok := overrides[k].(bool)
+		if !ok {
+			return nil, k, fmt.Errorf("markdown: %s: expected true or false, got %s", k, describe(overrides[k]))
+		}
+		merged[k] = on
+	}
+	return merged, "", nil
+}
+
+// enabled resolves m against the defaults. Groups are applied before
+// single features, so "gfm: false, table: true" keeps tables.
+func (m Markdown) enabled() map[string]bool {
+	on := make(map[string]bool, len(markdownFeatures))
+	for name, f := range markdownFeatures {
+		on[name] = f.Default
+	}
+	for name, v := range m {
+		for _, member := range markdownGroups[normalizeFeature(name)] {
+			on[member] = v
+		}
+	}
+	for name, v := range m {
+		if _, ok := markdownFeatures[normalizeFeature(name)]; ok {
+			on[normalizeFeature(name)] = v
+		}
+	}
+	return on
+}
+
+// newMarkdown builds a goldmark instance with the features m selects, using
+// typo for the typographer. The frontmatter extension is always included.
+func newMarkdown(m Markdown, typo Typography) goldmark.Markdown {
+	on := m.enabled()
+	names := make([]string, 0, len(on))
+	for name := range on {
+		names = append(names, name)
+	}
+	// Extensions register in a fixed order so output doesn't depend on map
+	// iteration.
+	sort.Strings(names)
+
+	opts := []goldmark.Option{
+		goldmark.WithExtensions(&frontmatter.Extender{Formats: frontmatterFormats}),
+	}
+	var parserOpts []parser.Option
+	var rendererOpts []renderer.Option
+	for _, name := range names {
+		if !on[name] {
+			continue
+		}
+		if name == "typographer" {
+			opts = append(opts, typo.options()...)
+			continue
+		}
+		f := markdownFeatures[name]
+		opts = append(opts, f.Extend...)
+		parserOpts = append(parserOpts, f.Parser...)
+		rendererOpts = append(rendererOpts, f.Renderer...)
+	}
+	opts = append(opts,
+		goldmark.WithParserOptions(parserOpts...),
+		goldmark.WithRendererOptions(rendererOpts...),
+	)
+	return goldmark.New(opts...)
+}
+
+// attributeBlocks applies kramdown-style attribute lists like
+// {#id .class key="value"}. A list on the last line of a paragraph applies to
+// that paragraph; a list on a line of its own applies to the block before it.
+type attributeBlocks struct{}
+
+func (attributeBlocks) Transform(node *ast.Paragraph, reader text.Reader, pc parser.Context) {
+	lines := node.Lines()
+	if lines.Len() == 0 {
+		return
+	}
+	last := lines.At(lines.Len() - 1)
+	attrs, ok := parseAttributeList(last.Value(reader.Source()))
+	if !ok {
+		return
+	}
+
+	target := ast.Node(node)
+	if lines.Len() == 1 {
+		target = node.PreviousSibling()
+		if target == nil {
+			return
+		}
+		node.Parent().RemoveChild(node.Parent(), node)
+	} else {
+		lines.SetSliced(0, lines.Len()-1)
+		// The line before the list ends the paragraph now, so it mustn't
+		// keep its line break.
+		prev := lines.At(lines.Len() - 1)
+		lines.Set(lines.Len()-1, prev.TrimRightSpace(reader.Source()))
+	}
+	for _, a := range attrs {
+		value := a.Value
+		if bytes.Equal(a.Name, []byte("class")) {
+			// Add to classes set by an earlier list rather than replacing
+			// them.
+			existing, _ := target.AttributeString("class")
+			if b, ok := existing.([]byte); ok {
+				value = []byte(fmt.Sprintf("%s %s", b, value))
+			}
+		}
+		target.SetAttribute(a.Name, value)
+	}
+}
+
+// parseAttributeList parses a line that holds nothing but an attribute list.
+func parseAttributeList(line []byte) (parser.Attributes, bool) {
+	line = util.TrimRightSpace(util.TrimLeftSpace(line))
+	if len(line) < 2 || line[0] != '{' || line[len(line)-1] != '}' {
+		return nil, false
+	}
+	r := text.NewReader(line)
+	attrs, ok := parser.ParseAttributes(r)
+	if !ok {
+		return nil, false
+	}
+	r.SkipSpaces()
+	if r.Peek() != text.EOF {
+		return nil, false
+	}
+	return attrs, true
+}
+
+// sourceError is a problem found while parsing or rendering the markdown, at
+// a byte offset of the source handed to goldmark. parseMarkdown maps it back
+// to the file it came from.
+type sourceError struct {
+	Offset int
+	Msg    string
+	Err    error
+
+	// Warning marks a problem that doesn't stop the build unless it is
+	// strict.
+	Warning bool
+}
+
+func (e *sourceError) Error() string { return e.Msg }
+
+func (e *sourceError) Unwrap() error { return e.Err }
+
+var sourceErrorsKey = parser.NewContextKey()
+
+func addSourceError(pc parser.Context, e *sourceError) {
+	errs, _ := pc.Get(sourceErrorsKey).([]*sourceError)
+	pc.Set(sourceErrorsKey, append(errs, e))
+}
+
+// sourceErrors returns the problems recorded during a parse.
+func sourceErrors(pc parser.Context) []*sourceError {
+	errs, _ := pc.Get(sourceErrorsKey).([]*sourceError)
+	return errs
+}
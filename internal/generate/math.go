@@ -0,0 +1,259 @@
+package generate
+
+import (
+	"bytes"
+	"errors"
+	"html"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+
+	"github.com/kscarlett/june/internal/mathml"
+)
+
+var (
+	kindMath      = ast.NewNodeKind("Math")
+	kindMathBlock = ast.NewNodeKind("MathBlock")
+)
+
+// math is a formula inside a paragraph, written as $…$ or $$…$$. The TeX is
+// converted while parsing, so MathML holds the markup to write.
+type math struct {
+	ast.BaseInline
+	Display bool
+	MathML  string
+}
+
+func (m *math) Kind() ast.NodeKind { return kindMath }
+
+func (m *math) Dump(source []byte, level int) {
+	ast.DumpHelper(m, source, level, map[string]string{"MathML": m.MathML}, nil)
+}
+
+// mathBlock is a display formula between lines starting and ending with $$.
+type mathBlock struct {
+	ast.BaseBlock
+	MathML string
+
+	open   int // Offset of the opening $$, for errors.
+	end    int // Offset after the closing $$.
+	closed bool
+}
+
+func (m *mathBlock) Kind() ast.NodeKind { return kindMathBlock }
+
+func (m *mathBlock) IsRaw() bool { return true }
+
+func (m *mathBlock) Dump(source []byte, level int) {
+	ast.DumpHelper(m, source, level, map[string]string{"MathML": m.MathML}, nil)
+}
+
+// mathExtension renders TeX math as MathML, without any JavaScript in the
+// page.
+type mathExtension struct{}
+
+func (mathExtension) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(
+		parser.WithBlockParsers(util.Prioritized(mathBlockParser{}, 150)),
+		parser.WithInlineParsers(util.Prioritized(mathInlineParser{}, 150)),
+	)
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(util.Prioritized(mathRenderer{}, 500)))
+}
+
+// convertMath converts the TeX in segs, which may span several lines. An
+// error is recorded in pc, pointing into the source at the problem. It
+// returns false for a formula using commands june doesn't know, which is
+// left as text, with a warning, as it may be prose with dollar signs.
+func convertMath(segs []text.Segment, source []byte, display bool, pc parser.Context) (string, bool) {
+	var tex []byte
+	for _, seg := range segs {
+		tex = append(tex, seg.Value(source)...)
+	}
+	out, err := mathml.Convert(string(tex), display)
+	if err == nil {
+		return out, true
+	}
+
+	var e *mathml.Error
+	if !errors.As(err, &e) {
+		addSourceError(pc, &sourceError{Offset: segs[0].Start, Msg: err.Error(), Err: err})
+		return "", true
+	}
+	// Map the offset in the formula back through the line segments.
+	offset := e.Offset
+	for _, seg := range segs {
+		if offset <= seg.Len() || seg == segs[len(segs)-1] {
+			offset += seg.Start
+			break
+		}
+		offset -= seg.Len()
+	}
+	if e.Unknown {
+		addSourceError(pc, &sourceError{Offset: offset, Msg: "math left as text: " + e.Msg, Err: err, Warning: true})
+		return "", false
+	}
+	addSourceError(pc, &sourceError{Offset: offset, Msg: "invalid math: " + e.Msg, Err: err})
+	return "", true
+}
+
+// mathInlineParser parses $…$ and $$…$$ inside paragraphs. To leave prices
+// like "$5 and $10" and variables like $HOME alone, a single-dollar formula
+// stays on one line, can't start or end with a space, and the closing $
+// can't be followed by a letter or digit.
+type mathInlineParser struct{}
+
+func (mathInlineParser) Trigger() []byte { return []byte{'$'} }
+
+func (mathInlineParser) Parse(parent ast.Node, block text.Reader, pc parser.Context) ast.Node {
+	line, _ := block.PeekLine()
+	opener := 0
+	for opener < len(line) && line[opener] == '$' {
+		opener++
+	}
+	if opener > 2 || opener == 1 && (len(line) < 2 || util.IsSpace(line[1])) {
+		return nil
+	}
+
+	l, pos := block.Position()
+	block.Advance(opener)
+	var segs []text.Segment
+	for {
+		line, seg := block.PeekLine()
+		if line == nil {
+			block.SetPosition(l, pos)
+			return nil
+		}
+		for i := 0; i < len(line); i++ {
+			switch line[i] {
+			case '\\':
+				i++
+			case '$':
+				j := i
+				for j < len(line) && line[j] == '$' {
+					j++
+				}
+				closes := j-i == opener
+				if opener == 1 {
+					closes = closes && i > 0 && !util.IsSpace(line[i-1]) && !(j < len(line) && util.IsAlphaNumeric(line[j]))
+				}
+				if closes {
+					segs = append(segs, seg.WithStop(seg.Start+i))
+					display := opener == 2
+					out, ok := convertMath(segs, block.Source(), display, pc)
+					if !ok {
+						block.SetPosition(l, pos)
+						return nil
+					}
+					block.Advance(j)
+					return &math{Display: display, MathML: out}
+				}
+				i = j - 1
+			}
+		}
+		if opener == 1 {
+			block.SetPosition(l, pos)
+			return nil
+		}
+		segs = append(segs, seg)
+		block.AdvanceLine()
+	}
+}
+
+// mathBlockParser parses display formulas:
+//
+//	$$
+//	\int_0^1 x\,dx = \frac12
+//	$$
+//
+// The formula can also start on the opening line or end on the closing one,
+// like "$$ E = mc^2 $$" on a line by itself.
+type mathBlockParser struct{}
+
+var mathFence = []byte("$$")
+
+func (mathBlockParser) Trigger() []byte { return []byte{'$'} }
+
+func (mathBlockParser) Open(parent ast.Node, reader text.Reader, pc parser.Context) (ast.Node, parser.State) {
+	line, seg := reader.PeekLine()
+	pos := pc.BlockOffset()
+	if pos < 0 || !bytes.HasPrefix(line[pos:], mathFence) {
+		return nil, parser.NoChildren
+	}
+	rest := util.TrimRightSpace(line[pos+2:])
+	start := seg.Start + pos + 2
+	node := &mathBlock{open: seg.Start + pos}
+	if i := bytes.Index(rest, mathFence); i >= 0 {
+		// Text after the closing $$ makes this inline math in a paragraph.
+		if i != len(rest)-2 {
+			return nil, parser.NoChildren
+		}
+		node.Lines().Append(text.NewSegment(start, start+i))
+		node.closed, node.end = true, start+i+2
+	} else if len(util.TrimLeftSpace(rest)) > 0 {
+		node.Lines().Append(text.NewSegment(start, seg.Stop))
+	}
+	reader.AdvanceToEOL()
+	return node, parser.NoChildren
+}
+
+func (mathBlockParser) Continue(node ast.Node, reader text.Reader, pc parser.Context) parser.State {
+	m := node.(*mathBlock)
+	if m.closed {
+		return parser.Close
+	}
+	line, seg := reader.PeekLine()
+	trimmed := util.TrimRightSpace(line)
+	if bytes.HasSuffix(trimmed, mathFence) {
+		m.Lines().Append(text.NewSegment(seg.Start, seg.Start+len(trimmed)-2))
+		m.closed, m.end = true, seg.Start+len(trimmed)
+		reader.AdvanceToEOL()
+		return parser.Close
+	}
+	m.Lines().Append(seg)
+	reader.AdvanceToEOL()
+	return parser.Continue | parser.NoChildren
+}
+
+func (mathBlockParser) Close(node ast.Node, reader text.Reader, pc parser.Context) {
+	m := node.(*mathBlock)
+	if !m.closed {
+		addSourceError(pc, &sourceError{Offset: m.open, Msg: "missing closing $$ for display math"})
+		return
+	}
+	lines := m.Lines()
+	out, ok := convertMath(lines.Sliced(0, lines.Len()), reader.Source(), true, pc)
+	if !ok {
+		// Not math after all, so show it as it was written.
+		out = "<p>" + html.EscapeString(string(reader.Source()[m.open:m.end])) + "</p>"
+	}
+	m.MathML = out
+}
+
+func (mathBlockParser) CanInterruptParagraph() bool { return true }
+
+func (mathBlockParser) CanAcceptIndentedLine() bool { return false }
+
+type mathRenderer struct{}
+
+func (mathRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(kindMath, renderMath)
+	reg.Register(kindMathBlock, renderMathBlock)
+}
+
+func renderMath(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if entering {
+		_, _ = w.WriteString(node.(*math).MathML)
+	}
+	return ast.WalkSkipChildren, nil
+}
+
+func renderMathBlock(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if entering {
+		_, _ = w.WriteString(node.(*mathBlock).MathML + "\n")
+	}
+	return ast.WalkSkipChildren, nil
+}
@@ -0,0 +1,38 @@
+package generate
+
+import (
+	"regexp"
+
+	"github.com/tdewolff/minify/v2"
+	"github.com/tdewolff/minify/v2/css"
+	"github.com/tdewolff/minify/v2/html"
+	"github.com/tdewolff/minify/v2/js"
+	"github.com/tdewolff/minify/v2/json"
+	"github.com/tdewolff/minify/v2/svg"
+)
+
+var minifier = newMinifier()
+
+// newMinifier sets up minification of a page and everything inlined into it:
+// <style> and style attributes, scripts, JSON-LD and inline SVG.
+func newMinifier() *minify.M {
+	m := minify.New()
+	m.Add("text/html", &html.Minifier{
+		// Keep the page structure recognisable; the savings from dropping
+		// these are tiny compared to whitespace and comments.
+		KeepDocumentTags: true,
+		KeepEndTags:      true,
+		KeepQuotes:       true,
+	})
+	m.AddFunc("text/css", css.Minify)
+	m.AddFunc("image/svg+xml", svg.Minify)
+	m.AddFuncRegexp(regexp.MustCompile(`^(application|text)/(x-)?(java|ecma)script$`), js.Minify)
+	m.AddFuncRegexp(regexp.MustCompile(`[/+]json$`), json.Minify)
+	return m
+}
+
+// minifyPage minifies a complete HTML page. Whitespace inside <pre> and
+// <textarea> is preserved.
+func minifyPage(page []byte) ([]byte, error) {
+	return minifier.Bytes("text/html", page)
+}
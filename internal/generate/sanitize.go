@@ -0,0 +1,50 @@
+package generate
+
+import (
+	"regexp"
+
+	"github.com/microcosm-cc/bluemonday"
+)
+
+// alertClass matches the classes june puts on alerts.
+var alertClass = regexp.MustCompile(`^alert(?:-(?:title|icon|note|tip|important|warning|caution))?(?: alert-(?:note|tip|important|warning|caution))?$`)
+
+// mathElements are the MathML elements the math extension writes.
+var mathElements = []string{
+	"math", "semantics", "annotation", "mrow", "mi", "mn", "mo", "mtext", "mspace",
+	"msub", "msup", "msubsup", "munder", "mover", "munderover", "mfrac", "msqrt",
+	"mroot", "mstyle", "mtable", "mtr", "mtd",
+}
+
+// mathValue matches the plain keyword and length values of MathML
+// attributes.
+var mathValue = regexp.MustCompile(`^[a-z0-9.\- ]*$`)
+
+// ugcPolicy is the sanitizer for --ugc mode: bluemonday's policy for user
+// generated content, plus the markup june's own extensions produce.
+func ugcPolicy() *bluemonday.Policy {
+	p := bluemonday.UGCPolicy()
+
+	// Alerts, with their icons.
+	p.AllowAttrs("class").Matching(alertClass).OnElements("div", "p", "svg")
+	p.AllowAttrs("role").Matching(regexp.MustCompile(`^note$`)).OnElements("div")
+	p.AllowElements("svg", "path", "circle")
+	p.AllowAttrs("viewbox", "width", "height", "aria-hidden", "fill", "stroke", "stroke-width", "stroke-linecap", "stroke-linejoin").OnElements("svg")
+	p.AllowAttrs("d").Matching(regexp.MustCompile(`^[MmLlHhVvCcSsQqTtAaZz0-9.,\s-]*$`)).OnElements("path")
+	p.AllowAttrs("cx", "cy", "r").Matching(bluemonday.Number).OnElements("circle")
+
+	// MathML from the math extension. None of these elements or attributes
+	// can carry a URL or script.
+	p.AllowNoAttrs().OnElements(mathElements...)
+	p.AllowAttrs("xmlns").Matching(regexp.MustCompile(`^http://www\.w3\.org/1998/Math/MathML$`)).OnElements("math")
+	p.AllowAttrs("display").Matching(regexp.MustCompile(`^(?:block|inline)$`)).OnElements("math")
+	p.AllowAttrs("encoding").Matching(regexp.MustCompile(`^application/x-tex$`)).OnElements("annotation")
+	p.AllowAttrs(
+		"mathvariant", "stretchy", "fence", "separator", "accent", "accentunder",
+		"linethickness", "columnalign", "columnspacing", "rowspacing", "displaystyle",
+		"scriptlevel", "lspace", "rspace", "width", "largeop", "movablelimits", "form",
+		"minsize", "maxsize",
+	).Matching(mathValue).OnElements(mathElements...)
+
+	return p
+}
@@ -0,0 +1,507 @@
+package generate
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+
+	templatex "github.com/kscarlett/june/internal/template"
+)
+
+// Shortcodes are the html/template snippets that shortcodes like
+// {{< youtube id="…" >}} render with, by name.
+type Shortcodes map[string]*template.Template
+
+// builtinShortcodes are always available, unless a user shortcode of the
+// same name replaces them.
+var builtinShortcodes = map[string]string{
+	"youtube": `<div class="embed embed-video"><iframe src="https://www.youtube-nocookie.com/embed/{{ .Get "id" }}{{ with .Args.start }}?start={{ . }}{{ end }}" title="{{ or .Args.title "YouTube video" }}" allow="accelerometer; clipboard-write; encrypted-media; gyroscope; picture-in-picture" allowfullscreen loading="lazy"></iframe></div>`,
+	"video":   `<video src="{{ .Get "src" }}"{{ with .Args.poster }} poster="{{ . }}"{{ end }} controls preload="metadata">{{ .Content }}</video>`,
+	"figure":  `<figure><img src="{{ .Get "src" }}" alt="{{ .Args.alt }}">{{ with .Content }}<figcaption>{{ . }}</figcaption>{{ else }}{{ with .Args.caption }}<figcaption>{{ . }}</figcaption>{{ end }}{{ end }}</figure>`,
+	"button":  `<a class="button" href="{{ .Get "href" }}">{{ .Content }}</a>`,
+	"details": `<details{{ if eq .Args.open "true" }} open{{ end }}><summary>{{ .Get "summary" }}</summary>{{ .Content }}</details>`,
+}
+
+// LoadShortcodes returns the built-in shortcodes along with the templates in
+// dir, one per .html or .gohtml file named after the shortcode. An empty dir
+// leaves just the built-ins. It also returns the files it read.
+func LoadShortcodes(dir string) (Shortcodes, []string, error) {
+	s := make(Shortcodes, len(builtinShortcodes))
+	for name, src := range builtinShortcodes {
+		s[name] = template.Must(template.New(name).Funcs(templatex.Funcs()).Parse(src))
+	}
+	if dir == "" {
+		return s, nil, nil
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read shortcodes directory %s: %w", dir, err)
+	}
+	files := []string{dir}
+	for _, e := range entries {
+		ext := filepath.Ext(e.Name())
+		if e.IsDir() || ext != ".html" && ext != ".gohtml" {
+			continue
+		}
+		path := filepath.Join(dir, e.Name())
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, files, fmt.Errorf("failed to read shortcode %s: %w", path, err)
+		}
+		files = append(files, path)
+		name := strings.TrimSuffix(e.Name(), ext)
+		t, err := template.New(name).Funcs(templatex.Funcs()).Parse(string(b))
+		if err != nil {
+			return nil, files, fmt.Errorf("failed to parse shortcode %s: %w", path, err)
+		}
+		s[name] = t
+	}
+	return s, files, nil
+}
+
+func (s Shortcodes) names() []string {
+	names := make([]string, 0, len(s))
+	for name := range s {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// shortcodeData is what a shortcode template is executed with.
+type shortcodeData struct {
+	Name string
+	Args map[string]string
+
+	// Inner is the markdown between the opening and closing tags, and
+	// Content the same rendered to HTML.
+	Inner   string
+	Content template.HTML
+
+	// Data is the tree of data files, as in page templates.
+	Data map[string]any
+}
+
+// Get returns a named argument, failing the shortcode if it is missing.
+func (d shortcodeData) Get(name string) (string, error) {
+	v, ok := d.Args[name]
+	if !ok {
+		return "", fmt.Errorf("missing argument %q", name)
+	}
+	return v, nil
+}
+
+var (
+	kindShortcode       = ast.NewNodeKind("Shortcode")
+	kindInlineShortcode = ast.NewNodeKind("InlineShortcode")
+)
+
+// shortcodeCall is a use of a shortcode in the document.
+type shortcodeCall struct {
+	Name  string
+	Args  map[string]string
+	Inner string
+
+	offset      int // Of the opening tag, for errors.
+	innerOffset int
+}
+
+// shortcode is a shortcode on a line of its own. Its inner markdown is
+// parsed into its children.
+type shortcode struct {
+	ast.BaseBlock
+	shortcodeCall
+
+	// paired is set for an opening tag that isn't self-closing, which takes
+	// the blocks up to its closing tag as children. closed is set once that
+	// tag is found.
+	paired, closed bool
+}
+
+func (s *shortcode) Kind() ast.NodeKind { return kindShortcode }
+
+func (s *shortcode) Dump(source []byte, level int) {
+	ast.DumpHelper(s, source, level, map[string]string{"Name": s.Name}, nil)
+}
+
+// inlineShortcode is a shortcode inside a paragraph. Its inner markdown is
+// rendered on its own.
+type inlineShortcode struct {
+	ast.BaseInline
+	shortcodeCall
+}
+
+func (s *inlineShortcode) Kind() ast.NodeKind { return kindInlineShortcode }
+
+func (s *inlineShortcode) Dump(source []byte, level int) {
+	ast.DumpHelper(s, source, level, map[string]string{"Name": s.Name, "Inner": s.Inner}, nil)
+}
+
+// shortcodeTag matches an opening, closing or self-closing tag:
+//
+//	{{< name key="value" key2=value >}}
+//	{{< /name >}}
+//	{{< name key=value />}}
+var shortcodeTag = regexp.MustCompile(`^\{\{<(.*?)>\}\}`)
+
+var (
+	shortcodeName = regexp.MustCompile(`^[A-Za-z][\w-]*$`)
+	shortcodeArg  = regexp.MustCompile(`^([A-Za-z_][\w-]*)=("[^"]*"|'[^']*'|[^\s"']+)$`)
+)
+
+// tag is a parsed shortcode tag.
+type tag struct {
+	Name    string
+	Args    map[string]string
+	Closing bool
+	Self    bool
+	Len     int
+}
+
+// parseTag parses the shortcode tag at the start of b. ok is false if b
+// doesn't start with a tag at all; err is set for a malformed one.
+func parseTag(b []byte) (t tag, ok bool, err error) {
+	m := shortcodeTag.FindSubmatch(b)
+	if m == nil {
+		return tag{}, false, nil
+	}
+	t.Len = len(m[0])
+	body := strings.TrimSpace(string(m[1]))
+	if rest, found := strings.CutPrefix(body, "/"); found {
+		t.Closing = true
+		body = strings.TrimSpace(rest)
+	}
+	if rest, found := strings.CutSuffix(body, "/"); found && !t.Closing {
+		t.Self = true
+		body = strings.TrimSpace(rest)
+	}
+	fields := splitArgs(body)
+	if len(fields) == 0 || !shortcodeName.MatchString(fields[0]) {
+		return t, true, fmt.Errorf("shortcode tag %s has no valid name", m[0])
+	}
+	t.Name = fields[0]
+	for _, field := range fields[1:] {
+		a := shortcodeArg.FindStringSubmatch(field)
+		if a == nil {
+			return t, true, fmt.Errorf("shortcode %q: argument %s must be written as name=value", t.Name, field)
+		}
+		if t.Args == nil {
+			t.Args = make(map[string]string)
+		}
+		t.Args[a[1]] = strings.Trim(a[2], `"'`)
+	}
+	if t.Closing && len(t.Args) > 0 {
+		return t, true, fmt.Errorf("closing shortcode %q can't take arguments", t.Name)
+	}
+	return t, true, nil
+}
+
+// splitArgs splits arguments at spaces outside quotes.
+func splitArgs(s string) []string {
+	var args []string
+	var cur strings.Builder
+	var quote rune
+	for _, r := range s {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == ' ' || r == '\t':
+			if cur.Len() > 0 {
+				args = append(args, cur.String())
+				cur.Reset()
+			}
+			continue
+		}
+		cur.WriteRune(r)
+	}
+	if cur.Len() > 0 {
+		args = append(args, cur.String())
+	}
+	return args
+}
+
+// shortcodeExtension renders shortcodes with templates. It is added to a
+// goldmark instance after it is built, since rendering inner content needs
+// the instance itself.
+type shortcodeExtension struct {
+	Shortcodes Shortcodes
+	Data       map[string]any
+}
+
+func (e shortcodeExtension) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(
+		parser.WithBlockParsers(util.Prioritized(shortcodeBlockParser{e.Shortcodes}, 150)),
+		parser.WithInlineParsers(util.Prioritized(shortcodeInlineParser{e.Shortcodes}, 150)),
+	)
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(util.Prioritized(&shortcodeRenderer{shortcodes: e.Shortcodes, data: e.Data, md: m}, 500)))
+}
+
+// check returns what is wrong with a tag that opens a shortcode: a syntax
+// error, an unknown name or a closing tag without an opening one.
+func (s Shortcodes) check(t tag, err error) error {
+	if err != nil {
+		return err
+	}
+	if t.Closing {
+		return fmt.Errorf("closing shortcode {{< /%s >}} without an opening one", t.Name)
+	}
+	if _, ok := s[t.Name]; !ok {
+		return fmt.Errorf("unknown shortcode %q, expected one of %s", t.Name, strings.Join(s.names(), ", "))
+	}
+	return nil
+}
+
+// shortcodeBlockParser parses a shortcode on a line of its own. If a
+// closing tag follows on a later line of its own, the markdown in between is
+// its inner content. Bad tags are left to shortcodeInlineParser to report.
+type shortcodeBlockParser struct {
+	shortcodes Shortcodes
+}
+
+func (shortcodeBlockParser) Trigger() []byte { return []byte{'{'} }
+
+func (p shortcodeBlockParser) Open(parent ast.Node, reader text.Reader, pc parser.Context) (ast.Node, parser.State) {
+	line, seg := reader.PeekLine()
+	pos := pc.BlockOffset()
+	if pos < 0 {
+		return nil, parser.NoChildren
+	}
+	rest := line[pos:]
+	t, ok, err := parseTag(rest)
+	if !ok || len(util.TrimRightSpace(rest[t.Len:])) > 0 || p.shortcodes.check(t, err) != nil {
+		return nil, parser.NoChildren
+	}
+
+	node := &shortcode{shortcodeCall: shortcodeCall{Name: t.Name, Args: t.Args, offset: seg.Start + pos, innerOffset: seg.Stop}}
+	reader.AdvanceToEOL()
+	if t.Self {
+		return node, parser.NoChildren
+	}
+	node.paired = true
+	return node, parser.HasChildren
+}
+
+func (p shortcodeBlockParser) Continue(node ast.Node, reader text.Reader, pc parser.Context) parser.State {
+	s := node.(*shortcode)
+	if !s.paired {
+		return parser.Close
+	}
+	line, seg := reader.PeekLine()
+	if closesShortcode(line, s.Name) && !innerOpen(s, pc) {
+		s.closed = true
+		s.Inner = string(reader.Source()[s.innerOffset : seg.Start-seg.Padding])
+		reader.AdvanceToEOL()
+		return parser.Close
+	}
+	return parser.Continue | parser.HasChildren
+}
+
+// Close ends a shortcode. One that never found its closing tag has no inner
+// content, so the blocks parsed into it move out to follow it.
+func (shortcodeBlockParser) Close(node ast.Node, reader text.Reader, pc parser.Context) {
+	s := node.(*shortcode)
+	if !s.paired || s.closed {
+		return
+	}
+	parent := s.Parent()
+	for c := s.LastChild(); c != nil; c = s.LastChild() {
+		s.RemoveChild(s, c)
+		parent.InsertAfter(parent, s, c)
+	}
+}
+
+// closesShortcode reports whether line is a closing tag for name on a line
+// of its own.
+func closesShortcode(line []byte, name string) bool {
+	line = util.TrimLeftSpace(line)
+	t, ok, err := parseTag(line)
+	return ok && err == nil && t.Closing && t.Name == name && len(util.TrimRightSpace(line[t.Len:])) == 0
+}
+
+// innerOpen reports whether a block inside s is still open that a closing
+// tag for s belongs to instead: a code block, which keeps the tag as text,
+// or a shortcode of the same name.
+func innerOpen(s *shortcode, pc parser.Context) bool {
+	blocks := pc.OpenedBlocks()
+	inside := false
+	for _, b := range blocks {
+		if b.Node == s {
+			inside = true
+			continue
+		}
+		if !inside {
+			continue
+		}
+		if b.Node.IsRaw() {
+			return true
+		}
+		if inner, ok := b.Node.(*shortcode); ok && inner.paired && inner.Name == s.Name {
+			return true
+		}
+	}
+	return false
+}
+
+func (shortcodeBlockParser) CanInterruptParagraph() bool { return true }
+
+func (shortcodeBlockParser) CanAcceptIndentedLine() bool { return false }
+
+// shortcodeInlineParser parses shortcodes inside a paragraph. A closing tag
+// later in the same paragraph ends its inner content.
+type shortcodeInlineParser struct {
+	shortcodes Shortcodes
+}
+
+func (shortcodeInlineParser) Trigger() []byte { return []byte{'{'} }
+
+func (p shortcodeInlineParser) Parse(parent ast.Node, block text.Reader, pc parser.Context) ast.Node {
+	line, seg := block.PeekLine()
+	t, ok, err := parseTag(line)
+	if !ok {
+		return nil
+	}
+	block.Advance(t.Len)
+	if err := p.shortcodes.check(t, err); err != nil {
+		addSourceError(pc, &sourceError{Offset: seg.Start, Msg: err.Error(), Err: err})
+		return ast.NewTextSegment(seg.WithStop(seg.Start + t.Len))
+	}
+	node := &inlineShortcode{shortcodeCall: shortcodeCall{Name: t.Name, Args: t.Args, offset: seg.Start}}
+	if t.Self {
+		return node
+	}
+
+	// Look for the closing tag in the rest of the paragraph.
+	l, pos := block.Position()
+	var inner []byte
+	for {
+		line, lineSeg := block.PeekLine()
+		if line == nil {
+			block.SetPosition(l, pos)
+			return node
+		}
+		if inner == nil {
+			node.innerOffset = lineSeg.Start
+		}
+		for i := 0; i < len(line); i++ {
+			if line[i] != '{' {
+				continue
+			}
+			if c, ok, _ := parseTag(line[i:]); ok && c.Closing && c.Name == t.Name {
+				node.Inner = string(append(inner, line[:i]...))
+				block.Advance(i + c.Len)
+				return node
+			}
+		}
+		inner = append(inner, line...)
+		block.AdvanceLine()
+	}
+}
+
+// shortcodeRenderer executes the shortcode templates.
+type shortcodeRenderer struct {
+	shortcodes Shortcodes
+	data       map[string]any
+	md         goldmark.Markdown
+}
+
+func (r *shortcodeRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(kindShortcode, r.renderBlock)
+	reg.Register(kindInlineShortcode, r.renderInline)
+}
+
+func (r *shortcodeRenderer) renderBlock(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+	s := node.(*shortcode)
+	var content bytes.Buffer
+	for c := s.FirstChild(); c != nil; c = c.NextSibling() {
+		if err := r.md.Renderer().Render(&content, source, c); err != nil {
+			return ast.WalkStop, err
+		}
+	}
+	out, err := r.execute(s.shortcodeCall, content.Bytes())
+	if err != nil {
+		return ast.WalkStop, err
+	}
+	_, _ = w.Write(out)
+	if !bytes.HasSuffix(out, newline) {
+		_ = w.WriteByte('\n')
+	}
+	return ast.WalkSkipChildren, nil
+}
+
+func (r *shortcodeRenderer) renderInline(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+	s := node.(*inlineShortcode)
+
+	// The inner markdown is parsed on its own, with problems in it located
+	// relative to where it starts.
+	ctx := parser.NewContext()
+	inner := []byte(s.Inner)
+	doc := r.md.Parser().Parse(text.NewReader(inner), parser.WithContext(ctx))
+	if errs := sourceErrors(ctx); len(errs) > 0 {
+		e := *errs[0]
+		e.Offset += s.innerOffset
+		return ast.WalkStop, &e
+	}
+	var content bytes.Buffer
+	if err := r.md.Renderer().Render(&content, inner, doc); err != nil {
+		return ast.WalkStop, err
+	}
+	// Inline content isn't a paragraph of its own.
+	b := bytes.TrimSpace(content.Bytes())
+	if bytes.HasPrefix(b, []byte("<p>")) && bytes.HasSuffix(b, []byte("</p>")) && bytes.Count(b, []byte("<p>")) == 1 {
+		b = b[len("<p>") : len(b)-len("</p>")]
+	}
+
+	out, err := r.execute(s.shortcodeCall, b)
+	if err != nil {
+		return ast.WalkStop, err
+	}
+	_, _ = w.Write(out)
+	return ast.WalkSkipChildren, nil
+}
+
+func (r *shortcodeRenderer) execute(call shortcodeCall, content []byte) ([]byte, error) {
+	data := shortcodeData{Name: call.Name, Args: call.Args, Inner: call.Inner, Content: template.HTML(content), Data: r.data}
+	if data.Args == nil {
+		data.Args = map[string]string{}
+	}
+	var out bytes.Buffer
+	if err := r.shortcodes[call.Name].Execute(&out, data); err != nil {
+		return nil, &sourceError{Offset: call.offset, Msg: fmt.Sprintf("shortcode %q: %v", call.Name, unwrapExecError(err)), Err: err}
+	}
+	return out.Bytes(), nil
+}
+
+// unwrapExecError drops the template position prefix from errors returned
+// by .Get, which already say what went wrong.
+func unwrapExecError(err error) error {
+	for e := err; e != nil; e = errors.Unwrap(e) {
+		if strings.HasPrefix(e.Error(), "missing argument") {
+			return e
+		}
+	}
+	return err
+}
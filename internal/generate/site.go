@@ -0,0 +1,263 @@
+package generate
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SiteConfig describes a build of every markdown page in a directory.
+type SiteConfig struct {
+	// Page holds the options every page is built with. Its Input and Output
+	// are set for each page, and its Shortcodes and Data default to
+	// shortcodes/ and data/ in Input when they exist, so pages in
+	// subdirectories share them.
+	Page GenerateConfig
+
+	Input  string // Directory of markdown pages.
+	Output string // Directory the site is written to.
+
+	// BaseURL is the absolute URL the site is served from, like
+	// https://example.com/blog/. Pages without a "url" frontmatter field
+	// get theirs from it, and feeds need it.
+	BaseURL string
+
+	// Title and Description describe the site in feeds. They default to
+	// those of the top-level index page.
+	Title       string
+	Description string
+
+	Feeds FeedConfig
+
+	// TagPages writes a page for every tag, listing the pages with it, and
+	// an index of the tags. Pages link their tags to them.
+	TagPages bool
+
+	// Sitemap writes sitemap.xml. As sitemaps need absolute URLs, it is
+	// only written with a base URL; without one, a warning is printed.
+	Sitemap bool
+	Robots  RobotsConfig
+}
+
+// siteDirs are the directories of a site's input that hold something other
+// than pages.
+var siteDirs = map[string]bool{
+	"static":     true,
+	"data":       true,
+	"shortcodes": true,
+	"templates":  true,
+}
+
+// sitePage is a page's place in the site.
+type sitePage struct {
+	Input  string // Markdown file.
+	Output string // HTML file.
+	Path   string // URL path relative to the site root, like "blog/post.html".
+
+	// URL is the page's address: absolute with a base URL, or
+	// site-absolute like "/blog/post.html" without one.
+	URL string
+
+	// tagURL links to a tag's page from this page. It is nil when the site
+	// has no tag pages.
+	tagURL func(slug string) string
+}
+
+// builtPage is a page after it has been built.
+type builtPage struct {
+	*sitePage
+	Meta    PageMeta
+	Content []byte
+
+	// Modified is when a page without a markdown file, like a tag page,
+	// last changed. It is zero if that isn't known.
+	Modified time.Time
+}
+
+// link is the address the page is listed with: its canonical URL.
+func (p builtPage) link() string {
+	if p.Meta.URL != "" {
+		return p.Meta.URL
+	}
+	return p.URL
+}
+
+// listed reports whether the page belongs in sitemaps and feeds, which
+// drafts and noindex pages don't.
+func (p builtPage) listed() bool {
+	return !p.Meta.Draft && !p.Meta.NoIndex
+}
+
+// BuildSite generates a page for every markdown file in cfg.Input, along
+// with the site's tag pages, feeds, sitemap and robots.txt. Files and
+// directories starting with "." or "_" are skipped, so "_snippets/" can
+// hold files for includes, as are static/, data/, shortcodes/ and
+// templates/ at the top level. A page at blog/post.md is written to
+// blog/post.html, and blog/index.md to blog/index.html, linked as blog/.
+func BuildSite(cfg SiteConfig) (Result, error) {
+	var res Result
+	if cfg.BaseURL != "" {
+		u, err := url.Parse(cfg.BaseURL)
+		if err != nil || !u.IsAbs() || u.Host == "" {
+			return res, fmt.Errorf("base URL %q is not an absolute URL like https://example.com/", cfg.BaseURL)
+		}
+		if !strings.HasSuffix(u.Path, "/") {
+			u.Path += "/"
+		}
+		cfg.BaseURL = u.String()
+	}
+
+	pageCfg := cfg.Page
+	for dir, field := range map[string]*string{"shortcodes": &pageCfg.Shortcodes, "data": &pageCfg.Data} {
+		if *field != "" {
+			continue
+		}
+		if info, err := os.Stat(filepath.Join(cfg.Input, dir)); err == nil && info.IsDir() {
+			*field = filepath.Join(cfg.Input, dir)
+		}
+	}
+
+	pages, err := findPages(cfg)
+	if err != nil {
+		return res, err
+	}
+	if err := os.MkdirAll(cfg.Output, 0755); err != nil {
+		return res, fmt.Errorf("failed to create output directory %s: %w", cfg.Output, err)
+	}
+	if err := copyStatic(cfg.Page.Static, cfg.Input, cfg.Output); err != nil {
+		return res, err
+	}
+
+	var built []builtPage
+	var errs []error
+	for _, p := range pages {
+		c := pageCfg
+		c.Input, c.Output = p.Input, p.Output
+		if err := os.MkdirAll(filepath.Dir(p.Output), 0755); err != nil {
+			return res, fmt.Errorf("failed to create output directory %s: %w", filepath.Dir(p.Output), err)
+		}
+		pageRes := Result{Sources: []string{p.Input}}
+		err := build(c, p, &pageRes)
+		res.Sources = append(res.Sources, pageRes.Sources...)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		built = append(built, builtPage{sitePage: p, Meta: pageRes.Meta, Content: pageRes.Content})
+	}
+	if len(errs) > 0 {
+		return res, errors.Join(errs...)
+	}
+
+	for _, p := range built {
+		if p.Path != "" {
+			continue
+		}
+		if cfg.Title == "" {
+			cfg.Title = p.Meta.Title
+		}
+		if cfg.Description == "" {
+			cfg.Description = p.Meta.Desc
+		}
+	}
+	if err := writeFeeds(cfg, built); err != nil {
+		return res, err
+	}
+	listings := built
+	if cfg.TagPages {
+		tagPages, err := writeTagPages(cfg, pageCfg, built, &res)
+		if err != nil {
+			return res, err
+		}
+		listings = append(slices.Clip(built), tagPages...)
+	}
+	var sitemap string
+	switch {
+	case cfg.Sitemap && cfg.BaseURL == "":
+		fmt.Fprintln(os.Stderr, "Warning: sitemap.xml is not written, sitemaps need absolute URLs, set a base URL with --base-url or turn it off with --no-sitemap")
+	case cfg.Sitemap:
+		if err := writeSitemap(cfg, listings); err != nil {
+			return res, err
+		}
+		sitemap = siteURL(cfg, "sitemap.xml")
+	}
+	if cfg.Robots.Enabled {
+		if err := writeRobots(cfg, sitemap); err != nil {
+			return res, err
+		}
+	}
+	return res, nil
+}
+
+// findPages lists the pages of the site, sorted by path.
+func findPages(cfg SiteConfig) ([]*sitePage, error) {
+	var pages []*sitePage
+	err := filepath.WalkDir(cfg.Input, func(file string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if file == cfg.Input {
+			return nil
+		}
+		name := d.Name()
+		skip := strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") ||
+			d.IsDir() && filepath.Dir(file) == filepath.Clean(cfg.Input) && siteDirs[name]
+		if skip && d.IsDir() {
+			return filepath.SkipDir
+		}
+		if skip || d.IsDir() || filepath.Ext(name) != ".md" {
+			return nil
+		}
+
+		rel, err := filepath.Rel(cfg.Input, file)
+		if err != nil {
+			return err
+		}
+		p := newSitePage(cfg, filepath.ToSlash(rel))
+		p.Input = file
+		pages = append(pages, p)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(pages, func(i, j int) bool { return pages[i].Path < pages[j].Path })
+	return pages, nil
+}
+
+// newSitePage places the page at rel, a slash-separated path relative to
+// the site's input. Outputs mirror the input, so relative links and assets
+// work the same in both.
+func newSitePage(cfg SiteConfig, rel string) *sitePage {
+	out := strings.TrimSuffix(rel, path.Ext(rel)) + ".html"
+	p := &sitePage{Output: filepath.Join(cfg.Output, filepath.FromSlash(out)), Path: out}
+	if path.Base(out) == "index.html" {
+		p.Path = strings.TrimSuffix(out, "index.html")
+	}
+	p.URL = siteURL(cfg, p.Path)
+	if cfg.TagPages {
+		p.tagURL = func(slug string) string {
+			return href(cfg, p.Path, tagPath(slug))
+		}
+	}
+	return p
+}
+
+// siteURL returns the address of a path relative to the site root.
+func siteURL(cfg SiteConfig, rel string) string {
+	escaped := (&url.URL{Path: rel}).EscapedPath()
+	if cfg.BaseURL == "" {
+		return "/" + escaped
+	}
+	if escaped == "" {
+		return cfg.BaseURL
+	}
+	return absoluteURL(cfg.BaseURL, escaped)
+}
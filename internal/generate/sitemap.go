@@ -0,0 +1,123 @@
+package generate
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RobotsConfig controls the robots.txt of a site build.
+type RobotsConfig struct {
+	Enabled bool // Write robots.txt.
+
+	// File is a robots.txt to use instead of generated rules. It defaults
+	// to robots.txt in the static directory, when there is one.
+	File string
+
+	// Disallow lists paths all crawlers are asked to stay out of, like
+	// /drafts/.
+	Disallow []string
+}
+
+// Sitemaps, as described at https://www.sitemaps.org/protocol.html.
+
+type sitemapDoc struct {
+	XMLName xml.Name     `xml:"http://www.sitemaps.org/schemas/sitemap/0.9 urlset"`
+	URLs    []sitemapURL `xml:"url"`
+}
+
+type sitemapURL struct {
+	Loc        string `xml:"loc"`
+	LastMod    string `xml:"lastmod,omitempty"`
+	ChangeFreq string `xml:"changefreq,omitempty"`
+	Priority   string `xml:"priority,omitempty"`
+}
+
+// writeSitemap writes sitemap.xml, listing the pages that aren't drafts or
+// marked noindex. A page was last modified at its date, or else when its
+// markdown file was. Tag pages were last modified with their newest page.
+func writeSitemap(cfg SiteConfig, pages []builtPage) error {
+	doc := &sitemapDoc{}
+	for _, p := range pages {
+		if !p.listed() {
+			continue
+		}
+		u := sitemapURL{Loc: p.link(), ChangeFreq: p.Meta.ChangeFreq}
+		modified := p.Meta.Date
+		if modified.IsZero() {
+			modified = p.Modified
+		}
+		if modified.IsZero() && p.Input != "" {
+			info, err := os.Stat(p.Input)
+			if err != nil {
+				return fmt.Errorf("failed to read %s: %w", p.Input, err)
+			}
+			modified = info.ModTime().UTC().Truncate(time.Second)
+		}
+		if !modified.IsZero() {
+			u.LastMod = modified.Format(time.RFC3339)
+		}
+		if p.Meta.Priority != nil {
+			u.Priority = strconv.FormatFloat(*p.Meta.Priority, 'f', -1, 64)
+		}
+		doc.URLs = append(doc.URLs, u)
+	}
+	return writeXML(filepath.Join(cfg.Output, "sitemap.xml"), doc)
+}
+
+var sitemapLine = regexp.MustCompile(`(?im)^\s*sitemap\s*:`)
+
+// writeRobots writes robots.txt, from cfg.Robots.File or allowing every
+// crawler everywhere but the disallowed paths. sitemap, if not empty, is
+// added to it unless the file already names one.
+func writeRobots(cfg SiteConfig, sitemap string) error {
+	file := cfg.Robots.File
+	if file == "" {
+		if static := staticDir(cfg.Page.Static, cfg.Input); static != "" {
+			if _, err := os.Stat(filepath.Join(static, "robots.txt")); err == nil {
+				file = filepath.Join(static, "robots.txt")
+			}
+		}
+	}
+
+	var b bytes.Buffer
+	if file != "" {
+		rules, err := os.ReadFile(file)
+		if err != nil {
+			return fmt.Errorf("failed to read robots.txt: %w", err)
+		}
+		b.Write(rules)
+		if sitemapLine.Match(rules) {
+			sitemap = ""
+		}
+	} else {
+		b.WriteString("User-agent: *\n")
+		if len(cfg.Robots.Disallow) == 0 {
+			b.WriteString("Disallow:\n")
+		}
+		for _, path := range cfg.Robots.Disallow {
+			if !strings.HasPrefix(path, "/") {
+				path = "/" + path
+			}
+			b.WriteString("Disallow: " + path + "\n")
+		}
+	}
+	if sitemap != "" {
+		if b.Len() > 0 && !bytes.HasSuffix(b.Bytes(), []byte("\n")) {
+			b.WriteByte('\n')
+		}
+		b.WriteString("\nSitemap: " + sitemap + "\n")
+	}
+
+	path := filepath.Join(cfg.Output, "robots.txt")
+	if err := os.WriteFile(path, b.Bytes(), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+package generate
+
+import (
+	"encoding/json"
+	"html"
+	"html/template"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/text/language"
+)
+
+// headMeta renders the Open Graph, Twitter Card and schema.org JSON-LD tags
+// for a page, and a robots tag for drafts and noindex pages. Templates
+// include it as {{ .HeadMeta }} in <head>. The canonical link and og:url
+// are only written for an absolute page URL, as that's all they allow.
+func headMeta(meta PageMeta) template.HTML {
+	image := absoluteURL(meta.URL, meta.Image)
+	if !isAbsoluteURL(meta.URL) {
+		meta.URL = ""
+	}
+	ogType := meta.Type
+	if ogType == "" {
+		ogType = "website"
+		if !meta.Date.IsZero() {
+			ogType = "article"
+		}
+	}
+
+	var b strings.Builder
+	tag := func(attr, key, value string) {
+		if value == "" {
+			return
+		}
+		b.WriteString(`<meta ` + attr + `="` + html.EscapeString(key) + `" content="` + html.EscapeString(value) + "\">\n")
+	}
+
+	if meta.Draft || meta.NoIndex {
+		tag("name", "robots", "noindex")
+	}
+	tag("name", "author", meta.Author)
+	if meta.URL != "" {
+		b.WriteString(`<link rel="canonical" href="` + html.EscapeString(meta.URL) + "\">\n")
+	}
+
+	tag("property", "og:title", meta.Title)
+	tag("property", "og:description", meta.Desc)
+	tag("property", "og:type", ogType)
+	tag("property", "og:url", meta.URL)
+	tag("property", "og:image", image)
+	tag("property", "og:locale", ogLocale(meta.Lang))
+	if ogType == "article" {
+		if !meta.Date.IsZero() {
+			tag("property", "article:published_time", meta.Date.Format(time.RFC3339))
+		}
+		tag("property", "article:author", meta.Author)
+		for _, t := range meta.Tags {
+			tag("property", "article:tag", t)
+		}
+	}
+
+	card := "summary"
+	if image != "" {
+		card = "summary_large_image"
+	}
+	tag("name", "twitter:card", card)
+	tag("name", "twitter:title", meta.Title)
+	tag("name", "twitter:description", meta.Desc)
+	tag("name", "twitter:image", image)
+
+	if ld := jsonLD(meta, ogType, image); ld != "" {
+		b.WriteString(`<script type="application/ld+json">` + ld + "</script>\n")
+	}
+
+	return template.HTML(b.String())
+}
+
+// jsonLD describes the page as a schema.org WebPage, or an Article when it
+// is dated or typed as one.
+func jsonLD(meta PageMeta, ogType, image string) string {
+	ld := map[string]any{
+		"@context": "https://schema.org",
+		"@type":    "WebPage",
+	}
+	if ogType == "article" {
+		ld["@type"] = "Article"
+		if meta.Title != "" {
+			ld["headline"] = meta.Title
+		}
+	} else if meta.Title != "" {
+		ld["name"] = meta.Title
+	}
+	if meta.Desc != "" {
+		ld["description"] = meta.Desc
+	}
+	if meta.URL != "" {
+		ld["url"] = meta.URL
+	}
+	if image != "" {
+		ld["image"] = image
+	}
+	if meta.Lang != "" {
+		ld["inLanguage"] = meta.Lang
+	}
+	if meta.Author != "" {
+		ld["author"] = map[string]string{"@type": "Person", "name": meta.Author}
+	}
+	if !meta.Date.IsZero() {
+		ld["datePublished"] = meta.Date.Format(time.RFC3339)
+	}
+	if len(meta.Tags) > 0 {
+		ld["keywords"] = strings.Join(meta.Tags, ", ")
+	}
+
+	// json.Marshal escapes <, > and &, so the output can't close the
+	// surrounding script element.
+	b, err := json.Marshal(ld)
+	if err != nil {
+		return ""
+	}
+	return string(b)
+}
+
+// isAbsoluteURL reports whether s is a full URL with a scheme and host.
+func isAbsoluteURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && u.IsAbs() && u.Host != ""
+}
+
+// absoluteURL resolves ref against the page URL, as social networks need
+// absolute image URLs. It returns ref unchanged if that's not possible.
+func absoluteURL(base, ref string) string {
+	if ref == "" || base == "" {
+		return ref
+	}
+	b, err := url.Parse(base)
+	if err != nil {
+		return ref
+	}
+	r, err := url.Parse(ref)
+	if err != nil {
+		return ref
+	}
+	return b.ResolveReference(r).String()
+}
+
+// ogLocale converts a BCP 47 language tag like "en-GB" into the language_REGION
+// form Open Graph uses, "en_GB". Scripts and other subtags are dropped.
+func ogLocale(lang string) string {
+	tag, err := language.Parse(lang)
+	if err != nil {
+		return strings.ReplaceAll(lang, "-", "_")
+	}
+	base, _ := tag.Base()
+	if region, conf := tag.Region(); conf == language.Exact {
+		return base.String() + "_" + region.String()
+	}
+	return base.String()
+}
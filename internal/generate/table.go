@@ -0,0 +1,414 @@
+package generate
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/kscarlett/june/internal/diag"
+)
+
+// tableDirective matches a table made from a data file, on a line of its
+// own:
+//
+//	{{#table data/pricing.csv}}
+//	{{#table releases.json columns=version,date sort=-date headers="version:Release"}}
+var tableDirective = regexp.MustCompile(`^ {0,3}\{\{#table\s+(.*?)\s*\}\}\s*$`)
+
+// tableOptions are the arguments of a table directive.
+type tableOptions struct {
+	File    string
+	Columns []string          // Columns to show, in order. All by default.
+	Headers map[string]string // Header text by column.
+	Sort    string            // Column to sort by, "-" first for descending.
+	Format  map[string]string // Number format by column.
+	Align   map[string]string // left, center or right by column.
+}
+
+// parseTableOptions parses the arguments after "{{#table".
+func parseTableOptions(s string) (tableOptions, error) {
+	fields := splitArgs(s)
+	if len(fields) == 0 {
+		return tableOptions{}, fmt.Errorf("table needs a file, like {{#table data/pricing.csv}}")
+	}
+	opts := tableOptions{File: strings.Trim(fields[0], `"'`)}
+	for _, field := range fields[1:] {
+		a := shortcodeArg.FindStringSubmatch(field)
+		if a == nil {
+			return opts, fmt.Errorf("table argument %s must be written as name=value", field)
+		}
+		v := strings.Trim(a[2], `"'`)
+		var err error
+		switch a[1] {
+		case "columns":
+			opts.Columns = splitList(v)
+		case "headers":
+			opts.Headers, err = splitPairs(a[1], v)
+		case "sort":
+			opts.Sort = v
+		case "format":
+			opts.Format, err = splitPairs(a[1], v)
+		case "align":
+			opts.Align, err = splitPairs(a[1], v)
+		default:
+			return opts, fmt.Errorf("unknown table argument %q, expected one of columns, headers, sort, format, align", a[1])
+		}
+		if err != nil {
+			return opts, err
+		}
+	}
+	for col, align := range opts.Align {
+		if align != "left" && align != "center" && align != "right" {
+			return opts, fmt.Errorf("align=%s:%s must be left, center or right", col, align)
+		}
+	}
+	for col, format := range opts.Format {
+		if _, _, err := parseNumberFormat(format); err != nil {
+			return opts, fmt.Errorf("format=%s:%s %v", col, format, err)
+		}
+	}
+	return opts, nil
+}
+
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// splitPairs parses "a:x,b:y" into a map.
+func splitPairs(name, s string) (map[string]string, error) {
+	pairs := make(map[string]string)
+	for _, item := range splitList(s) {
+		k, v, ok := strings.Cut(item, ":")
+		if !ok {
+			return nil, fmt.Errorf("%s=%s needs column:value pairs, like %s=price:right", name, s, name)
+		}
+		pairs[strings.TrimSpace(k)] = strings.TrimSpace(v)
+	}
+	return pairs, nil
+}
+
+// table writes the markdown table for the directive at offset off of src.
+func (in *includer) table(file string, src []byte, off int, args string) error {
+	fail := func(format string, args ...any) error {
+		return diag.AtOffset(file, src, off, fmt.Sprintf(format, args...), nil)
+	}
+	opts, err := parseTableOptions(args)
+	if err != nil {
+		return fail("%v", err)
+	}
+
+	path := filepath.Join(filepath.Dir(file), filepath.FromSlash(opts.File))
+	b, err := in.read(path)
+	if err != nil {
+		return diag.AtOffset(file, src, off, fmt.Sprintf("failed to read table %s: %v", opts.File, err), err)
+	}
+	var header []string
+	var rows [][]string
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		header, rows, err = readCSVRecords(path, b, false)
+	case ".tsv":
+		header, rows, err = readCSVRecords(path, b, true)
+	case ".json":
+		header, rows, err = readJSONTable(b)
+		if err != nil {
+			err = fmt.Errorf("invalid JSON table %s: %w", opts.File, err)
+		}
+	default:
+		return fail("tables can be made from .csv, .tsv or .json files, not %s", opts.File)
+	}
+	// Errors in the data file are reported at the directive, so the page
+	// using it is named, with the line in the data file in the message.
+	var located *diag.Error
+	if errors.As(err, &located) {
+		return diag.AtOffset(file, src, off, fmt.Sprintf("table %s, line %d: %s", opts.File, located.Line, located.Msg), err)
+	} else if err != nil {
+		return diag.AtOffset(file, src, off, err.Error(), err)
+	}
+	switch {
+	case len(header) == 0 && len(rows) == 0:
+		return fail("table %s is empty", opts.File)
+	case len(header) == 0:
+		return fail("table %s has no columns", opts.File)
+	case len(rows) == 0:
+		return fail("table %s has a header but no rows", opts.File)
+	}
+
+	index := make(map[string]int, len(header))
+	for i, name := range header {
+		if name == "" {
+			return fail("column %d of table %s has no name", i+1, opts.File)
+		}
+		if _, ok := index[name]; ok {
+			return fail("table %s has two columns named %q", opts.File, name)
+		}
+		index[name] = i
+	}
+	check := func(arg, col string) error {
+		if _, ok := index[col]; !ok {
+			return fail("%s: %s has no column %q, expected one of %s", arg, opts.File, col, strings.Join(header, ", "))
+		}
+		return nil
+	}
+	columns := opts.Columns
+	if columns == nil {
+		columns = header
+	}
+	for _, col := range columns {
+		if err := check("columns", col); err != nil {
+			return err
+		}
+	}
+	for _, m := range []struct {
+		arg   string
+		pairs map[string]string
+	}{{"headers", opts.Headers}, {"format", opts.Format}, {"align", opts.Align}} {
+		for _, col := range sortedKeys(m.pairs) {
+			if err := check(m.arg, col); err != nil {
+				return err
+			}
+		}
+	}
+	if opts.Sort != "" {
+		col, desc := strings.CutPrefix(opts.Sort, "-")
+		if err := check("sort", col); err != nil {
+			return err
+		}
+		sortRows(rows, index[col], desc)
+	}
+
+	var md strings.Builder
+	row := func(cells []string) {
+		md.WriteString("|")
+		for _, c := range cells {
+			md.WriteString(" " + c + " |")
+		}
+		md.WriteString("\n")
+	}
+	cells := make([]string, len(columns))
+	for i, col := range columns {
+		name := col
+		if h, ok := opts.Headers[col]; ok {
+			name = h
+		}
+		cells[i] = escapeCell(name)
+	}
+	row(cells)
+	for i, col := range columns {
+		switch opts.Align[col] {
+		case "left":
+			cells[i] = ":---"
+		case "center":
+			cells[i] = ":---:"
+		case "right":
+			cells[i] = "---:"
+		default:
+			cells[i] = "---"
+		}
+	}
+	row(cells)
+	for _, r := range rows {
+		for i, col := range columns {
+			v := r[index[col]]
+			if f, ok := opts.Format[col]; ok {
+				v = formatNumber(f, v)
+			}
+			cells[i] = escapeCell(v)
+		}
+		row(cells)
+	}
+
+	// Blank lines keep the table from joining a paragraph next to it.
+	if len(in.out) > 0 && !bytes.HasSuffix(in.out, []byte("\n\n")) {
+		in.out = append(in.out, '\n')
+	}
+	in.out = append(in.out, md.String()+"\n"...)
+	return nil
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// readJSONTable reads a JSON array of objects. The columns are the objects'
+// keys, in the order they first appear.
+func readJSONTable(b []byte) ([]string, [][]string, error) {
+	var items []json.RawMessage
+	if err := json.Unmarshal(b, &items); err != nil {
+		return nil, nil, fmt.Errorf("expected an array of objects: %w", err)
+	}
+	var header []string
+	index := make(map[string]int)
+	var objects []map[string]json.RawMessage
+	for i, item := range items {
+		dec := json.NewDecoder(bytes.NewReader(item))
+		if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+			return nil, nil, fmt.Errorf("item %d is not an object", i+1)
+		}
+		obj := make(map[string]json.RawMessage)
+		for dec.More() {
+			tok, err := dec.Token()
+			if err != nil {
+				return nil, nil, err
+			}
+			key := tok.(string)
+			var v json.RawMessage
+			if err := dec.Decode(&v); err != nil {
+				return nil, nil, err
+			}
+			if _, ok := index[key]; !ok {
+				index[key] = len(header)
+				header = append(header, key)
+			}
+			obj[key] = v
+		}
+		objects = append(objects, obj)
+	}
+
+	rows := make([][]string, len(objects))
+	for i, obj := range objects {
+		rows[i] = make([]string, len(header))
+		for key, v := range obj {
+			rows[i][index[key]] = jsonCell(v)
+		}
+	}
+	return header, rows, nil
+}
+
+// jsonCell turns a JSON value into cell text. Strings lose their quotes and
+// null is empty; arrays and objects are kept as compact JSON.
+func jsonCell(v json.RawMessage) string {
+	var s string
+	if json.Unmarshal(v, &s) == nil {
+		return s
+	}
+	if string(v) == "null" {
+		return ""
+	}
+	var buf bytes.Buffer
+	if json.Compact(&buf, v) == nil {
+		return buf.String()
+	}
+	return string(v)
+}
+
+// sortRows sorts rows by column col. Columns holding only numbers sort
+// numerically, others as text; empty cells go last either way.
+func sortRows(rows [][]string, col int, desc bool) {
+	numeric := true
+	for _, r := range rows {
+		if v := strings.TrimSpace(r[col]); v != "" {
+			if _, err := strconv.ParseFloat(v, 64); err != nil {
+				numeric = false
+				break
+			}
+		}
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		a, b := strings.TrimSpace(rows[i][col]), strings.TrimSpace(rows[j][col])
+		if a == "" || b == "" {
+			return a != "" && b == ""
+		}
+		var less, greater bool
+		if numeric {
+			x, _ := strconv.ParseFloat(a, 64)
+			y, _ := strconv.ParseFloat(b, 64)
+			less, greater = x < y, x > y
+		} else {
+			less, greater = a < b, a > b
+		}
+		if desc {
+			return greater
+		}
+		return less
+	})
+}
+
+var numberVerb = regexp.MustCompile(`%([-+# 0']*)(\d*)(?:\.(\d+))?([dfegxXob])`)
+
+// parseNumberFormat checks a printf-style number format with a single verb,
+// returning it with the ' flag removed and whether digits should be grouped.
+func parseNumberFormat(format string) (string, bool, error) {
+	locs := numberVerb.FindAllStringSubmatchIndex(format, -1)
+	if len(locs) != 1 || strings.Count(strings.ReplaceAll(format, "%%", ""), "%") != 1 {
+		return "", false, fmt.Errorf("needs a single number verb, like %%.2f or %%'d")
+	}
+	m := locs[0]
+	flags := format[m[2]:m[3]]
+	group := strings.Contains(flags, "'")
+	format = format[:m[2]] + strings.ReplaceAll(flags, "'", "") + format[m[3]:]
+	return format, group, nil
+}
+
+// formatNumber formats a cell holding a number with a printf-style format.
+// The ' flag groups thousands with commas: %'.2f gives 1,234.50. Cells that
+// aren't numbers are left as they are.
+func formatNumber(format, v string) string {
+	f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+	if err != nil {
+		return v
+	}
+	format, group, _ := parseNumberFormat(format)
+	var out string
+	if verb := numberVerb.FindStringSubmatch(format)[4]; strings.Contains("dxXob", verb) {
+		n, _ := strconv.ParseInt(strconv.FormatFloat(f, 'f', 0, 64), 10, 64)
+		out = fmt.Sprintf(format, n)
+	} else {
+		out = fmt.Sprintf(format, f)
+	}
+	if group {
+		out = groupDigits(out)
+	}
+	return out
+}
+
+var digitRun = regexp.MustCompile(`\d+`)
+
+// groupDigits puts commas between the thousands of the first run of digits,
+// which is the integer part of the number.
+func groupDigits(s string) string {
+	loc := digitRun.FindStringIndex(s)
+	if loc == nil {
+		return s
+	}
+	digits := s[loc[0]:loc[1]]
+	var b strings.Builder
+	for i, r := range digits {
+		if i > 0 && (len(digits)-i)%3 == 0 {
+			b.WriteByte(',')
+		}
+		b.WriteRune(r)
+	}
+	return s[:loc[0]] + b.String() + s[loc[1]:]
+}
+
+// escapeCell escapes text for a markdown table cell, so it shows as written
+// rather than being read as markdown.
+func escapeCell(s string) string {
+	s = strings.Join(strings.Fields(s), " ")
+	var b strings.Builder
+	for _, r := range s {
+		if r < 0x80 && strings.ContainsRune("!\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~", r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
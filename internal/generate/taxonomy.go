@@ -0,0 +1,244 @@
+package generate
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/kscarlett/june/internal/diag"
+	templatex "github.com/kscarlett/june/internal/template"
+)
+
+// Tag is a page tag as templates see it. It prints as its name, so
+// {{ join ", " .Tags }} keeps working as it did on plain strings.
+type Tag struct {
+	Name string
+	Slug string // The name slugified, as used in the tag's URL.
+	URL  string // The tag's page, empty outside site builds.
+
+	// Count and Pages are the pages with the tag, newest first. They are
+	// only set on tag pages and the tag index.
+	Count int
+	Pages []TaggedPage
+}
+
+func (t Tag) String() string {
+	return t.Name
+}
+
+// TaggedPage is a page listed on a tag page.
+type TaggedPage struct {
+	Title string
+	Desc  string
+	Date  time.Time
+	URL   string
+}
+
+// tagsDir is where tag pages are written, relative to the site root.
+const tagsDir = "tags/"
+
+// tagPath is the path of a tag's page, relative to the site root.
+func tagPath(slug string) string {
+	return tagsDir + slug + "/"
+}
+
+// pageTags turns a page's tags into links to their tag pages. Outside site
+// builds, or without tag pages, the tags have no URL.
+func pageTags(tags []string, site *sitePage) []Tag {
+	if tags == nil {
+		return nil
+	}
+	out := make([]Tag, len(tags))
+	for i, name := range tags {
+		out[i] = Tag{Name: name, Slug: templatex.Slugify(name)}
+		if site != nil && site.tagURL != nil && out[i].Slug != "" {
+			out[i].URL = site.tagURL(out[i].Slug)
+		}
+	}
+	return out
+}
+
+// tagListings are the bodies of the tag pages, shown through the template's
+// base when it has no "tag" or "tags" layout.
+var tagListings = template.Must(template.New("").Parse(`
+{{- define "tag" -}}
+<h1>{{ .Tag.Name }}</h1>
+<ul class="tag-pages">
+{{- range .Tag.Pages }}
+<li><a href="{{ .URL }}">{{ or .Title .URL }}</a>{{ if not .Date.IsZero }} <time datetime="{{ .Date.Format "2006-01-02" }}">{{ .Date.Format "2 January 2006" }}</time>{{ end }}</li>
+{{- end }}
+</ul>
+{{ end -}}
+{{- define "tags" -}}
+<h1>{{ .Title }}</h1>
+<ul class="tag-index">
+{{- range .AllTags }}
+<li><a href="{{ .URL }}" rel="tag">{{ .Name }}</a> <span class="count">{{ .Count }}</span></li>
+{{- end }}
+</ul>
+{{ end -}}
+`))
+
+// writeTagPages writes a page listing the pages of every tag, at
+// tags/<slug>/, and an index of the tags at tags/. Drafts and noindex pages
+// aren't listed. It returns the pages it wrote.
+func writeTagPages(cfg SiteConfig, pageCfg GenerateConfig, pages []builtPage, res *Result) ([]builtPage, error) {
+	var tags []*Tag
+	bySlug := make(map[string]*Tag)
+	for _, p := range pages {
+		if !p.listed() {
+			continue
+		}
+		for _, name := range p.Meta.Tags {
+			slug := templatex.Slugify(name)
+			if slug == "" {
+				continue
+			}
+			t, ok := bySlug[slug]
+			if !ok {
+				t = &Tag{Name: name, Slug: slug}
+				bySlug[slug] = t
+				tags = append(tags, t)
+			}
+			// The URL is the page's path until the page is linked from
+			// somewhere.
+			if n := len(t.Pages); n > 0 && t.Pages[n-1].URL == p.Path {
+				// The same tag twice on one page, maybe spelled differently.
+				continue
+			}
+			t.Pages = append(t.Pages, TaggedPage{Title: p.Meta.Title, Desc: p.Meta.Desc, Date: p.Meta.Date, URL: p.Path})
+		}
+	}
+	if len(tags) == 0 {
+		return nil, nil
+	}
+	sort.Slice(tags, func(i, j int) bool { return tags[i].Slug < tags[j].Slug })
+
+	outputs := make(map[string]string, len(pages))
+	for _, p := range pages {
+		outputs[p.Output] = p.Input
+	}
+
+	var located *diag.Error
+	tmpl, err := templatex.LoadTemplate(pageCfg.Template)
+	if tmpl != nil {
+		res.Sources = append(res.Sources, tmpl.Files...)
+	}
+	if errors.As(err, &located) {
+		return nil, err
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to load template: %w", err)
+	}
+	style, err := templatex.LoadStylesheet(pageCfg.Style)
+	res.Sources = append(res.Sources, style.Files...)
+	if errors.As(err, &located) {
+		return nil, err
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to load style: %w", err)
+	}
+	data, files, err := LoadData(pageCfg.Data)
+	res.Sources = append(res.Sources, files...)
+	if err != nil {
+		return nil, err
+	}
+
+	lang := "en"
+	for _, p := range pages {
+		if p.Path == "" && p.Meta.Lang != "" {
+			lang = p.Meta.Lang
+		}
+	}
+
+	// write renders a tag page at dir, a path relative to the site root.
+	write := func(dir, layout, what string, meta PageMeta, pd pageData) (builtPage, error) {
+		site := newSitePage(cfg, dir+"index.md")
+		if prev, ok := outputs[site.Output]; ok {
+			return builtPage{}, fmt.Errorf("page %s clashes with the %s, which is written to %s", prev, what, site.Output)
+		}
+		meta.Lang, meta.Dir = lang, textDirection(lang)
+		if cfg.BaseURL != "" {
+			meta.URL = site.URL
+		}
+		pd.PageMeta, pd.HeadMeta, pd.Style, pd.Data = meta, headMeta(meta), template.CSS(style.CSS), data
+
+		var content bytes.Buffer
+		if err := tagListings.ExecuteTemplate(&content, layout, pd); err != nil {
+			return builtPage{}, fmt.Errorf("failed to list tag %s: %w", meta.Title, err)
+		}
+		pd.Content = template.HTML(content.String())
+		if !slices.Contains(tmpl.Layouts(), layout) {
+			layout = ""
+		}
+
+		c := pageCfg
+		// There's no markdown file, but local files the template references
+		// are still found relative to the site.
+		c.Input, c.Output = filepath.Join(cfg.Input, filepath.FromSlash(dir), "index.md"), site.Output
+		if err := os.MkdirAll(filepath.Dir(c.Output), 0755); err != nil {
+			return builtPage{}, fmt.Errorf("failed to create output directory %s: %w", filepath.Dir(c.Output), err)
+		}
+		if _, err := writePage(c, tmpl, layout, pd); err != nil {
+			return builtPage{}, err
+		}
+		return builtPage{sitePage: site, Meta: meta}, nil
+	}
+
+	// linked gives the pages of a tag with links from the page at from.
+	// Until then, their URLs hold their paths.
+	linked := func(t *Tag, from string) Tag {
+		l := *t
+		l.URL = href(cfg, from, tagPath(t.Slug))
+		l.Pages = slices.Clone(t.Pages)
+		for i := range l.Pages {
+			l.Pages[i].URL = href(cfg, from, l.Pages[i].URL)
+		}
+		return l
+	}
+
+	var written []builtPage
+	all := make([]Tag, len(tags))
+	for i, t := range tags {
+		sort.SliceStable(t.Pages, func(i, j int) bool {
+			return t.Pages[i].Date.After(t.Pages[j].Date)
+		})
+		t.Count = len(t.Pages)
+		all[i] = linked(t, tagsDir)
+
+		dir := tagPath(t.Slug)
+		tag := linked(t, dir)
+		meta := PageMeta{Title: t.Name, Desc: fmt.Sprintf("Pages tagged %s", t.Name)}
+		p, err := write(dir, "tag", fmt.Sprintf("page for tag %q", t.Name), meta, pageData{Tag: &tag})
+		if err != nil {
+			return nil, err
+		}
+		p.Modified = t.Pages[0].Date
+		written = append(written, p)
+	}
+	p, err := write(tagsDir, "tags", "tag index", PageMeta{Title: "Tags", Desc: "All tags"}, pageData{AllTags: all})
+	if err != nil {
+		return nil, err
+	}
+	return append(written, p), nil
+}
+
+// href links from the page at path from to the one at path to, both
+// relative to the site root. With a base URL the link is absolute; without
+// one it is relative and names index.html, so the site works from any
+// directory and straight from disk.
+func href(cfg SiteConfig, from, to string) string {
+	if cfg.BaseURL != "" {
+		return siteURL(cfg, to)
+	}
+	if to == "" || strings.HasSuffix(to, "/") {
+		to += "index.html"
+	}
+	return strings.Repeat("../", strings.Count(from, "/")) + (&url.URL{Path: to}).EscapedPath()
+}
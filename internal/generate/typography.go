@@ -0,0 +1,286 @@
+package generate
+
+import (
+	"fmt"
+	"html"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+	"golang.org/x/text/language"
+)
+
+// Typography is the punctuation the typographer substitutes for one locale.
+// Values are plain text. Empty fields keep the English default.
+type Typography struct {
+	LeftDoubleQuote  string `yaml:"left_double_quote" toml:"left_double_quote" json:"left_double_quote"`
+	RightDoubleQuote string `yaml:"right_double_quote" toml:"right_double_quote" json:"right_double_quote"`
+	LeftSingleQuote  string `yaml:"left_single_quote" toml:"left_single_quote" json:"left_single_quote"`
+	RightSingleQuote string `yaml:"right_single_quote" toml:"right_single_quote" json:"right_single_quote"`
+	LeftAngleQuote   string `yaml:"left_angle_quote" toml:"left_angle_quote" json:"left_angle_quote"`
+	RightAngleQuote  string `yaml:"right_angle_quote" toml:"right_angle_quote" json:"right_angle_quote"`
+	Apostrophe       string `yaml:"apostrophe" toml:"apostrophe" json:"apostrophe"`
+	EnDash           string `yaml:"en_dash" toml:"en_dash" json:"en_dash"`
+	EmDash           string `yaml:"em_dash" toml:"em_dash" json:"em_dash"`
+	Ellipsis         string `yaml:"ellipsis" toml:"ellipsis" json:"ellipsis"`
+
+	// SpaceBefore maps punctuation marks to the space that replaces a normal
+	// space in front of them, like French's non-breaking space before ":".
+	// An empty value removes a mark set by the built-in locale.
+	SpaceBefore map[string]string `yaml:"space_before" toml:"space_before" json:"space_before"`
+}
+
+// Typographies maps language tags, like "fr" or "de-CH", to their
+// typography.
+type Typographies map[string]Typography
+
+const (
+	nbsp       = "\u00a0"
+	narrowNbsp = "\u202f"
+)
+
+// builtinTypography holds the conventions for common languages. A region
+// specific entry is used before the one for the language alone.
+var builtinTypography = Typographies{
+	"fr": {
+		LeftDoubleQuote: "«" + nbsp, RightDoubleQuote: nbsp + "»",
+		LeftSingleQuote: "“", RightSingleQuote: "”",
+		LeftAngleQuote: "«" + nbsp, RightAngleQuote: nbsp + "»",
+		SpaceBefore: map[string]string{":": nbsp, ";": narrowNbsp, "!": narrowNbsp, "?": narrowNbsp},
+	},
+	"fr-CH": {
+		LeftDoubleQuote: "«" + narrowNbsp, RightDoubleQuote: narrowNbsp + "»",
+		LeftSingleQuote: "‹" + narrowNbsp, RightSingleQuote: narrowNbsp + "›",
+		LeftAngleQuote: "«" + narrowNbsp, RightAngleQuote: narrowNbsp + "»",
+		SpaceBefore: map[string]string{":": narrowNbsp, ";": narrowNbsp, "!": narrowNbsp, "?": narrowNbsp},
+	},
+	"de":    {LeftDoubleQuote: "„", RightDoubleQuote: "“", LeftSingleQuote: "‚", RightSingleQuote: "‘", LeftAngleQuote: "»", RightAngleQuote: "«"},
+	"de-CH": {LeftDoubleQuote: "«", RightDoubleQuote: "»", LeftSingleQuote: "‹", RightSingleQuote: "›"},
+	"cs":    {LeftDoubleQuote: "„", RightDoubleQuote: "“", LeftSingleQuote: "‚", RightSingleQuote: "‘"},
+	"sk":    {LeftDoubleQuote: "„", RightDoubleQuote: "“", LeftSingleQuote: "‚", RightSingleQuote: "‘"},
+	"pl":    {LeftDoubleQuote: "„", RightDoubleQuote: "”", LeftSingleQuote: "‚", RightSingleQuote: "’"},
+	"hu":    {LeftDoubleQuote: "„", RightDoubleQuote: "”", LeftSingleQuote: "»", RightSingleQuote: "«"},
+	"ru":    {LeftDoubleQuote: "«", RightDoubleQuote: "»", LeftSingleQuote: "„", RightSingleQuote: "“"},
+	"uk":    {LeftDoubleQuote: "«", RightDoubleQuote: "»", LeftSingleQuote: "„", RightSingleQuote: "“"},
+	"es":    {LeftDoubleQuote: "«", RightDoubleQuote: "»", LeftSingleQuote: "“", RightSingleQuote: "”"},
+	"it":    {LeftDoubleQuote: "«", RightDoubleQuote: "»", LeftSingleQuote: "“", RightSingleQuote: "”"},
+	"pt":    {LeftDoubleQuote: "«", RightDoubleQuote: "»", LeftSingleQuote: "“", RightSingleQuote: "”"},
+	"pt-BR": {LeftDoubleQuote: "“", RightDoubleQuote: "”", LeftSingleQuote: "‘", RightSingleQuote: "’"},
+	"nb":    {LeftDoubleQuote: "«", RightDoubleQuote: "»", LeftSingleQuote: "‘", RightSingleQuote: "’"},
+	"nn":    {LeftDoubleQuote: "«", RightDoubleQuote: "»", LeftSingleQuote: "‘", RightSingleQuote: "’"},
+	"no":    {LeftDoubleQuote: "«", RightDoubleQuote: "»", LeftSingleQuote: "‘", RightSingleQuote: "’"},
+	"da":    {LeftDoubleQuote: "»", RightDoubleQuote: "«", LeftSingleQuote: "›", RightSingleQuote: "‹"},
+	"sv":    {LeftDoubleQuote: "”", RightDoubleQuote: "”", LeftSingleQuote: "’", RightSingleQuote: "’"},
+	"fi":    {LeftDoubleQuote: "”", RightDoubleQuote: "”", LeftSingleQuote: "’", RightSingleQuote: "’"},
+	"ja":    {LeftDoubleQuote: "「", RightDoubleQuote: "」", LeftSingleQuote: "『", RightSingleQuote: "』"},
+	"zh-TW": {LeftDoubleQuote: "「", RightDoubleQuote: "」", LeftSingleQuote: "『", RightSingleQuote: "』"},
+}
+
+// LoadTypography reads per-locale typography overrides from a YAML, TOML or
+// JSON file, keyed by language tag:
+//
+//	fr:
+//	  left_double_quote: "«\u202f"
+//	  space_before: {"?": "\u202f"}
+func LoadTypography(path string) (Typographies, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read typography file %s: %w", path, err)
+	}
+
+	raw := &rawFrontmatter{Data: b, Line: 1}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".toml":
+		raw.Format = "TOML"
+	case ".json":
+		raw.Format = "JSON"
+	default:
+		raw.Format = "YAML"
+	}
+
+	var t Typographies
+	if err := raw.decode(&t); err != nil {
+		located := raw.locate(b, err)
+		located.File = path
+		located.Msg = strings.Replace(located.Msg, "frontmatter", "typography file", 1)
+		return nil, located
+	}
+	for tag := range t {
+		if _, err := language.Parse(tag); err != nil {
+			return nil, fmt.Errorf("invalid typography file %s: %q is not a language tag", path, tag)
+		}
+	}
+	return t, nil
+}
+
+// typographyFor returns the typography for a page language: the built-in
+// conventions with the overrides applied, most specific tag last.
+func typographyFor(lang string, overrides Typographies) Typography {
+	var t Typography
+	for _, key := range localeKeys(lang) {
+		t = t.merge(lookupTypography(builtinTypography, key))
+		t = t.merge(lookupTypography(overrides, key))
+	}
+	return t
+}
+
+// localeKeys lists the keys to look a language up by, from least to most
+// specific: "de", "de-CH".
+func localeKeys(lang string) []string {
+	tag, err := language.Parse(lang)
+	if err != nil {
+		return nil
+	}
+	base, _ := tag.Base()
+	keys := []string{base.String()}
+	if region, conf := tag.Region(); conf == language.Exact {
+		keys = append(keys, base.String()+"-"+region.String())
+	}
+	if script, conf := tag.Script(); conf == language.Exact {
+		keys = append(keys, base.String()+"-"+script.String())
+	}
+	return keys
+}
+
+// lookupTypography finds key in t, ignoring case.
+func lookupTypography(t Typographies, key string) Typography {
+	for k, v := range t {
+		if strings.EqualFold(k, key) {
+			return v
+		}
+	}
+	return Typography{}
+}
+
+// merge returns t with the fields set in o replacing its own.
+func (t Typography) merge(o Typography) Typography {
+	set := func(dst *string, src string) {
+		if src != "" {
+			*dst = src
+		}
+	}
+	set(&t.LeftDoubleQuote, o.LeftDoubleQuote)
+	set(&t.RightDoubleQuote, o.RightDoubleQuote)
+	set(&t.LeftSingleQuote, o.LeftSingleQuote)
+	set(&t.RightSingleQuote, o.RightSingleQuote)
+	set(&t.LeftAngleQuote, o.LeftAngleQuote)
+	set(&t.RightAngleQuote, o.RightAngleQuote)
+	set(&t.Apostrophe, o.Apostrophe)
+	set(&t.EnDash, o.EnDash)
+	set(&t.EmDash, o.EmDash)
+	set(&t.Ellipsis, o.Ellipsis)
+	if o.SpaceBefore != nil {
+		spaces := make(map[string]string, len(t.SpaceBefore)+len(o.SpaceBefore))
+		for k, v := range t.SpaceBefore {
+			spaces[k] = v
+		}
+		for k, v := range o.SpaceBefore {
+			if v == "" {
+				delete(spaces, k)
+			} else {
+				spaces[k] = v
+			}
+		}
+		t.SpaceBefore = spaces
+	}
+	return t
+}
+
+// options returns the goldmark options that make the typographer follow t.
+func (t Typography) options() []goldmark.Option {
+	subs := make(map[extension.TypographicPunctuation]string)
+	add := func(p extension.TypographicPunctuation, s string) {
+		if s != "" {
+			subs[p] = html.EscapeString(s)
+		}
+	}
+	add(extension.LeftDoubleQuote, t.LeftDoubleQuote)
+	add(extension.RightDoubleQuote, t.RightDoubleQuote)
+	add(extension.LeftSingleQuote, t.LeftSingleQuote)
+	add(extension.RightSingleQuote, t.RightSingleQuote)
+	add(extension.LeftAngleQuote, t.LeftAngleQuote)
+	add(extension.RightAngleQuote, t.RightAngleQuote)
+	add(extension.Apostrophe, t.Apostrophe)
+	add(extension.EnDash, t.EnDash)
+	add(extension.EmDash, t.EmDash)
+	add(extension.Ellipsis, t.Ellipsis)
+
+	opts := []goldmark.Option{goldmark.WithExtensions(
+		extension.NewTypographer(extension.WithTypographicSubstitutions(subs)),
+	)}
+	if len(t.SpaceBefore) > 0 {
+		opts = append(opts, goldmark.WithParserOptions(parser.WithASTTransformers(
+			util.Prioritized(spaceBefore(t.SpaceBefore), 100),
+		)))
+	}
+	return opts
+}
+
+// spaceBefore replaces the normal space in front of punctuation marks with
+// the space the locale asks for, so the mark can't wrap onto a new line.
+type spaceBefore map[string]string
+
+func (s spaceBefore) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	source := reader.Source()
+	var texts []*ast.Text
+	_ = ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch n := n.(type) {
+		case *ast.CodeSpan, *ast.CodeBlock, *ast.FencedCodeBlock, *ast.HTMLBlock, *ast.RawHTML:
+			return ast.WalkSkipChildren, nil
+		case *ast.Text:
+			texts = append(texts, n)
+		}
+		return ast.WalkContinue, nil
+	})
+	for _, t := range texts {
+		s.replace(t, source)
+	}
+}
+
+// replace splits a text node around every space that comes before one of
+// the marks. A mark at the start of the next text node counts too, as
+// inline parsing often splits text at "!".
+func (s spaceBefore) replace(t *ast.Text, source []byte) {
+	seg := t.Segment
+	parent := t.Parent()
+	for i := seg.Start; i < seg.Stop; i++ {
+		if source[i] != ' ' || i+1 >= len(source) {
+			continue
+		}
+		if i+1 == seg.Stop {
+			if _, ok := t.NextSibling().(*ast.Text); !ok || t.SoftLineBreak() || t.HardLineBreak() {
+				continue
+			}
+		}
+		space, ok := s.spaceFor(source[i+1:])
+		if !ok {
+			continue
+		}
+		before := ast.NewTextSegment(text.NewSegment(seg.Start, i))
+		parent.InsertBefore(parent, t, before)
+		str := ast.NewString([]byte(html.EscapeString(space)))
+		str.SetCode(true)
+		parent.InsertBefore(parent, t, str)
+		seg = text.NewSegment(i+1, seg.Stop)
+		t.Segment = seg
+		i = seg.Start
+	}
+}
+
+func (s spaceBefore) spaceFor(rest []byte) (string, bool) {
+	for mark, space := range s {
+		if mark != "" && strings.HasPrefix(string(rest), mark) {
+			return space, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,418 @@
+package generate
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/text/language"
+
+	"github.com/kscarlett/june/internal/diag"
+	templatex "github.com/kscarlett/june/internal/template"
+)
+
+// Schema describes the frontmatter keys a page may use. The fields of
+// PageMeta are always known; a user schema adds to or tightens them.
+type Schema struct {
+	Fields map[string]Field `yaml:"fields" toml:"fields" json:"fields"`
+
+	// AllowUnknown turns off warnings for keys that aren't in the schema.
+	AllowUnknown bool `yaml:"allow_unknown" toml:"allow_unknown" json:"allow_unknown"`
+}
+
+// Field describes a single frontmatter key.
+type Field struct {
+	// Type is one of string, number, integer, bool, list, map, date or lang.
+	// An empty type accepts any value.
+	Type     string   `yaml:"type" toml:"type" json:"type"`
+	Required bool     `yaml:"required" toml:"required" json:"required"`
+	Values   []string `yaml:"values" toml:"values" json:"values"`
+}
+
+// builtinFields are the frontmatter keys decoded into PageMeta.
+var builtinFields = map[string]Field{
+	"title":       {Type: "string"},
+	"description": {Type: "string"},
+	"lang":        {Type: "lang"},
+	"dir":         {Type: "string", Values: []string{"ltr", "rtl", "auto"}},
+	"tags":        {Type: "list"},
+	"image":       {Type: "string"},
+	"url":         {Type: "string"},
+	"type":        {Type: "string"},
+	"author":      {Type: "string"},
+	"date":        {Type: "date"},
+	"markdown":    {Type: "map"},
+	"layout":      {Type: "string"},
+	"draft":       {Type: "bool"},
+	"noindex":     {Type: "bool"},
+	"priority":    {Type: "number"},
+	"changefreq":  {Type: "string", Values: []string{"always", "hourly", "daily", "weekly", "monthly", "yearly", "never"}},
+}
+
+// LoadSchema reads a frontmatter schema from a YAML, TOML or JSON file. Both
+// june's own format and the object subset of JSON Schema are understood:
+//
+//	fields:
+//	  author: {type: string, required: true}
+//
+//	{"properties": {"author": {"type": "string"}}, "required": ["author"]}
+func LoadSchema(path string) (*Schema, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema %s: %w", path, err)
+	}
+
+	raw := &rawFrontmatter{Data: b, Line: 1}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".toml":
+		raw.Format = "TOML"
+	case ".json":
+		raw.Format = "JSON"
+	default:
+		raw.Format = "YAML"
+	}
+
+	var doc map[string]any
+	if err := raw.decode(&doc); err != nil {
+		located := raw.locate(b, err)
+		located.File = path
+		located.Msg = strings.Replace(located.Msg, "frontmatter", "schema", 1)
+		return nil, located
+	}
+	if _, ok := doc["properties"]; ok {
+		return jsonSchema(doc)
+	}
+
+	var schema Schema
+	if err := raw.decode(&schema); err != nil {
+		return nil, fmt.Errorf("invalid schema %s: %w", path, err)
+	}
+	for key, f := range schema.Fields {
+		if f.Type != "" && !knownTypes[f.Type] {
+			return nil, fmt.Errorf("invalid schema %s: unknown type %q for %q", path, f.Type, key)
+		}
+	}
+	return &schema, nil
+}
+
+// jsonSchema converts the parts of a JSON Schema object that map onto Field.
+func jsonSchema(doc map[string]any) (*Schema, error) {
+	schema := &Schema{Fields: make(map[string]Field), AllowUnknown: true}
+	if ap, ok := doc["additionalProperties"].(bool); ok {
+		schema.AllowUnknown = ap
+	}
+
+	props, ok := doc["properties"].(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("invalid schema: properties must be an object")
+	}
+	for key, p := range props {
+		prop, ok := p.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("invalid schema: property %q must be an object", key)
+		}
+		var f Field
+		switch t, _ := prop["type"].(string); t {
+		case "string":
+			f.Type = "string"
+			if format, _ := prop["format"].(string); format == "date" || format == "date-time" {
+				f.Type = "date"
+			}
+		case "number", "integer":
+			f.Type = t
+		case "boolean":
+			f.Type = "bool"
+		case "array":
+			f.Type = "list"
+		case "object":
+			f.Type = "map"
+		case "":
+		default:
+			return nil, fmt.Errorf("invalid schema: unsupported type %q for %q", t, key)
+		}
+		if enum, ok := prop["enum"].([]any); ok {
+			for _, v := range enum {
+				f.Values = append(f.Values, fmt.Sprint(v))
+			}
+		}
+		schema.Fields[key] = f
+	}
+
+	if req, ok := doc["required"].([]any); ok {
+		for _, r := range req {
+			key := fmt.Sprint(r)
+			f := schema.Fields[key]
+			f.Required = true
+			schema.Fields[key] = f
+		}
+	}
+	return schema, nil
+}
+
+var knownTypes = map[string]bool{
+	"string": true, "number": true, "integer": true, "bool": true,
+	"list": true, "map": true, "date": true, "lang": true,
+}
+
+// fields merges the schema with the built-in PageMeta fields.
+func (s *Schema) fields() map[string]Field {
+	fields := make(map[string]Field, len(builtinFields))
+	for k, f := range builtinFields {
+		fields[k] = f
+	}
+	if s == nil {
+		return fields
+	}
+	for k, f := range s.Fields {
+		if f.Type == "" {
+			f.Type = fields[k].Type
+		}
+		fields[k] = f
+	}
+	return fields
+}
+
+// validateFrontmatter checks the decoded frontmatter values against the
+// schema. fm may be nil if the document has no frontmatter. Problems are
+// located in src, the full document source.
+func validateFrontmatter(schema *Schema, fm *rawFrontmatter, values map[string]any, src []byte) []*diag.Error {
+	fields := schema.fields()
+	allowUnknown := schema != nil && schema.AllowUnknown
+
+	var problems []*diag.Error
+	report := func(key, format string, args ...any) {
+		line, col := 1, 1
+		if fm != nil {
+			line, col = fm.keyPosition(key)
+		}
+		problems = append(problems, diag.New("", src, line, col, fmt.Sprintf(format, args...), nil))
+	}
+
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		v := values[key]
+		f, ok := fields[key]
+		if !ok {
+			if allowUnknown {
+				continue
+			}
+			if guess := closestKey(key, fields); guess != "" {
+				report(key, "unknown frontmatter key %q (did you mean %q?)", key, guess)
+			} else {
+				report(key, "unknown frontmatter key %q", key)
+			}
+			continue
+		}
+		if msg := checkValue(f, v); msg != "" {
+			report(key, "%s: %s", key, msg)
+		} else if p, ok := toNumber(v); ok && key == "priority" && (p < 0 || p > 1) {
+			report(key, "priority: %v is not between 0 and 1", v)
+		}
+	}
+
+	required := make([]string, 0)
+	for key, f := range fields {
+		if _, ok := values[key]; f.Required && !ok {
+			required = append(required, key)
+		}
+	}
+	sort.Strings(required)
+	for _, key := range required {
+		report("", "missing required frontmatter key %q", key)
+	}
+
+	sort.SliceStable(problems, func(i, j int) bool {
+		return problems[i].Line < problems[j].Line
+	})
+	return problems
+}
+
+// checkValue returns a description of what is wrong with v, or "" if it
+// matches the field.
+func checkValue(f Field, v any) string {
+	if !hasType(f.Type, v) {
+		return fmt.Sprintf("expected %s, got %s", f.Type, describe(v))
+	}
+	if tag, _ := v.(string); f.Type == "lang" && tag != "" {
+		if _, err := language.Parse(tag); err != nil {
+			return fmt.Sprintf("%q is not a valid BCP 47 language tag (e.g. en, fr-CA, zh-Hant)", tag)
+		}
+	}
+	if len(f.Values) > 0 {
+		s := fmt.Sprint(v)
+		for _, allowed := range f.Values {
+			if s == allowed {
+				return ""
+			}
+		}
+		return fmt.Sprintf("%q is not one of %s", s, strings.Join(f.Values, ", "))
+	}
+	return ""
+}
+
+func hasType(typ string, v any) bool {
+	if v == nil {
+		// An empty key, like "description:" in YAML, is treated as unset.
+		return true
+	}
+	switch typ {
+	case "":
+		return true
+	case "string", "lang":
+		_, ok := v.(string)
+		return ok
+	case "number":
+		switch v.(type) {
+		case int, int64, uint64, float64:
+			return true
+		}
+	case "integer":
+		switch n := v.(type) {
+		case int, int64, uint64:
+			return true
+		case float64:
+			return n == float64(int64(n))
+		}
+	case "bool":
+		_, ok := v.(bool)
+		return ok
+	case "list":
+		_, ok := v.([]any)
+		if !ok {
+			_, ok = v.([]map[string]any)
+		}
+		return ok
+	case "map":
+		_, ok := v.(map[string]any)
+		return ok
+	case "date":
+		_, ok := toDate(v)
+		return ok
+	}
+	return false
+}
+
+// toDate converts a frontmatter value to a time. YAML and TOML decode
+// unquoted dates themselves; quoted ones and JSON dates arrive as strings.
+func toDate(v any) (time.Time, bool) {
+	switch d := v.(type) {
+	case time.Time:
+		return d, true
+	case string:
+		return templatex.ParseDate(d)
+	}
+	return time.Time{}, false
+}
+
+// toNumber converts a frontmatter number to a float.
+func toNumber(v any) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
+
+// toString converts a frontmatter value to text. Numbers and booleans are
+// accepted, as YAML decodes "title: 1984" as a number.
+func toString(v any) (string, bool) {
+	switch s := v.(type) {
+	case string:
+		return s, true
+	case int, int64, uint64, float64, bool:
+		return fmt.Sprint(s), true
+	}
+	return "", false
+}
+
+func describe(v any) string {
+	switch v.(type) {
+	case string:
+		return "string"
+	case int, int64, uint64, float64:
+		return "number"
+	case bool:
+		return "bool"
+	case []any, []map[string]any:
+		return "list"
+	case map[string]any:
+		return "map"
+	case time.Time:
+		return "date"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// closestKey suggests a known key for a likely typo.
+func closestKey(key string, fields map[string]Field) string {
+	best, bestDist := "", 3
+	for k := range fields {
+		if d := editDistance(key, k); d < bestDist || (d == bestDist && best != "" && k < best) {
+			best, bestDist = k, d
+		}
+	}
+	return best
+}
+
+// editDistance is the optimal string alignment distance between a and b, so
+// a swap of two neighbouring letters ("titel") counts as a single edit.
+func editDistance(a, b string) int {
+	d := make([][]int, len(a)+1)
+	for i := range d {
+		d[i] = make([]int, len(b)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			d[i][j] = min(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				d[i][j] = min(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+	return d[len(a)][len(b)]
+}
+
+// keyPosition finds the line and column where key is set in the frontmatter.
+// If key is empty or not found it points at the start of the frontmatter.
+func (r *rawFrontmatter) keyPosition(key string) (int, int) {
+	if key != "" {
+		var re *regexp.Regexp
+		q := regexp.QuoteMeta(key)
+		switch r.Format {
+		case "YAML":
+			re = regexp.MustCompile(`(?m)^(\s*)["']?` + q + `["']?\s*:`)
+		case "TOML":
+			re = regexp.MustCompile(`(?m)^(\s*)["']?` + q + `["']?\s*=`)
+		case "JSON":
+			re = regexp.MustCompile(`(?m)^(.*?)"` + q + `"\s*:`)
+		}
+		if loc := re.FindSubmatchIndex(r.Data); loc != nil {
+			line, col := diag.Position(r.Data, loc[3])
+			return r.Line + line - 1, col
+		}
+	}
+	return max(r.Line-1, 1), 1
+}
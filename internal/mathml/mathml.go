@@ -0,0 +1,819 @@
+// Package mathml converts TeX math, as written between dollar signs in
+// markdown, to MathML that browsers render natively.
+//
+// It understands the commonly used subset of LaTeX math: scripts, fractions,
+// roots, Greek letters and symbols, font commands like \mathbb, accents,
+// \left and \right, \text, and the matrix, cases and aligned environments.
+package mathml
+
+import (
+	"fmt"
+	"html"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Error is a problem in a TeX formula.
+type Error struct {
+	Offset int // Byte offset of the problem in the formula.
+	Msg    string
+
+	// Unknown is set when the formula uses a command or environment that
+	// isn't supported, rather than being malformed.
+	Unknown bool
+}
+
+func (e *Error) Error() string {
+	return e.Msg
+}
+
+// Convert converts a TeX formula to a <math> element. Display formulas are
+// set as blocks, with limits above and below large operators. The TeX
+// source is kept as an annotation, so it survives copy and paste.
+func Convert(tex string, display bool) (string, error) {
+	p := &parser{src: tex, display: display}
+	row, end, err := p.parseRow()
+	if err != nil {
+		return "", err
+	}
+	if err := p.unexpected(end, "formula"); err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	b.WriteString(`<math xmlns="http://www.w3.org/1998/Math/MathML"`)
+	if display {
+		b.WriteString(` display="block"`)
+	}
+	b.WriteString("><semantics>")
+	b.WriteString(mrow(row))
+	b.WriteString(`<annotation encoding="application/x-tex">`)
+	b.WriteString(html.EscapeString(strings.TrimSpace(tex)))
+	b.WriteString("</annotation></semantics></math>")
+	return b.String(), nil
+}
+
+type parser struct {
+	src     string
+	pos     int
+	display bool
+
+	// variant is the font selected by a command like \mathbf, or "".
+	variant string
+}
+
+// terminator is what ended a row: "" for the end of the formula, or one of
+// "}", "&", `\\`, `\right` and `\end`.
+type terminator struct {
+	tok string
+	pos int
+}
+
+// atom is a parsed element, before scripts are attached.
+type atom struct {
+	ml string
+
+	// limits puts scripts above and below in display mode, as for \sum.
+	limits bool
+}
+
+func (p *parser) errorf(pos int, format string, args ...any) error {
+	return &Error{Offset: pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+// unexpected reports a terminator that isn't allowed where it was found.
+func (p *parser) unexpected(end terminator, where string) error {
+	switch end.tok {
+	case "":
+		return nil
+	case "}":
+		return p.errorf(end.pos, "unexpected } in %s, there is no { to close", where)
+	case `\right`:
+		return p.errorf(end.pos, `\right without a matching \left`)
+	case `\end`:
+		return p.errorf(end.pos, `\end without a matching \begin`)
+	default:
+		return p.errorf(end.pos, `%s is only allowed inside an environment like \begin{aligned}`, end.tok)
+	}
+}
+
+func (p *parser) eof() bool {
+	return p.pos >= len(p.src)
+}
+
+func (p *parser) skipSpace() {
+	for !p.eof() {
+		switch p.src[p.pos] {
+		case ' ', '\t', '\n', '\r':
+			p.pos++
+		case '%':
+			// A comment runs to the end of the line.
+			for !p.eof() && p.src[p.pos] != '\n' {
+				p.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+// peekCommand returns the name of the command at the current position,
+// without the backslash, and its length in bytes including it.
+func (p *parser) peekCommand() (string, int) {
+	if p.eof() || p.src[p.pos] != '\\' {
+		return "", 0
+	}
+	i := p.pos + 1
+	if i >= len(p.src) {
+		return "", 1
+	}
+	if !isLetter(p.src[i]) {
+		_, size := utf8.DecodeRuneInString(p.src[i:])
+		return p.src[i : i+size], 1 + size
+	}
+	for i < len(p.src) && isLetter(p.src[i]) {
+		i++
+	}
+	// \operatorname* is the only starred command in math mode.
+	if i < len(p.src) && p.src[i] == '*' && p.src[p.pos+1:i] == "operatorname" {
+		i++
+	}
+	return p.src[p.pos+1 : i], i - p.pos
+}
+
+func isLetter(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+// parseRow parses elements up to the end of the formula or a terminator.
+func (p *parser) parseRow() ([]string, terminator, error) {
+	var row []string
+	for {
+		p.skipSpace()
+		if p.eof() {
+			return row, terminator{pos: p.pos}, nil
+		}
+		start := p.pos
+		switch c := p.src[p.pos]; c {
+		case '}':
+			p.pos++
+			return row, terminator{"}", start}, nil
+		case '&':
+			p.pos++
+			return row, terminator{"&", start}, nil
+		case '\\':
+			name, n := p.peekCommand()
+			switch name {
+			case `\`, "cr":
+				p.pos += n
+				// An optional spacing argument, like \\[2pt], is ignored.
+				if _, err := p.optionalArg(); err != nil {
+					return nil, terminator{}, err
+				}
+				return row, terminator{`\\`, start}, nil
+			case "right", "end":
+				p.pos += n
+				return row, terminator{`\` + name, start}, nil
+			case "displaystyle", "textstyle":
+				p.pos += n
+				rest, end, err := p.parseRow()
+				if err != nil {
+					return nil, terminator{}, err
+				}
+				style := fmt.Sprintf(`<mstyle displaystyle="%t">%s</mstyle>`, name == "displaystyle", mrow(rest))
+				return append(row, style), end, nil
+			}
+		}
+		ml, err := p.parseScripted()
+		if err != nil {
+			return nil, terminator{}, err
+		}
+		row = append(row, ml)
+	}
+}
+
+// parseScripted parses an element with any sub- and superscripts and
+// primes that follow it.
+func (p *parser) parseScripted() (string, error) {
+	base, err := p.parseAtom(false)
+	if err != nil {
+		return "", err
+	}
+
+	var sub, sup string
+	primes := ""
+	for {
+		p.skipSpace()
+		if p.eof() {
+			break
+		}
+		if name, n := p.peekCommand(); name == "limits" || name == "nolimits" {
+			p.pos += n
+			base.limits = name == "limits"
+			continue
+		}
+		c := p.src[p.pos]
+		if c == '\'' {
+			p.pos++
+			primes += "′"
+			continue
+		}
+		if c != '^' && c != '_' {
+			break
+		}
+		at := p.pos
+		p.pos++
+		arg, err := p.parseArg(string(c))
+		if err != nil {
+			return "", err
+		}
+		if c == '^' {
+			if sup != "" {
+				return "", p.errorf(at, "double superscript, use braces to group them")
+			}
+			sup = arg
+		} else {
+			if sub != "" {
+				return "", p.errorf(at, "double subscript, use braces to group them")
+			}
+			sub = arg
+		}
+	}
+	if primes != "" {
+		if sup == "" {
+			sup = "<mo>" + primes + "</mo>"
+		} else {
+			sup = "<mrow><mo>" + primes + "</mo>" + sup + "</mrow>"
+		}
+	}
+	if base.ml == "" && (sub != "" || sup != "") {
+		base.ml = "<mrow></mrow>"
+	}
+
+	under, over := "msub", "msup"
+	both := "msubsup"
+	if base.limits && p.display {
+		under, over, both = "munder", "mover", "munderover"
+	}
+	switch {
+	case sub != "" && sup != "":
+		return "<" + both + ">" + base.ml + sub + sup + "</" + both + ">", nil
+	case sub != "":
+		return "<" + under + ">" + base.ml + sub + "</" + under + ">", nil
+	case sup != "":
+		return "<" + over + ">" + base.ml + sup + "</" + over + ">", nil
+	}
+	return base.ml, nil
+}
+
+// parseArg parses the argument of a command or script: a braced group or
+// a single element. what names the command for error messages.
+func (p *parser) parseArg(what string) (string, error) {
+	p.skipSpace()
+	if p.eof() {
+		return "", p.errorf(p.pos, "missing argument for %s", what)
+	}
+	switch p.src[p.pos] {
+	case '{':
+		return p.parseGroup()
+	case '}', '&', '^', '_':
+		return "", p.errorf(p.pos, "missing argument for %s", what)
+	}
+	a, err := p.parseAtom(true)
+	if err != nil {
+		return "", err
+	}
+	return a.ml, nil
+}
+
+// parseGroup parses a braced group at the current position.
+func (p *parser) parseGroup() (string, error) {
+	open := p.pos
+	p.pos++
+	row, end, err := p.parseRow()
+	if err != nil {
+		return "", err
+	}
+	if end.tok != "}" {
+		if end.tok == "" {
+			return "", p.errorf(open, "missing } to close this {")
+		}
+		return "", p.unexpected(end, "group")
+	}
+	return mrow(row), nil
+}
+
+// optionalArg parses a [bracketed] argument, returning its raw text.
+func (p *parser) optionalArg() (string, error) {
+	p.skipSpace()
+	if p.eof() || p.src[p.pos] != '[' {
+		return "", nil
+	}
+	open := p.pos
+	depth := 0
+	for i := p.pos + 1; i < len(p.src); i++ {
+		switch p.src[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+		case ']':
+			if depth == 0 {
+				p.pos = i + 1
+				return p.src[open+1 : i], nil
+			}
+		}
+	}
+	return "", p.errorf(open, "missing ] to close this [")
+}
+
+// rawGroup returns the text of a braced group without parsing it, as for
+// \text and \begin.
+func (p *parser) rawGroup(what string) (string, error) {
+	p.skipSpace()
+	if p.eof() || p.src[p.pos] != '{' {
+		return "", p.errorf(p.pos, "missing {…} argument for %s", what)
+	}
+	open := p.pos
+	depth := 0
+	for i := p.pos; i < len(p.src); i++ {
+		switch p.src[i] {
+		case '\\':
+			i++
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				p.pos = i + 1
+				return p.src[open+1 : i], nil
+			}
+		}
+	}
+	return "", p.errorf(open, "missing } to close this {")
+}
+
+// parseAtom parses a single element. With single set, a run of digits or
+// letters yields just its first character, as in \frac12.
+func (p *parser) parseAtom(single bool) (atom, error) {
+	start := p.pos
+	c := p.src[p.pos]
+	switch {
+	case c == '{':
+		ml, err := p.parseGroup()
+		return atom{ml: ml}, err
+	case c == '\\':
+		return p.parseCommand()
+	case c == '^' || c == '_':
+		// A script with nothing before it, like {}^{14}C without braces.
+		return atom{}, nil
+	case c == '~':
+		p.pos++
+		return atom{ml: `<mspace width="0.25em"></mspace>`}, nil
+	case c == '#':
+		return atom{}, p.errorf(start, "unexpected #")
+	case '0' <= c && c <= '9' || c == '.' && p.pos+1 < len(p.src) && '0' <= p.src[p.pos+1] && p.src[p.pos+1] <= '9':
+		end := p.pos + 1
+		if !single {
+			for end < len(p.src) && ('0' <= p.src[end] && p.src[end] <= '9' || p.src[end] == '.' && end+1 < len(p.src) && '0' <= p.src[end+1] && p.src[end+1] <= '9') {
+				end++
+			}
+		}
+		p.pos = end
+		return atom{ml: p.number(p.src[start:end])}, nil
+	}
+
+	r, size := utf8.DecodeRuneInString(p.src[p.pos:])
+	p.pos += size
+	if unicode.IsLetter(r) {
+		return atom{ml: p.identifier(string(r))}, nil
+	}
+	switch r {
+	case '-':
+		return atom{ml: "<mo>−</mo>"}, nil
+	case '*':
+		return atom{ml: "<mo>∗</mo>"}, nil
+	case '(', ')', '[', ']', '|':
+		return atom{ml: `<mo stretchy="false">` + string(r) + "</mo>"}, nil
+	}
+	return atom{ml: "<mo>" + html.EscapeString(string(r)) + "</mo>"}, nil
+}
+
+// identifier renders a letter in the current font.
+func (p *parser) identifier(s string) string {
+	switch p.variant {
+	case "":
+		return "<mi>" + html.EscapeString(s) + "</mi>"
+	case "normal":
+		return `<mi mathvariant="normal">` + html.EscapeString(s) + "</mi>"
+	}
+	return "<mi>" + styled(s, p.variant) + "</mi>"
+}
+
+func (p *parser) number(s string) string {
+	if p.variant != "" && p.variant != "normal" {
+		return "<mn>" + styled(s, p.variant) + "</mn>"
+	}
+	return "<mn>" + s + "</mn>"
+}
+
+// styled maps ASCII letters and digits to their mathematical alphanumeric
+// form in the given style.
+func styled(s, variant string) string {
+	base, ok := alphabets[variant]
+	if !ok {
+		return html.EscapeString(s)
+	}
+	var b strings.Builder
+	for _, r := range s {
+		if hole, ok := alphabetHoles[variant][r]; ok {
+			b.WriteRune(hole)
+			continue
+		}
+		switch {
+		case 'A' <= r && r <= 'Z':
+			b.WriteRune(base[0] + r - 'A')
+		case 'a' <= r && r <= 'z':
+			b.WriteRune(base[1] + r - 'a')
+		case '0' <= r && r <= '9' && base[2] != 0:
+			b.WriteRune(base[2] + r - '0')
+		default:
+			b.WriteString(html.EscapeString(string(r)))
+		}
+	}
+	return b.String()
+}
+
+// parseCommand parses a command and its arguments.
+func (p *parser) parseCommand() (atom, error) {
+	start := p.pos
+	name, n := p.peekCommand()
+	if name == "" {
+		return atom{}, p.errorf(start, "a lone \\ at the end of the formula")
+	}
+	p.pos += n
+	cmd := `\` + name
+
+	if s, ok := identifiers[name]; ok {
+		return atom{ml: p.identifier(s)}, nil
+	}
+	if s, ok := uprightIdentifiers[name]; ok {
+		return atom{ml: `<mi mathvariant="normal">` + s + "</mi>"}, nil
+	}
+	if s, ok := operators[name]; ok {
+		return atom{ml: "<mo>" + html.EscapeString(s) + "</mo>"}, nil
+	}
+	if s, ok := largeOperators[name]; ok {
+		return atom{ml: "<mo>" + s + "</mo>", limits: true}, nil
+	}
+	if functions[name] {
+		return atom{ml: "<mi>" + name + "</mi><mo>⁡</mo>"}, nil
+	}
+	if s, ok := limitFunctions[name]; ok {
+		return atom{ml: "<mi>" + s + "</mi>", limits: true}, nil
+	}
+	if width, ok := spaces[name]; ok {
+		return atom{ml: `<mspace width="` + width + `"></mspace>`}, nil
+	}
+	if s, ok := delimiters[name]; ok && len(name) == 1 {
+		return atom{ml: `<mo stretchy="false">` + html.EscapeString(s) + "</mo>"}, nil
+	}
+	if v, ok := variants[name]; ok {
+		saved := p.variant
+		p.variant = v
+		arg, err := p.parseArg(cmd)
+		p.variant = saved
+		return atom{ml: arg}, err
+	}
+	if s, ok := accents[name]; ok {
+		arg, err := p.parseArg(cmd)
+		stretchy := strings.HasPrefix(name, "wide") || strings.HasPrefix(name, "over")
+		return atom{
+			ml:     fmt.Sprintf(`<mover accent="true">%s<mo stretchy="%t">%s</mo></mover>`, arg, stretchy, html.EscapeString(s)),
+			limits: name == "overbrace",
+		}, err
+	}
+	if s, ok := underAccents[name]; ok {
+		arg, err := p.parseArg(cmd)
+		return atom{
+			ml:     fmt.Sprintf(`<munder accentunder="true">%s<mo stretchy="true">%s</mo></munder>`, arg, s),
+			limits: name == "underbrace",
+		}, err
+	}
+	if size, ok := bigSizes[name]; ok {
+		d, err := p.delimiter(cmd)
+		if err != nil {
+			return atom{}, err
+		}
+		return atom{ml: fmt.Sprintf(`<mo minsize="%s" maxsize="%s">%s</mo>`, size, size, d)}, nil
+	}
+
+	switch name {
+	case "frac", "dfrac", "tfrac", "cfrac":
+		num, err := p.parseArg(cmd)
+		if err != nil {
+			return atom{}, err
+		}
+		den, err := p.parseArg(cmd)
+		if err != nil {
+			return atom{}, err
+		}
+		frac := "<mfrac>" + num + den + "</mfrac>"
+		switch name {
+		case "dfrac", "cfrac":
+			frac = `<mstyle displaystyle="true">` + frac + "</mstyle>"
+		case "tfrac":
+			frac = `<mstyle displaystyle="false">` + frac + "</mstyle>"
+		}
+		return atom{ml: frac}, nil
+	case "binom", "dbinom", "tbinom":
+		n, err := p.parseArg(cmd)
+		if err != nil {
+			return atom{}, err
+		}
+		k, err := p.parseArg(cmd)
+		if err != nil {
+			return atom{}, err
+		}
+		return atom{ml: `<mrow><mo>(</mo><mfrac linethickness="0">` + n + k + `</mfrac><mo>)</mo></mrow>`}, nil
+	case "sqrt":
+		indexStart := p.pos
+		index, err := p.optionalArg()
+		if err != nil {
+			return atom{}, err
+		}
+		arg, err := p.parseArg(cmd)
+		if err != nil {
+			return atom{}, err
+		}
+		if index == "" {
+			return atom{ml: "<msqrt>" + arg + "</msqrt>"}, nil
+		}
+		sub := &parser{src: index, display: p.display}
+		row, end, err := sub.parseRow()
+		if err == nil {
+			err = sub.unexpected(end, "root index")
+		}
+		if err != nil {
+			e := err.(*Error)
+			e.Offset += indexStart + 1
+			return atom{}, e
+		}
+		return atom{ml: "<mroot>" + arg + mrow(row) + "</mroot>"}, nil
+	case "overset", "stackrel", "underset":
+		over, err := p.parseArg(cmd)
+		if err != nil {
+			return atom{}, err
+		}
+		base, err := p.parseArg(cmd)
+		if err != nil {
+			return atom{}, err
+		}
+		if name == "underset" {
+			return atom{ml: "<munder>" + base + over + "</munder>"}, nil
+		}
+		return atom{ml: "<mover>" + base + over + "</mover>"}, nil
+	case "text", "textrm", "textit", "textbf", "mbox":
+		s, err := p.rawGroup(cmd)
+		if err != nil {
+			return atom{}, err
+		}
+		return atom{ml: "<mtext>" + html.EscapeString(unescapeText(s)) + "</mtext>"}, nil
+	case "operatorname", "operatorname*":
+		s, err := p.rawGroup(cmd)
+		if err != nil {
+			return atom{}, err
+		}
+		return atom{ml: "<mi>" + html.EscapeString(s) + "</mi><mo>⁡</mo>", limits: name == "operatorname*"}, nil
+	case "bmod":
+		return atom{ml: `<mo lspace="0.2222em" rspace="0.2222em">mod</mo>`}, nil
+	case "pmod", "mod":
+		arg, err := p.parseArg(cmd)
+		if err != nil {
+			return atom{}, err
+		}
+		if name == "mod" {
+			return atom{ml: `<mspace width="1em"></mspace><mi>mod</mi><mspace width="0.3333em"></mspace>` + arg}, nil
+		}
+		return atom{ml: `<mspace width="1em"></mspace><mo>(</mo><mi>mod</mi><mspace width="0.3333em"></mspace>` + arg + "<mo>)</mo>"}, nil
+	case "not":
+		p.skipSpace()
+		if p.eof() {
+			return atom{}, p.errorf(start, `missing symbol after \not`)
+		}
+		next, err := p.parseAtom(true)
+		if err != nil {
+			return atom{}, err
+		}
+		return atom{ml: negate(next.ml)}, nil
+	case "left":
+		return p.parseFenced(start)
+	case "middle":
+		d, err := p.delimiter(cmd)
+		if err != nil {
+			return atom{}, err
+		}
+		return atom{ml: `<mo stretchy="true">` + d + "</mo>"}, nil
+	case "begin":
+		return p.parseEnvironment(start)
+	}
+	return atom{}, &Error{Offset: start, Msg: "unknown command " + cmd, Unknown: true}
+}
+
+// unescapeText removes the backslash from escaped characters in \text.
+func unescapeText(s string) string {
+	r := strings.NewReplacer(`\{`, "{", `\}`, "}", `\$`, "$", `\%`, "%", `\&`, "&", `\#`, "#", `\_`, "_", `\ `, " ", "~", " ")
+	return r.Replace(s)
+}
+
+// negate puts a slash through an operator, as \not does.
+func negate(ml string) string {
+	switch ml {
+	case "<mo>=</mo>":
+		return "<mo>≠</mo>"
+	case "<mo>∈</mo>":
+		return "<mo>∉</mo>"
+	case "<mo>≡</mo>":
+		return "<mo>≢</mo>"
+	case "<mo>⊂</mo>":
+		return "<mo>⊄</mo>"
+	case "<mo>⊆</mo>":
+		return "<mo>⊈</mo>"
+	}
+	if strings.HasSuffix(ml, "</mo>") || strings.HasSuffix(ml, "</mi>") {
+		return ml[:len(ml)-len("</mo>")] + "̸" + ml[len(ml)-len("</mo>"):]
+	}
+	return ml
+}
+
+// delimiter parses the delimiter after \left, \right, \middle or \big. An
+// empty string means the invisible delimiter ".".
+func (p *parser) delimiter(what string) (string, error) {
+	p.skipSpace()
+	if p.eof() {
+		return "", p.errorf(p.pos, "missing delimiter after %s", what)
+	}
+	start := p.pos
+	if p.src[p.pos] == '\\' {
+		name, n := p.peekCommand()
+		if s, ok := delimiters[name]; ok {
+			p.pos += n
+			return html.EscapeString(s), nil
+		}
+		return "", p.errorf(start, `\%s can't be used as a delimiter after %s`, name, what)
+	}
+	r, size := utf8.DecodeRuneInString(p.src[p.pos:])
+	if !strings.ContainsRune("()[]|/.<>", r) {
+		return "", p.errorf(start, "%q can't be used as a delimiter after %s", r, what)
+	}
+	p.pos += size
+	switch r {
+	case '.':
+		return "", nil
+	case '<':
+		return "⟨", nil
+	case '>':
+		return "⟩", nil
+	}
+	return string(r), nil
+}
+
+// parseFenced parses \left( … \right) into a row with stretchy fences.
+func (p *parser) parseFenced(start int) (atom, error) {
+	open, err := p.delimiter(`\left`)
+	if err != nil {
+		return atom{}, err
+	}
+	row, end, err := p.parseRow()
+	if err != nil {
+		return atom{}, err
+	}
+	if end.tok != `\right` {
+		if end.tok == "" {
+			return atom{}, p.errorf(start, `\left without a matching \right`)
+		}
+		return atom{}, p.unexpected(end, `\left … \right`)
+	}
+	closing, err := p.delimiter(`\right`)
+	if err != nil {
+		return atom{}, err
+	}
+
+	var b strings.Builder
+	b.WriteString("<mrow>")
+	if open != "" {
+		b.WriteString(`<mo fence="true" stretchy="true">` + open + "</mo>")
+	}
+	b.WriteString(strings.Join(row, ""))
+	if closing != "" {
+		b.WriteString(`<mo fence="true" stretchy="true">` + closing + "</mo>")
+	}
+	b.WriteString("</mrow>")
+	return atom{ml: b.String()}, nil
+}
+
+// parseEnvironment parses \begin{name} … \end{name} into a table.
+func (p *parser) parseEnvironment(start int) (atom, error) {
+	name, err := p.rawGroup(`\begin`)
+	if err != nil {
+		return atom{}, err
+	}
+	env, ok := environments[name]
+	if !ok {
+		return atom{}, &Error{Offset: start, Msg: fmt.Sprintf("unknown environment %q", name), Unknown: true}
+	}
+	align := env.Align
+	if name == "array" {
+		spec, err := p.rawGroup(`\begin{array}`)
+		if err != nil {
+			return atom{}, err
+		}
+		var cols []string
+		for _, c := range spec {
+			switch c {
+			case 'l':
+				cols = append(cols, "left")
+			case 'c':
+				cols = append(cols, "center")
+			case 'r':
+				cols = append(cols, "right")
+			}
+		}
+		align = strings.Join(cols, " ")
+	}
+
+	var rows [][]string
+	var cells []string
+	for {
+		cell, end, err := p.parseRow()
+		if err != nil {
+			return atom{}, err
+		}
+		cells = append(cells, mrow(cell))
+		switch end.tok {
+		case "&":
+			continue
+		case `\\`:
+			rows = append(rows, cells)
+			cells = nil
+			continue
+		case `\end`:
+			endName, err := p.rawGroup(`\end`)
+			if err != nil {
+				return atom{}, err
+			}
+			if endName != name {
+				return atom{}, p.errorf(end.pos, `\end{%s} doesn't match \begin{%s}`, endName, name)
+			}
+		case "":
+			return atom{}, p.errorf(start, `\begin{%s} without a matching \end{%s}`, name, name)
+		default:
+			return atom{}, p.unexpected(end, "environment")
+		}
+		break
+	}
+	// A trailing \\ leaves an empty last row, which TeX doesn't show.
+	if !(len(cells) == 1 && cells[0] == "<mrow></mrow>" && len(rows) > 0) {
+		rows = append(rows, cells)
+	}
+
+	var b strings.Builder
+	if env.Open != "" || env.Close != "" {
+		b.WriteString("<mrow>")
+		if env.Open != "" {
+			b.WriteString(`<mo fence="true" stretchy="true">` + env.Open + "</mo>")
+		}
+	}
+	b.WriteString("<mtable")
+	if align != "" {
+		b.WriteString(` columnalign="` + align + `"`)
+	}
+	if strings.HasPrefix(name, "align") || name == "split" || name == "aligned" {
+		b.WriteString(` displaystyle="true" columnspacing="0"`)
+	}
+	b.WriteString(">")
+	for _, row := range rows {
+		b.WriteString("<mtr>")
+		for _, cell := range row {
+			b.WriteString("<mtd>" + cell + "</mtd>")
+		}
+		b.WriteString("</mtr>")
+	}
+	b.WriteString("</mtable>")
+	if env.Open != "" || env.Close != "" {
+		if env.Close != "" {
+			b.WriteString(`<mo fence="true" stretchy="true">` + env.Close + "</mo>")
+		}
+		b.WriteString("</mrow>")
+	}
+	return atom{ml: b.String()}, nil
+}
+
+// mrow wraps a list of elements so it can be used as a single argument.
+func mrow(row []string) string {
+	if len(row) == 1 {
+		return row[0]
+	}
+	return "<mrow>" + strings.Join(row, "") + "</mrow>"
+}
@@ -0,0 +1,121 @@
+package mathml
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// body strips the <math> wrapper and annotation from a conversion.
+func body(t *testing.T, tex string, display bool) string {
+	t.Helper()
+	out, err := Convert(tex, display)
+	if err != nil {
+		t.Fatalf("Convert(%q) error: %v", tex, err)
+	}
+	start := strings.Index(out, "<semantics>") + len("<semantics>")
+	end := strings.Index(out, "<annotation")
+	return out[start:end]
+}
+
+func TestConvert(t *testing.T) {
+	tests := []struct {
+		tex, want string
+	}{
+		{`x`, `<mi>x</mi>`},
+		{`x^2 + 10`, `<mrow><msup><mi>x</mi><mn>2</mn></msup><mo>+</mo><mn>10</mn></mrow>`},
+		{`a_{ij} - b`, `<mrow><msub><mi>a</mi><mrow><mi>i</mi><mi>j</mi></mrow></msub><mo>−</mo><mi>b</mi></mrow>`},
+		{`x_1^2`, `<msubsup><mi>x</mi><mn>1</mn><mn>2</mn></msubsup>`},
+		{`f'(x)`, `<mrow><msup><mi>f</mi><mo>′</mo></msup><mo stretchy="false">(</mo><mi>x</mi><mo stretchy="false">)</mo></mrow>`},
+		{`\frac12`, `<mfrac><mn>1</mn><mn>2</mn></mfrac>`},
+		{`\frac{a}{b+c}`, `<mfrac><mi>a</mi><mrow><mi>b</mi><mo>+</mo><mi>c</mi></mrow></mfrac>`},
+		{`\sqrt{2}`, `<msqrt><mn>2</mn></msqrt>`},
+		{`\sqrt[3]{x}`, `<mroot><mi>x</mi><mn>3</mn></mroot>`},
+		{`\alpha \leq \Omega`, `<mrow><mi>α</mi><mo>≤</mo><mi mathvariant="normal">Ω</mi></mrow>`},
+		{`a < b`, `<mrow><mi>a</mi><mo>&lt;</mo><mi>b</mi></mrow>`},
+		{`\mathbb{R} \mathbf{v1} \mathcal{L}`, `<mrow><mi>ℝ</mi><mrow><mi>𝐯</mi><mn>𝟏</mn></mrow><mi>ℒ</mi></mrow>`},
+		{`\mathrm{d}x`, `<mrow><mi mathvariant="normal">d</mi><mi>x</mi></mrow>`},
+		{`\sin x`, `<mrow><mi>sin</mi><mo>⁡</mo><mi>x</mi></mrow>`},
+		{`\operatorname{tr} A`, `<mrow><mi>tr</mi><mo>⁡</mo><mi>A</mi></mrow>`},
+		{`\text{if } x > 0`, `<mrow><mtext>if </mtext><mi>x</mi><mo>&gt;</mo><mn>0</mn></mrow>`},
+		{`\hat{x}`, `<mover accent="true"><mi>x</mi><mo stretchy="false">^</mo></mover>`},
+		{`\overline{AB}`, `<mover accent="true"><mrow><mi>A</mi><mi>B</mi></mrow><mo stretchy="true">‾</mo></mover>`},
+		{`\left( x \right.`, `<mrow><mo fence="true" stretchy="true">(</mo><mi>x</mi></mrow>`},
+		{`\left\langle x \middle| y \right\rangle`, `<mrow><mo fence="true" stretchy="true">⟨</mo><mi>x</mi><mo stretchy="true">|</mo><mi>y</mi><mo fence="true" stretchy="true">⟩</mo></mrow>`},
+		{`a \quad b`, `<mrow><mi>a</mi><mspace width="1em"></mspace><mi>b</mi></mrow>`},
+		{`a \not= b`, `<mrow><mi>a</mi><mo>≠</mo><mi>b</mi></mrow>`},
+		{`\binom{n}{k}`, `<mrow><mo>(</mo><mfrac linethickness="0"><mi>n</mi><mi>k</mi></mfrac><mo>)</mo></mrow>`},
+		{"x % a comment\n+ 1", `<mrow><mi>x</mi><mo>+</mo><mn>1</mn></mrow>`},
+		{`\sum_{i=1}^n i`, `<mrow><msubsup><mo>∑</mo><mrow><mi>i</mi><mo>=</mo><mn>1</mn></mrow><mi>n</mi></msubsup><mi>i</mi></mrow>`},
+		{
+			`\begin{pmatrix} 1 & 0 \\ 0 & 1 \end{pmatrix}`,
+			`<mrow><mo fence="true" stretchy="true">(</mo><mtable><mtr><mtd><mn>1</mn></mtd><mtd><mn>0</mn></mtd></mtr><mtr><mtd><mn>0</mn></mtd><mtd><mn>1</mn></mtd></mtr></mtable><mo fence="true" stretchy="true">)</mo></mrow>`,
+		},
+		{
+			`|x| = \begin{cases} x & x \ge 0 \\ -x & \text{otherwise} \\ \end{cases}`,
+			`<mrow><mo stretchy="false">|</mo><mi>x</mi><mo stretchy="false">|</mo><mo>=</mo><mrow><mo fence="true" stretchy="true">{</mo><mtable columnalign="left"><mtr><mtd><mi>x</mi></mtd><mtd><mrow><mi>x</mi><mo>≥</mo><mn>0</mn></mrow></mtd></mtr><mtr><mtd><mrow><mo>−</mo><mi>x</mi></mrow></mtd><mtd><mtext>otherwise</mtext></mtd></mtr></mtable></mrow></mrow>`,
+		},
+	}
+	for _, tt := range tests {
+		if got := body(t, tt.tex, false); got != tt.want {
+			t.Errorf("Convert(%q) =\n%s\nwant\n%s", tt.tex, got, tt.want)
+		}
+	}
+}
+
+func TestConvertDisplay(t *testing.T) {
+	out, err := Convert(`\sum_{i=1}^n i`, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(out, `<math xmlns="http://www.w3.org/1998/Math/MathML" display="block">`) {
+		t.Errorf("display formula isn't a block: %s", out)
+	}
+	if !strings.Contains(out, `<munderover><mo>∑</mo>`) {
+		t.Errorf("display sum doesn't have limits above and below: %s", out)
+	}
+	if !strings.Contains(out, `<annotation encoding="application/x-tex">\sum_{i=1}^n i</annotation>`) {
+		t.Errorf("TeX source isn't kept as an annotation: %s", out)
+	}
+
+	if got := body(t, `\lim_{x \to 0} x`, true); !strings.HasPrefix(got, "<mrow><munder><mi>lim</mi>") {
+		t.Errorf("display limit = %s, want munder", got)
+	}
+	if got := body(t, `\sum\nolimits_i`, true); got != "<msub><mo>∑</mo><mi>i</mi></msub>" {
+		t.Errorf(`\nolimits = %s, want msub`, got)
+	}
+}
+
+func TestConvertErrors(t *testing.T) {
+	tests := []struct {
+		tex    string
+		offset int
+		msg    string
+	}{
+		{`x + \foo`, 4, `unknown command \foo`},
+		{`\frac{a`, 5, "missing } to close this {"},
+		{`a}`, 1, "unexpected } in formula, there is no { to close"},
+		{`x^`, 2, "missing argument for ^"},
+		{`x^1^2`, 3, "double superscript, use braces to group them"},
+		{`\left( x`, 0, `\left without a matching \right`},
+		{`x \right)`, 2, `\right without a matching \left`},
+		{`a & b`, 2, `& is only allowed inside an environment like \begin{aligned}`},
+		{`\begin{matrix} a \end{pmatrix}`, 17, `\end{pmatrix} doesn't match \begin{matrix}`},
+		{`\begin{foo}`, 0, `unknown environment "foo"`},
+		{`\sqrt[\foo]{x}`, 6, `unknown command \foo`},
+	}
+	for _, tt := range tests {
+		_, err := Convert(tt.tex, false)
+		var e *Error
+		if !errors.As(err, &e) {
+			t.Errorf("Convert(%q) error = %v, want *Error", tt.tex, err)
+			continue
+		}
+		if e.Msg != tt.msg || e.Offset != tt.offset {
+			t.Errorf("Convert(%q) error = %q at %d, want %q at %d", tt.tex, e.Msg, e.Offset, tt.msg, tt.offset)
+		}
+		if want := strings.HasPrefix(tt.msg, "unknown"); e.Unknown != want {
+			t.Errorf("Convert(%q) error Unknown = %v, want %v", tt.tex, e.Unknown, want)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package mathml
+
+// identifiers are commands that render as a single <mi>.
+var identifiers = map[string]string{
+	"alpha": "α", "beta": "β", "gamma": "γ", "delta": "δ", "epsilon": "ϵ",
+	"varepsilon": "ε", "zeta": "ζ", "eta": "η", "theta": "θ", "vartheta": "ϑ",
+	"iota": "ι", "kappa": "κ", "lambda": "λ", "mu": "μ", "nu": "ν", "xi": "ξ",
+	"omicron": "ο", "pi": "π", "varpi": "ϖ", "rho": "ρ", "varrho": "ϱ",
+	"sigma": "σ", "varsigma": "ς", "tau": "τ", "upsilon": "υ", "phi": "ϕ",
+	"varphi": "φ", "chi": "χ", "psi": "ψ", "omega": "ω",
+
+	"infty": "∞", "ell": "ℓ", "hbar": "ℏ", "nabla": "∇", "partial": "∂",
+	"emptyset": "∅", "varnothing": "∅", "aleph": "ℵ", "Re": "ℜ", "Im": "ℑ",
+	"wp": "℘", "top": "⊤", "bot": "⊥", "angle": "∠", "imath": "ı", "jmath": "ȷ",
+	"#": "#", "%": "%", "$": "$", "_": "_",
+}
+
+// uprightIdentifiers are capital Greek letters, which TeX sets upright.
+var uprightIdentifiers = map[string]string{
+	"Gamma": "Γ", "Delta": "Δ", "Theta": "Θ", "Lambda": "Λ", "Xi": "Ξ",
+	"Pi": "Π", "Sigma": "Σ", "Upsilon": "Υ", "Phi": "Φ", "Psi": "Ψ",
+	"Omega": "Ω",
+}
+
+// operators are commands that render as a single <mo>.
+var operators = map[string]string{
+	"pm": "±", "mp": "∓", "times": "×", "div": "÷", "cdot": "⋅", "ast": "∗",
+	"star": "⋆", "circ": "∘", "bullet": "∙", "oplus": "⊕", "ominus": "⊖",
+	"otimes": "⊗", "odot": "⊙", "cap": "∩", "cup": "∪", "wedge": "∧",
+	"land": "∧", "vee": "∨", "lor": "∨", "setminus": "∖", "dagger": "†",
+
+	"leq": "≤", "le": "≤", "geq": "≥", "ge": "≥", "neq": "≠", "ne": "≠",
+	"approx": "≈", "equiv": "≡", "sim": "∼", "simeq": "≃", "cong": "≅",
+	"propto": "∝", "ll": "≪", "gg": "≫", "subset": "⊂", "supset": "⊃",
+	"subseteq": "⊆", "supseteq": "⊇", "in": "∈", "notin": "∉", "ni": "∋",
+	"mid": "∣", "parallel": "∥", "perp": "⟂", "prec": "≺", "succ": "≻",
+	"preceq": "⪯", "succeq": "⪰", "doteq": "≐", "models": "⊨", "vdash": "⊢",
+
+	"to": "→", "rightarrow": "→", "leftarrow": "←", "gets": "←",
+	"leftrightarrow": "↔", "Rightarrow": "⇒", "Leftarrow": "⇐",
+	"Leftrightarrow": "⇔", "implies": "⟹", "impliedby": "⟸", "iff": "⟺",
+	"mapsto": "↦", "uparrow": "↑", "downarrow": "↓", "longrightarrow": "⟶",
+	"longleftarrow": "⟵", "longmapsto": "⟼", "hookrightarrow": "↪",
+
+	"forall": "∀", "exists": "∃", "nexists": "∄", "neg": "¬", "lnot": "¬",
+	"therefore": "∴", "because": "∵", "triangle": "△", "prime": "′",
+	"cdots": "⋯", "ldots": "…", "dots": "…", "vdots": "⋮", "ddots": "⋱",
+	"colon": ":", "backslash": "\\", "&": "&",
+
+	"int": "∫", "iint": "∬", "iiint": "∭", "oint": "∮",
+}
+
+// largeOperators take their scripts as limits above and below in display
+// mode.
+var largeOperators = map[string]string{
+	"sum": "∑", "prod": "∏", "coprod": "∐", "bigcup": "⋃", "bigcap": "⋂",
+	"bigoplus": "⨁", "bigotimes": "⨂", "bigodot": "⨀", "bigvee": "⋁",
+	"bigwedge": "⋀", "bigsqcup": "⨆",
+}
+
+// functions are set as upright names, like sin.
+var functions = map[string]bool{
+	"sin": true, "cos": true, "tan": true, "cot": true, "sec": true, "csc": true,
+	"arcsin": true, "arccos": true, "arctan": true, "sinh": true, "cosh": true,
+	"tanh": true, "coth": true, "log": true, "ln": true, "lg": true, "exp": true,
+	"det": true, "dim": true, "ker": true, "deg": true, "arg": true, "gcd": true,
+	"hom": true, "Pr": true,
+}
+
+// limitFunctions are functions whose subscripts go underneath in display
+// mode.
+var limitFunctions = map[string]string{
+	"lim": "lim", "limsup": "lim sup", "liminf": "lim inf", "max": "max",
+	"min": "min", "sup": "sup", "inf": "inf",
+}
+
+// delimiters are the commands allowed after \left, \right and \big.
+var delimiters = map[string]string{
+	"{": "{", "}": "}", "|": "‖", "langle": "⟨", "rangle": "⟩",
+	"lfloor": "⌊", "rfloor": "⌋", "lceil": "⌈", "rceil": "⌉", "vert": "|",
+	"Vert": "‖", "lvert": "|", "rvert": "|", "lVert": "‖", "rVert": "‖",
+	"backslash": "\\", "uparrow": "↑", "downarrow": "↓",
+}
+
+// spaces are the spacing commands, with their widths.
+var spaces = map[string]string{
+	",": "0.1667em", ":": "0.2222em", ">": "0.2222em", ";": "0.2778em",
+	"!": "-0.1667em", " ": "0.25em", "quad": "1em", "qquad": "2em",
+	"thinspace": "0.1667em", "medspace": "0.2222em", "thickspace": "0.2778em",
+	"enspace": "0.5em",
+}
+
+// accents are the commands that put a mark over their argument.
+var accents = map[string]string{
+	"hat": "^", "widehat": "^", "check": "ˇ", "tilde": "˜", "widetilde": "˜",
+	"bar": "‾", "overline": "‾", "vec": "→", "overrightarrow": "→",
+	"overleftarrow": "←", "dot": "˙", "ddot": "¨", "acute": "´", "grave": "`",
+	"breve": "˘", "overbrace": "⏞",
+}
+
+// underAccents put a mark under their argument.
+var underAccents = map[string]string{
+	"underline": "_", "underbrace": "⏟",
+}
+
+// bigSizes are the sizes of \big and friends.
+var bigSizes = map[string]string{
+	"big": "1.2em", "Big": "1.8em", "bigg": "2.4em", "Bigg": "3em",
+	"bigl": "1.2em", "Bigl": "1.8em", "biggl": "2.4em", "Biggl": "3em",
+	"bigr": "1.2em", "Bigr": "1.8em", "biggr": "2.4em", "Biggr": "3em",
+	"bigm": "1.2em", "Bigm": "1.8em", "biggm": "2.4em", "Biggm": "3em",
+}
+
+// variants maps font commands to the Unicode mathematical alphanumeric
+// style they select.
+var variants = map[string]string{
+	"mathbf": "bold", "boldsymbol": "bold", "mathit": "italic",
+	"mathbb": "double-struck", "mathcal": "script", "mathscr": "script",
+	"mathfrak": "fraktur", "mathsf": "sans-serif", "mathtt": "monospace",
+	"mathrm": "normal",
+}
+
+// alphabets gives the first code point of the capital letters, small
+// letters and digits of each style. Zero means the style has no digits.
+var alphabets = map[string][3]rune{
+	"bold":          {0x1D400, 0x1D41A, 0x1D7CE},
+	"italic":        {0x1D434, 0x1D44E, 0},
+	"script":        {0x1D49C, 0x1D4B6, 0},
+	"fraktur":       {0x1D504, 0x1D51E, 0},
+	"double-struck": {0x1D538, 0x1D552, 0x1D7D8},
+	"sans-serif":    {0x1D5A0, 0x1D5BA, 0x1D7E2},
+	"monospace":     {0x1D670, 0x1D68A, 0x1D7F6},
+}
+
+// alphabetHoles are letters that were encoded before the mathematical
+// alphanumeric block and are missing from it.
+var alphabetHoles = map[string]map[rune]rune{
+	"italic": {'h': 'ℎ'},
+	"script": {
+		'B': 'ℬ', 'E': 'ℰ', 'F': 'ℱ', 'H': 'ℋ', 'I': 'ℐ', 'L': 'ℒ', 'M': 'ℳ',
+		'R': 'ℛ', 'e': 'ℯ', 'g': 'ℊ', 'o': 'ℴ',
+	},
+	"fraktur":       {'C': 'ℭ', 'H': 'ℌ', 'I': 'ℑ', 'R': 'ℜ', 'Z': 'ℨ'},
+	"double-struck": {'C': 'ℂ', 'H': 'ℍ', 'N': 'ℕ', 'P': 'ℙ', 'Q': 'ℚ', 'R': 'ℝ', 'Z': 'ℤ'},
+}
+
+// environments maps the supported \begin environments to their fences and
+// column alignment.
+var environments = map[string]struct {
+	Open, Close string
+	Align       string // "", "left", or "right left" for alternating columns.
+}{
+	"matrix":   {},
+	"pmatrix":  {Open: "(", Close: ")"},
+	"bmatrix":  {Open: "[", Close: "]"},
+	"Bmatrix":  {Open: "{", Close: "}"},
+	"vmatrix":  {Open: "|", Close: "|"},
+	"Vmatrix":  {Open: "‖", Close: "‖"},
+	"cases":    {Open: "{", Align: "left"},
+	"aligned":  {Align: "right left"},
+	"align":    {Align: "right left"},
+	"align*":   {Align: "right left"},
+	"split":    {Align: "right left"},
+	"gathered": {},
+	"gather":   {},
+	"gather*":  {},
+	"array":    {},
+}
@@ -0,0 +1,286 @@
+package templatex
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"reflect"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Funcs returns the functions available in page and shortcode templates.
+// They are documented in the README.
+func Funcs() template.FuncMap {
+	return template.FuncMap{
+		"date":        formatDate,
+		"now":         time.Now,
+		"markdownify": markdownify,
+		"slugify":     slugify,
+		"truncate":    truncate,
+		"default":     defaultValue,
+		"dict":        dict,
+		"list":        list,
+		"join":        join,
+		"upper":       strings.ToUpper,
+		"lower":       strings.ToLower,
+		"replace":     replace,
+		"contains":    contains,
+		"safeHTML":    safeHTML,
+		"safeURL":     safeURL,
+		"jsonify":     jsonify,
+	}
+}
+
+var dateLayouts = []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02"}
+
+// ParseDate parses a date written like 2006-01-02, optionally with a time
+// as in 2006-01-02 15:04:05 or RFC 3339. Frontmatter dates and the date
+// function accept the same formats.
+func ParseDate(s string) (time.Time, bool) {
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// formatDate formats a time, or a string in one of the date formats
+// frontmatter accepts, with a Go layout: {{ date "2 January 2006" .Date }}.
+// A zero time gives an empty string, so pages without a date show nothing.
+func formatDate(layout string, v any) (string, error) {
+	switch d := v.(type) {
+	case time.Time:
+		if d.IsZero() {
+			return "", nil
+		}
+		return d.Format(layout), nil
+	case *time.Time:
+		if d == nil || d.IsZero() {
+			return "", nil
+		}
+		return d.Format(layout), nil
+	case string:
+		if d == "" {
+			return "", nil
+		}
+		if t, ok := ParseDate(d); ok {
+			return t.Format(layout), nil
+		}
+		return "", fmt.Errorf("date: %q is not a date like 2006-01-02", d)
+	case nil:
+		return "", nil
+	}
+	return "", fmt.Errorf("date: expected a time or string, got %T", v)
+}
+
+// inlineMarkdown renders markdown from frontmatter fields. Raw HTML and
+// dangerous links are dropped, as the text may come from untrusted pages.
+var inlineMarkdown = goldmark.New(goldmark.WithExtensions(extension.GFM, extension.Typographer))
+
+// markdownify renders a markdown string to HTML. A single paragraph is
+// unwrapped, so the result can be used inline.
+func markdownify(v any) (template.HTML, error) {
+	var buf bytes.Buffer
+	if err := inlineMarkdown.Convert([]byte(toString(v)), &buf); err != nil {
+		return "", err
+	}
+	b := bytes.TrimSpace(buf.Bytes())
+	if bytes.HasPrefix(b, []byte("<p>")) && bytes.HasSuffix(b, []byte("</p>")) && bytes.Count(b, []byte("<p>")) == 1 {
+		b = b[len("<p>") : len(b)-len("</p>")]
+	}
+	return template.HTML(b), nil
+}
+
+// Slugify turns text into a lowercase, URL-friendly slug: "Ünïcode & You"
+// becomes "unicode-you". Letters of other scripts are kept.
+func Slugify(s string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range norm.NFKD.String(s) {
+		switch {
+		case unicode.Is(unicode.Mn, r):
+			// Accents split off by the decomposition.
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			dash = false
+			b.WriteRune(unicode.ToLower(r))
+		default:
+			dash = true
+		}
+	}
+	return b.String()
+}
+
+func slugify(v any) string {
+	return Slugify(toString(v))
+}
+
+// truncate shortens text to at most n characters, cutting at a word boundary
+// where it can and adding an ellipsis: {{ truncate 140 .Desc }}.
+func truncate(n int, v any) string {
+	return Truncate(toString(v), n)
+}
+
+// Truncate shortens s to at most n characters, cutting at a word boundary
+// where it can. Trailing spaces and punctuation are trimmed from the cut and
+// an ellipsis is added after it, so the result can be n+1 characters long.
+func Truncate(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	if n <= 0 {
+		return ""
+	}
+	runes := []rune(s)
+	cut := string(runes[:n])
+	if i := strings.LastIndexFunc(cut, unicode.IsSpace); i > 0 && !unicode.IsSpace(runes[n]) {
+		cut = cut[:i]
+	}
+	return strings.TrimRightFunc(cut, func(r rune) bool {
+		return unicode.IsSpace(r) || unicode.IsPunct(r)
+	}) + "…"
+}
+
+// defaultValue returns v, or def if v is empty: {{ .Author | default "Anonymous" }}.
+func defaultValue(def, v any) any {
+	if isEmpty(v) {
+		return def
+	}
+	return v
+}
+
+func isEmpty(v any) bool {
+	if v == nil {
+		return true
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return rv.Len() == 0
+	case reflect.Pointer, reflect.Interface:
+		return rv.IsNil()
+	}
+	if t, ok := v.(time.Time); ok {
+		return t.IsZero()
+	}
+	return rv.IsZero()
+}
+
+// dict builds a map from key and value pairs, for passing several values to
+// a template: {{ template "card" dict "title" .Title "tags" .Tags }}.
+func dict(pairs ...any) (map[string]any, error) {
+	if len(pairs)%2 != 0 {
+		return nil, fmt.Errorf("dict: expected key and value pairs, got %d arguments", len(pairs))
+	}
+	m := make(map[string]any, len(pairs)/2)
+	for i := 0; i < len(pairs); i += 2 {
+		key, ok := pairs[i].(string)
+		if !ok {
+			return nil, fmt.Errorf("dict: key %v is a %T, not a string", pairs[i], pairs[i])
+		}
+		m[key] = pairs[i+1]
+	}
+	return m, nil
+}
+
+// list builds a list from its arguments: {{ range list "a" "b" }}.
+func list(items ...any) []any {
+	return items
+}
+
+// join joins the items of a list with sep: {{ join ", " .Tags }}.
+func join(sep string, v any) (string, error) {
+	switch items := v.(type) {
+	case nil:
+		return "", nil
+	case []string:
+		return strings.Join(items, sep), nil
+	case string:
+		return items, nil
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return "", fmt.Errorf("join: expected a list, got %T", v)
+	}
+	parts := make([]string, rv.Len())
+	for i := range parts {
+		parts[i] = toString(rv.Index(i).Interface())
+	}
+	return strings.Join(parts, sep), nil
+}
+
+// replace replaces every old with new: {{ replace "-" " " .Params.slug }}.
+func replace(old, new string, v any) string {
+	return strings.ReplaceAll(toString(v), old, new)
+}
+
+// contains reports whether a string contains substr, or a list contains an
+// item equal to it: {{ if contains "draft" .Tags }}. Items that print as a
+// string, like tags, match that string.
+func contains(substr, v any) bool {
+	if s, ok := v.(string); ok {
+		return strings.Contains(s, toString(substr))
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return false
+	}
+	s, isString := substr.(string)
+	for i := 0; i < rv.Len(); i++ {
+		item := rv.Index(i).Interface()
+		if reflect.DeepEqual(item, substr) {
+			return true
+		}
+		if str, ok := item.(fmt.Stringer); ok && isString && str.String() == s {
+			return true
+		}
+	}
+	return false
+}
+
+// safeHTML marks a string as trusted HTML so it isn't escaped. Only use it
+// for markup you control.
+func safeHTML(v any) template.HTML {
+	return template.HTML(toString(v))
+}
+
+// safeURL marks a string as a trusted URL, for schemes html/template would
+// otherwise replace, like tel: or data:.
+func safeURL(v any) template.URL {
+	return template.URL(toString(v))
+}
+
+// jsonify encodes a value as JSON, for use in a <script> element such as
+// JSON-LD: <script type="application/ld+json">{{ jsonify .Params.schema }}</script>.
+func jsonify(v any) (template.JS, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", fmt.Errorf("jsonify: %w", err)
+	}
+	return template.JS(b), nil
+}
+
+func toString(v any) string {
+	switch s := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return s
+	case template.HTML:
+		return string(s)
+	case fmt.Stringer:
+		return s.String()
+	}
+	return fmt.Sprint(v)
+}
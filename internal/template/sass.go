@@ -0,0 +1,168 @@
+package templatex
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bep/godartsass/v2"
+
+	"github.com/kscarlett/june/internal/diag"
+)
+
+// SassBinary is the Dart Sass executable used to compile SCSS and Sass
+// stylesheets. It is looked up in $PATH unless it is an absolute path.
+var SassBinary = "sass"
+
+// isSass reports whether the stylesheet at path needs compiling.
+func isSass(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".scss", ".sass":
+		return true
+	}
+	return false
+}
+
+// compileSass compiles an SCSS or indented Sass stylesheet to CSS. It returns
+// every file that was read, starting with path itself, even on failure, so
+// that a watcher can pick up fixes to a broken partial.
+func compileSass(path string, src []byte) (string, []string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", []string{path}, err
+	}
+	resolver := &sassResolver{dir: filepath.Dir(abs), files: []string{path}}
+
+	if _, err := exec.LookPath(SassBinary); err != nil {
+		return "", resolver.files, fmt.Errorf("compiling %s needs Dart Sass: install it from https://sass-lang.com/install and make sure %q is in your PATH", path, SassBinary)
+	}
+	transpiler, err := godartsass.Start(godartsass.Options{
+		DartSassEmbeddedFilename: SassBinary,
+		Timeout:                  30 * time.Second,
+	})
+	if err != nil {
+		return "", resolver.files, fmt.Errorf("failed to start Dart Sass: %w", err)
+	}
+	defer transpiler.Close()
+
+	res, err := transpiler.Execute(godartsass.Args{
+		Source:         string(src),
+		SourceSyntax:   sassSyntax(path),
+		ImportResolver: resolver,
+	})
+	if err != nil {
+		return "", resolver.files, sassError(path, src, err)
+	}
+	return res.CSS, resolver.files, nil
+}
+
+func sassSyntax(path string) godartsass.SourceSyntax {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".sass":
+		return godartsass.SourceSyntaxSASS
+	case ".css":
+		return godartsass.SourceSyntaxCSS
+	}
+	return godartsass.SourceSyntaxSCSS
+}
+
+// sassError turns a Dart Sass compile failure into a diag.Error located in
+// the stylesheet or partial where it happened.
+func sassError(path string, src []byte, err error) error {
+	var sassErr godartsass.SassError
+	if !errors.As(err, &sassErr) {
+		return err
+	}
+	file := path
+	if u := sassErr.Span.Url; u != "" {
+		if p, ok := fileURLPath(u); ok {
+			file = p
+			if b, err := os.ReadFile(p); err == nil {
+				src = b
+			} else {
+				src = nil
+			}
+		}
+	}
+	return diag.AtOffset(file, src, sassErr.Span.Start.Offset, sassErr.Message, err)
+}
+
+// sassResolver resolves @use, @forward and @import rules to files on disk,
+// relative to the importing stylesheet, and records every file it loads.
+type sassResolver struct {
+	dir   string // directory of the entry stylesheet
+	files []string
+}
+
+// CanonicalizeURL implements godartsass.ImportResolver. Dart Sass passes
+// imports of the entry stylesheet as written, and imports of partials
+// already resolved against the partial's file: URL.
+func (r *sassResolver) CanonicalizeURL(u string) (string, error) {
+	if strings.HasPrefix(u, "sass:") {
+		// Built-in modules are handled by Dart Sass itself.
+		return "", nil
+	}
+	base, ok := fileURLPath(u)
+	if !ok {
+		if strings.Contains(u, ":") {
+			return "", nil
+		}
+		base = filepath.Join(r.dir, filepath.FromSlash(u))
+	}
+	if file, ok := findPartial(base); ok {
+		return (&url.URL{Scheme: "file", Path: filepath.ToSlash(file)}).String(), nil
+	}
+	return "", nil
+}
+
+// Load implements godartsass.ImportResolver.
+func (r *sassResolver) Load(canonicalURL string) (godartsass.Import, error) {
+	file, ok := fileURLPath(canonicalURL)
+	if !ok {
+		return godartsass.Import{}, fmt.Errorf("can't load %s", canonicalURL)
+	}
+	r.files = append(r.files, file)
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return godartsass.Import{}, err
+	}
+	return godartsass.Import{Content: string(b), SourceSyntax: sassSyntax(file)}, nil
+}
+
+// findPartial applies Sass's rules for finding the file behind an import:
+// an optional leading underscore, an optional extension, and index files
+// for directories.
+func findPartial(base string) (string, bool) {
+	dir, name := filepath.Split(base)
+	var candidates []string
+	if ext := filepath.Ext(name); ext == ".scss" || ext == ".sass" || ext == ".css" {
+		candidates = []string{name, "_" + name}
+	} else {
+		for _, ext := range []string{".scss", ".sass", ".css"} {
+			candidates = append(candidates, name+ext, "_"+name+ext)
+		}
+		for _, ext := range []string{".scss", ".sass", ".css"} {
+			candidates = append(candidates, filepath.Join(name, "_index"+ext), filepath.Join(name, "index"+ext))
+		}
+	}
+	for _, c := range candidates {
+		p := filepath.Join(dir, c)
+		if info, err := os.Stat(p); err == nil && !info.IsDir() {
+			return p, true
+		}
+	}
+	return "", false
+}
+
+func fileURLPath(u string) (string, bool) {
+	parsed, err := url.Parse(u)
+	if err != nil || parsed.Scheme != "file" {
+		return "", false
+	}
+	return filepath.FromSlash(parsed.Path), true
+}
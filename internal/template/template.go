@@ -2,8 +2,21 @@ package templatex
 
 import (
 	"embed"
+	"errors"
+	"fmt"
 	"html/template"
+	"io"
+	"io/fs"
 	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/kscarlett/june/internal/diag"
 )
 
 var (
@@ -11,40 +24,359 @@ var (
 	embeddedFiles embed.FS
 )
 
-func LoadTemplate(templatePath string) (*template.Template, error) {
-	if _, err := os.Stat(templatePath); err == nil {
-		b, err := os.ReadFile(templatePath)
-		if err != nil {
-			return nil, err
+// Template is a parsed set of page templates: a base layout, the partials it
+// includes and the layouts pages can choose instead of the base. It
+// remembers where each part was loaded from, so errors can be reported
+// against the right file.
+type Template struct {
+	// Template is the base layout.
+	*template.Template
+
+	// Path is the file or directory the template was read from.
+	Path string
+
+	// Files lists the files and directories read from disk, so watch mode
+	// can rebuild when one of them changes. It is empty for the embedded
+	// template.
+	Files []string
+
+	layouts map[string]*template.Template
+	sources map[string]templateFile
+}
+
+// templateFile is one file of a template set.
+type templateFile struct {
+	path string // Shown in errors, "embedded:…" for embedded files.
+	src  []byte
+}
+
+// templateExts are the extensions of files loaded from a template directory.
+var templateExts = map[string]bool{".gohtml": true, ".html": true}
+
+// Execute applies the base layout to data, reporting failures at their
+// location in the template file.
+func (t *Template) Execute(w io.Writer, data any) error {
+	return t.ExecuteLayout(w, "", data)
+}
+
+// ExecuteLayout applies the named layout to data. An empty name or "default"
+// uses the base layout.
+func (t *Template) ExecuteLayout(w io.Writer, layout string, data any) error {
+	tmpl := t.Template
+	if layout != "" && layout != "default" {
+		if err := t.CheckLayout(layout); err != nil {
+			return err
 		}
-		tmpl, err := template.New("custom").Parse(string(b))
+		tmpl = t.layouts[layout]
+	}
+	if err := tmpl.Execute(w, data); err != nil {
+		return t.locate(err)
+	}
+	return nil
+}
+
+// Layouts returns the names of the layouts pages can choose, sorted.
+func (t *Template) Layouts() []string {
+	names := make([]string, 0, len(t.layouts))
+	for name := range t.layouts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// CheckLayout reports an error if pages can't use the named layout.
+func (t *Template) CheckLayout(layout string) error {
+	if _, ok := t.layouts[layout]; ok || layout == "" || layout == "default" {
+		return nil
+	}
+	if len(t.layouts) == 0 {
+		return fmt.Errorf("unknown layout %q, the template has no layouts", layout)
+	}
+	return fmt.Errorf("unknown layout %q, expected one of default, %s", layout, strings.Join(t.Layouts(), ", "))
+}
+
+// Embedded is the prefix of paths that name a template or style built into
+// june rather than a file, as in "embedded:default".
+const Embedded = "embedded:"
+
+// The embedded template and style used when no path is given.
+const (
+	DefaultTemplate = Embedded + "default"
+	DefaultStyle    = Embedded + "simple"
+)
+
+// PathError reports a template or style path that can't be used.
+type PathError struct {
+	Kind string // "template" or "style".
+	Path string
+	Err  error
+}
+
+func (e *PathError) Error() string {
+	switch {
+	case errors.Is(e.Err, fs.ErrNotExist):
+		return fmt.Sprintf("%s %s does not exist", e.Kind, e.Path)
+	case errors.Is(e.Err, fs.ErrPermission):
+		return fmt.Sprintf("%s %s can't be read: permission denied", e.Kind, e.Path)
+	}
+	return fmt.Sprintf("%s %s: %v", e.Kind, e.Path, e.Err)
+}
+
+func (e *PathError) Unwrap() error { return e.Err }
+
+// resolve checks a template or style path. For "embedded:<name>" and the
+// empty path, which stands for def, it returns the embedded name and no
+// file info.
+func resolve(kind, p, def string) (string, fs.FileInfo, error) {
+	if p == "" {
+		p = def
+	}
+	if name, ok := strings.CutPrefix(p, Embedded); ok {
+		return name, nil, nil
+	}
+	info, err := os.Stat(p)
+	if err != nil {
+		return "", nil, &PathError{Kind: kind, Path: p, Err: err}
+	}
+	return "", info, nil
+}
+
+// embeddedNames lists the embedded templates or styles in dir, by name.
+func embeddedNames(dir string) []string {
+	entries, _ := embeddedFiles.ReadDir(dir)
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		names = append(names, strings.TrimSuffix(e.Name(), path.Ext(e.Name())))
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LoadTemplate loads the page template at templatePath. A directory holds a
+// base.gohtml layout, partials in partials/ and page layouts in layouts/,
+// each replacing the embedded file of the same name. A single file replaces
+// just the base layout. "embedded:<name>" selects an embedded template, and
+// an empty path the default one. A path that doesn't exist is an error.
+//
+// If a file fails to parse, the returned template is unusable but still
+// lists the Files read, so watch mode picks up the fix.
+func LoadTemplate(templatePath string) (*Template, error) {
+	name, info, err := resolve("template", templatePath, DefaultTemplate)
+	if err != nil {
+		return nil, err
+	}
+	if info == nil {
+		files, err := embeddedTemplate(name)
 		if err != nil {
 			return nil, err
 		}
-		return tmpl, nil
+		return newTemplate(Embedded+name, nil, files)
 	}
-	b, err := embeddedFiles.ReadFile("files/templates/basic.gohtml")
+
+	files, err := embeddedTemplate("default")
 	if err != nil {
 		return nil, err
 	}
-	tmpl, err := template.New("default").Parse(string(b))
+	if info.IsDir() {
+		read, err := readTemplateDir(templatePath, files)
+		if err != nil {
+			return &Template{Path: templatePath, Files: read}, err
+		}
+		return newTemplate(templatePath, read, files)
+	}
+	b, err := os.ReadFile(templatePath)
+	if err != nil {
+		return nil, &PathError{Kind: "template", Path: templatePath, Err: err}
+	}
+	files["base"] = templateFile{path: templatePath, src: b}
+	return newTemplate(templatePath, []string{templatePath}, files)
+}
+
+// embeddedTemplate returns the files of the named embedded template, keyed
+// by their path without extension.
+func embeddedTemplate(name string) (map[string]templateFile, error) {
+	names := embeddedNames("files/templates")
+	if !slices.Contains(names, name) {
+		return nil, fmt.Errorf("unknown embedded template %q, expected one of %s", name, strings.Join(names, ", "))
+	}
+	files := make(map[string]templateFile)
+	root, err := fs.Sub(embeddedFiles, "files/templates/"+name)
 	if err != nil {
 		return nil, err
 	}
-	return tmpl, nil
+	err = fs.WalkDir(root, ".", func(rel string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		b, err := fs.ReadFile(root, rel)
+		if err != nil {
+			return err
+		}
+		files[strings.TrimSuffix(rel, path.Ext(rel))] = templateFile{path: Embedded + name + "/" + rel, src: b}
+		return nil
+	})
+	return files, err
+}
+
+// readTemplateDir adds the templates in dir to files, replacing embedded
+// ones, and returns the files and directories it read.
+func readTemplateDir(dir string, files map[string]templateFile) ([]string, error) {
+	var read []string
+	err := filepath.WalkDir(dir, func(file string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			read = append(read, file)
+			return nil
+		}
+		if !templateExts[filepath.Ext(file)] {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, file)
+		if err != nil {
+			return err
+		}
+		b, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		read = append(read, file)
+		rel = filepath.ToSlash(rel)
+		files[strings.TrimSuffix(rel, path.Ext(rel))] = templateFile{path: file, src: b}
+		return nil
+	})
+	if err != nil {
+		return read, fmt.Errorf("failed to read template directory %s: %w", dir, err)
+	}
+	return read, nil
+}
+
+// newTemplate parses a template set. Partials are parsed before the base
+// layout, so a single-file template can still redefine them, and each
+// layout is parsed into its own copy of the base so it can override the
+// base's blocks.
+func newTemplate(from string, read []string, files map[string]templateFile) (*Template, error) {
+	base := files["base"]
+	name := "custom"
+	if strings.HasPrefix(base.path, "embedded:") {
+		name = "default"
+	}
+	t := &Template{
+		Path:    from,
+		Files:   read,
+		layouts: make(map[string]*template.Template),
+		sources: make(map[string]templateFile),
+	}
+
+	keys := make([]string, 0, len(files))
+	for key := range files {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	root := template.New(name).Funcs(Funcs())
+	for _, key := range keys {
+		if partial, ok := strings.CutPrefix(key, "partials/"); ok {
+			if err := t.parse(root.New(partial), files[key]); err != nil {
+				return t, err
+			}
+		}
+	}
+	if err := t.parse(root, base); err != nil {
+		return t, err
+	}
+	for _, key := range keys {
+		if layout, ok := strings.CutPrefix(key, "layouts/"); ok {
+			clone, err := root.Clone()
+			if err != nil {
+				return t, err
+			}
+			if err := t.parse(clone.New(key), files[key]); err != nil {
+				return t, err
+			}
+			t.layouts[layout] = clone
+		}
+	}
+	t.Template = root
+	return t, nil
+}
+
+func (t *Template) parse(tmpl *template.Template, f templateFile) error {
+	t.sources[tmpl.Name()] = f
+	if _, err := tmpl.Parse(string(f.src)); err != nil {
+		return t.locate(err)
+	}
+	return nil
+}
+
+// Stylesheet is a loaded stylesheet along with the files it was built from.
+type Stylesheet struct {
+	CSS string
+
+	// Files lists the stylesheet file and, for SCSS and Sass, every partial
+	// it imports. It is empty for the embedded style.
+	Files []string
 }
 
 func LoadStyle(stylePath string) (string, error) {
-	if _, err := os.Stat(stylePath); err == nil {
-		b, err := os.ReadFile(stylePath)
+	style, err := LoadStylesheet(stylePath)
+	return style.CSS, err
+}
+
+// LoadStylesheet loads the stylesheet at stylePath, compiling it first if it
+// is SCSS or Sass. "embedded:<name>" selects an embedded style, and an empty
+// path the default one. A path that doesn't exist is an error.
+func LoadStylesheet(stylePath string) (Stylesheet, error) {
+	name, info, err := resolve("style", stylePath, DefaultStyle)
+	if err != nil {
+		return Stylesheet{}, err
+	}
+	if info == nil {
+		names := embeddedNames("files/styles")
+		if !slices.Contains(names, name) {
+			return Stylesheet{}, fmt.Errorf("unknown embedded style %q, expected one of %s", name, strings.Join(names, ", "))
+		}
+		b, err := embeddedFiles.ReadFile("files/styles/" + name + ".css")
 		if err != nil {
-			return "", err
+			return Stylesheet{}, err
 		}
-		return string(b), nil
+		return Stylesheet{CSS: string(b)}, nil
+	}
+	if info.IsDir() {
+		return Stylesheet{}, fmt.Errorf("style %s is a directory, not a stylesheet", stylePath)
 	}
-	b, err := embeddedFiles.ReadFile("files/styles/simple.css")
+
+	b, err := os.ReadFile(stylePath)
 	if err != nil {
-		return "", err
+		return Stylesheet{}, &PathError{Kind: "style", Path: stylePath, Err: err}
+	}
+	if isSass(stylePath) {
+		css, files, err := compileSass(stylePath, b)
+		return Stylesheet{CSS: css, Files: files}, err
+	}
+	return Stylesheet{CSS: string(b), Files: []string{stylePath}}, nil
+}
+
+// templateError matches the locations text/template and html/template put in
+// their error messages: "template: name:line: msg" for parse errors,
+// "template: name:line:col: msg" for execution errors and
+// "html/template:name:line[:col]: msg" for escaping errors.
+var templateError = regexp.MustCompile(`^(?:template: |html/template:)([^:]*):(\d+)(?::(\d+))?: (?s:(.*))$`)
+
+// locate converts a template error into a diag.Error in the file the named
+// template was parsed from. Errors without a location are returned unchanged.
+func (t *Template) locate(err error) error {
+	m := templateError.FindStringSubmatch(err.Error())
+	if m == nil {
+		return err
+	}
+	f, ok := t.sources[m[1]]
+	if !ok {
+		return err
 	}
-	return string(b), nil
+	line, _ := strconv.Atoi(m[2])
+	col, _ := strconv.Atoi(m[3])
+	return diag.New(f.path, f.src, line, col, m[4], err)
 }
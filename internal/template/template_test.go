@@ -1,11 +1,18 @@
 package templatex_test
 
 import (
+	"errors"
+	"html/template"
+	"io"
+	"io/fs"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/kscarlett/june/internal/diag"
 	templatex "github.com/kscarlett/june/internal/template"
 )
 
@@ -31,18 +38,55 @@ func TestLoadTemplate(t *testing.T) {
 		}
 	})
 
-	t.Run("falls back to embedded template if user path does not exist", func(t *testing.T) {
+	t.Run("loads embedded templates by name", func(t *testing.T) {
+		for _, path := range []string{"", templatex.DefaultTemplate, "embedded:default"} {
+			tmpl, err := templatex.LoadTemplate(path)
+			if err != nil {
+				t.Fatalf("LoadTemplate(%q) error = %v", path, err)
+			}
+			// The embedded template is named "default" in newTemplate.
+			if tmpl.Name() != "default" {
+				t.Errorf("LoadTemplate(%q) template named %q, want 'default'", path, tmpl.Name())
+			}
+		}
+	})
+
+	t.Run("errors on unknown embedded templates", func(t *testing.T) {
+		_, err := templatex.LoadTemplate("embedded:fancy")
+		if err == nil || err.Error() != `unknown embedded template "fancy", expected one of default` {
+			t.Errorf("LoadTemplate() error = %v", err)
+		}
+	})
+
+	t.Run("errors if user path does not exist", func(t *testing.T) {
 		tmpl, err := templatex.LoadTemplate("nonexistent/path/template.gohtml")
-		if err != nil {
-			t.Errorf("LoadTemplate() error = %v, wantErr nil (fallback expected)", err)
+		if tmpl != nil {
+			t.Errorf("LoadTemplate() returned a template, want nil")
 		}
-		if tmpl == nil {
-			t.Fatalf("LoadTemplate() returned nil template on fallback, want non-nil")
+		var pathErr *templatex.PathError
+		if !errors.As(err, &pathErr) || !errors.Is(err, fs.ErrNotExist) {
+			t.Fatalf("LoadTemplate() error = %v (%T), want a *PathError for a missing file", err, err)
+		}
+		if want := "template nonexistent/path/template.gohtml does not exist"; err.Error() != want {
+			t.Errorf("LoadTemplate() error = %q, want %q", err, want)
+		}
+	})
+
+	t.Run("errors if user path can't be read", func(t *testing.T) {
+		tempFile := filepath.Join(t.TempDir(), "locked.gohtml")
+		if err := os.WriteFile(tempFile, []byte("<html></html>"), 0o200); err != nil {
+			t.Fatalf("Failed to create temp template file: %v", err)
+		}
+		if f, err := os.Open(tempFile); err == nil {
+			f.Close()
+			t.Skip("file permissions aren't enforced for this user")
+		}
+		_, err := templatex.LoadTemplate(tempFile)
+		if !errors.Is(err, fs.ErrPermission) || errors.Is(err, fs.ErrNotExist) {
+			t.Fatalf("LoadTemplate() error = %v, want a permission error", err)
 		}
-		// Check if it's the default embedded template (e.g., by checking a known definition or name)
-		// The default template is named "default" in the LoadTemplate function
-		if tmpl.Name() != "default" {
-			t.Errorf("LoadTemplate() expected fallback to template named 'default', got '%s'", tmpl.Name())
+		if want := "template " + tempFile + " can't be read: permission denied"; err.Error() != want {
+			t.Errorf("LoadTemplate() error = %q, want %q", err, want)
 		}
 	})
 
@@ -60,6 +104,52 @@ func TestLoadTemplate(t *testing.T) {
 			t.Errorf("LoadTemplate() error = nil, wantErr for invalid template content")
 		}
 	})
+
+	t.Run("parse errors are located in the template file", func(t *testing.T) {
+		tempDir := t.TempDir()
+		invalidTemplateContent := "<html>\n  <title>{{ .Title }</title>\n</html>"
+		tempFile := filepath.Join(tempDir, "invalid.gohtml")
+		if err := os.WriteFile(tempFile, []byte(invalidTemplateContent), 0644); err != nil {
+			t.Fatalf("Failed to create temp invalid template file: %v", err)
+		}
+
+		_, err := templatex.LoadTemplate(tempFile)
+		var located *diag.Error
+		if !errors.As(err, &located) {
+			t.Fatalf("LoadTemplate() error = %v (%T), want *diag.Error", err, err)
+		}
+		if located.File != tempFile || located.Line != 2 {
+			t.Errorf("LoadTemplate() error at %s:%d, want %s:2", located.File, located.Line, tempFile)
+		}
+		if !strings.HasPrefix(err.Error(), tempFile+":2:") {
+			t.Errorf("LoadTemplate() error = %q, want compiler-style location prefix", err)
+		}
+		if !strings.Contains(located.Excerpt, "<title>{{ .Title }</title>") {
+			t.Errorf("LoadTemplate() error excerpt = %q, want offending line", located.Excerpt)
+		}
+	})
+
+	t.Run("execution errors are located in the template file", func(t *testing.T) {
+		tempDir := t.TempDir()
+		templateContent := "<html>\n  <title>{{ .Missing.Field }}</title>\n</html>"
+		tempFile := filepath.Join(tempDir, "exec.gohtml")
+		if err := os.WriteFile(tempFile, []byte(templateContent), 0644); err != nil {
+			t.Fatalf("Failed to create temp template file: %v", err)
+		}
+
+		tmpl, err := templatex.LoadTemplate(tempFile)
+		if err != nil {
+			t.Fatalf("LoadTemplate() error = %v, wantErr nil", err)
+		}
+		err = tmpl.Execute(io.Discard, struct{ Title string }{})
+		var located *diag.Error
+		if !errors.As(err, &located) {
+			t.Fatalf("Execute() error = %v (%T), want *diag.Error", err, err)
+		}
+		if located.Line != 2 || located.Col != 20 {
+			t.Errorf("Execute() error at %d:%d, want 2:20", located.Line, located.Col)
+		}
+	})
 }
 
 func TestLoadStyle(t *testing.T) {
@@ -80,33 +170,335 @@ func TestLoadStyle(t *testing.T) {
 		}
 	})
 
-	t.Run("falls back to embedded style if user path does not exist", func(t *testing.T) {
+	t.Run("loads embedded styles by name", func(t *testing.T) {
+		for _, path := range []string{"", templatex.DefaultStyle, "embedded:simple"} {
+			style, err := templatex.LoadStyle(path)
+			if err != nil {
+				t.Fatalf("LoadStyle(%q) error = %v", path, err)
+			}
+			if !strings.Contains(style, "body {") {
+				t.Errorf("LoadStyle(%q) style does not seem to be the embedded one, content: %s", path, style)
+			}
+		}
+	})
+
+	t.Run("errors on unknown embedded styles", func(t *testing.T) {
+		_, err := templatex.LoadStyle("embedded:fancy")
+		if err == nil || err.Error() != `unknown embedded style "fancy", expected one of simple` {
+			t.Errorf("LoadStyle() error = %v", err)
+		}
+	})
+
+	t.Run("errors if user path does not exist", func(t *testing.T) {
 		style, err := templatex.LoadStyle("nonexistent/path/style.css")
+		if style != "" {
+			t.Errorf("LoadStyle() returned a style, want none")
+		}
+		var pathErr *templatex.PathError
+		if !errors.As(err, &pathErr) || !errors.Is(err, fs.ErrNotExist) {
+			t.Fatalf("LoadStyle() error = %v (%T), want a *PathError for a missing file", err, err)
+		}
+		if want := "style nonexistent/path/style.css does not exist"; err.Error() != want {
+			t.Errorf("LoadStyle() error = %q, want %q", err, want)
+		}
+	})
+
+	t.Run("errors if user path is a directory", func(t *testing.T) {
+		_, err := templatex.LoadStyle(t.TempDir())
+		if err == nil || !strings.Contains(err.Error(), "is a directory") {
+			t.Errorf("LoadStyle() error = %v, want one for a directory", err)
+		}
+	})
+
+	t.Run("errors if user path can't be read", func(t *testing.T) {
+		tempFile := filepath.Join(t.TempDir(), "locked.css")
+		if err := os.WriteFile(tempFile, []byte("body {}"), 0o200); err != nil {
+			t.Fatalf("Failed to create temp style file: %v", err)
+		}
+		if f, err := os.Open(tempFile); err == nil {
+			f.Close()
+			t.Skip("file permissions aren't enforced for this user")
+		}
+		_, err := templatex.LoadStyle(tempFile)
+		if !errors.Is(err, fs.ErrPermission) || errors.Is(err, fs.ErrNotExist) {
+			t.Fatalf("LoadStyle() error = %v, want a permission error", err)
+		}
+	})
+}
+
+func TestLoadStylesheetSass(t *testing.T) {
+	t.Run("explains how to install Dart Sass when it is missing", func(t *testing.T) {
+		saved := templatex.SassBinary
+		templatex.SassBinary = "june-test-no-such-sass"
+		defer func() { templatex.SassBinary = saved }()
+
+		file := filepath.Join(t.TempDir(), "style.scss")
+		if err := os.WriteFile(file, []byte("$c: red;\nbody { color: $c; }\n"), 0644); err != nil {
+			t.Fatalf("Failed to create temp style file: %v", err)
+		}
+		style, err := templatex.LoadStylesheet(file)
+		if err == nil || !strings.Contains(err.Error(), "sass-lang.com/install") {
+			t.Errorf("LoadStylesheet() error = %v, want install hint", err)
+		}
+		if len(style.Files) != 1 || style.Files[0] != file {
+			t.Errorf("LoadStylesheet() files = %v, want [%s]", style.Files, file)
+		}
+	})
+
+	if _, err := exec.LookPath(templatex.SassBinary); err != nil {
+		// CI installs Dart Sass, so the compile tests must run there.
+		if os.Getenv("CI") != "" {
+			t.Fatalf("Dart Sass is not installed: %v", err)
+		}
+		t.Skip("Dart Sass is not installed")
+	}
+
+	t.Run("compiles SCSS with partials", func(t *testing.T) {
+		dir := t.TempDir()
+		files := map[string]string{
+			"style.scss":         "@use 'theme/colors';\nbody { color: colors.$text; }\n",
+			"theme/_colors.scss": "$text: #123456;\n",
+		}
+		for name, content := range files {
+			p := filepath.Join(dir, name)
+			if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		style, err := templatex.LoadStylesheet(filepath.Join(dir, "style.scss"))
+		if err != nil {
+			t.Fatalf("LoadStylesheet() error = %v", err)
+		}
+		if !strings.Contains(style.CSS, "#123456") {
+			t.Errorf("LoadStylesheet() css = %q, want the partial's color", style.CSS)
+		}
+		if len(style.Files) != 2 || !strings.HasSuffix(style.Files[1], "_colors.scss") {
+			t.Errorf("LoadStylesheet() files = %v, want the stylesheet and its partial", style.Files)
+		}
+	})
+
+	t.Run("locates syntax errors", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "style.sass")
+		if err := os.WriteFile(file, []byte("body\n  color: $missing\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		_, err := templatex.LoadStylesheet(file)
+		var located *diag.Error
+		if !errors.As(err, &located) {
+			t.Fatalf("LoadStylesheet() error = %v (%T), want *diag.Error", err, err)
+		}
+		if located.Line != 2 {
+			t.Errorf("LoadStylesheet() error at line %d, want 2", located.Line)
+		}
+	})
+}
+
+func TestFuncs(t *testing.T) {
+	date := time.Date(2024, time.March, 5, 14, 30, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		tmpl    string
+		data    any
+		want    string
+		wantErr string
+	}{
+		{name: "date formats a time", tmpl: `{{ date "2 January 2006" . }}`, data: date, want: "5 March 2024"},
+		{name: "date parses a string", tmpl: `{{ date "Jan 2, 2006" "2024-03-05" }}`, want: "Mar 5, 2024"},
+		{name: "date of zero time is empty", tmpl: `{{ date "2006" . }}`, data: time.Time{}, want: ""},
+		{name: "date rejects other strings", tmpl: `{{ date "2006" "soon" }}`, wantErr: `"soon" is not a date`},
+		{name: "now", tmpl: `{{ gt (now.Year) 2000 }}`, want: "true"},
+		{name: "markdownify unwraps a paragraph", tmpl: `{{ markdownify "Hello *world*" }}`, want: "Hello <em>world</em>"},
+		{name: "markdownify keeps blocks", tmpl: `{{ markdownify "a\n\nb" }}`, want: "<p>a</p>\n<p>b</p>"},
+		{name: "markdownify drops raw html", tmpl: `{{ markdownify "<script>x</script>" }}`, want: "<!-- raw HTML omitted -->"},
+		{name: "slugify", tmpl: `{{ slugify "  Ünïcode & You: Part 2! " }}`, want: "unicode-you-part-2"},
+		{name: "slugify keeps other scripts", tmpl: `{{ slugify "Привет мир" }}`, want: "привет-мир"},
+		{name: "truncate cuts at a word", tmpl: `{{ truncate 12 "The quick brown fox" }}`, want: "The quick…"},
+		{name: "truncate leaves short text", tmpl: `{{ truncate 50 "Short." }}`, want: "Short."},
+		{name: "truncate counts characters", tmpl: `{{ truncate 3 "日本語です" }}`, want: "日本語…"},
+		{name: "truncate trims punctuation", tmpl: `{{ truncate 10 "Hello, world, again" }}`, want: "Hello…"},
+		{name: "truncate to nothing", tmpl: `{{ truncate 0 "Hello" }}`, want: ""},
+		{name: "default replaces empty", tmpl: `{{ .Author | default "Anonymous" }}`, data: map[string]any{"Author": ""}, want: "Anonymous"},
+		{name: "default keeps a value", tmpl: `{{ .Author | default "Anonymous" }}`, data: map[string]any{"Author": "Ada"}, want: "Ada"},
+		{name: "default replaces missing", tmpl: `{{ .Author | default "Anonymous" }}`, data: map[string]any{}, want: "Anonymous"},
+		{name: "dict", tmpl: `{{ with dict "a" 1 "b" "two" }}{{ .a }} {{ .b }}{{ end }}`, want: "1 two"},
+		{name: "dict needs pairs", tmpl: `{{ dict "a" }}`, wantErr: "expected key and value pairs"},
+		{name: "dict needs string keys", tmpl: `{{ dict 1 2 }}`, wantErr: "not a string"},
+		{name: "list", tmpl: `{{ range list "a" "b" "c" }}[{{ . }}]{{ end }}`, want: "[a][b][c]"},
+		{name: "join", tmpl: `{{ join ", " (list "go" 1 true) }}`, want: "go, 1, true"},
+		{name: "join strings", tmpl: `{{ join " / " . }}`, data: []string{"a", "b"}, want: "a / b"},
+		{name: "upper and lower", tmpl: `{{ upper "abc" }} {{ lower "DEF" }}`, want: "ABC def"},
+		{name: "replace", tmpl: `{{ replace "-" " " "a-b-c" }}`, want: "a b c"},
+		{name: "contains string", tmpl: `{{ contains "ell" "hello" }}`, want: "true"},
+		{name: "contains list", tmpl: `{{ contains "draft" . }} {{ contains "x" . }}`, data: []any{"go", "draft"}, want: "true false"},
+		{name: "contains stringers", tmpl: `{{ contains "March" . }} {{ contains "x" . }}`, data: []time.Month{time.March, time.May}, want: "true false"},
+		{name: "safeHTML", tmpl: `{{ safeHTML "<b>bold</b>" }}`, want: "<b>bold</b>"},
+		{name: "escaped without safeHTML", tmpl: `{{ "<b>bold</b>" }}`, want: "&lt;b&gt;bold&lt;/b&gt;"},
+		{name: "safeURL", tmpl: `<a href="{{ safeURL "tel:555-0100" }}">`, want: `<a href="tel:555-0100">`},
+		{name: "jsonify", tmpl: `<script type="application/ld+json">{{ jsonify . }}</script>`, data: map[string]any{"name": "June", "tags": []string{"a"}}, want: `<script type="application/ld+json">{"name":"June","tags":["a"]}</script>`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := template.New("test").Funcs(templatex.Funcs()).Parse(tt.tmpl)
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			var b strings.Builder
+			err = tmpl.Execute(&b, tt.data)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Execute() error = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Execute() error = %v", err)
+			}
+			if got := strings.TrimSpace(b.String()); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadTemplateFuncs(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "page.gohtml")
+	if err := os.WriteFile(path, []byte(`<h1>{{ .Title | default "Untitled" | upper }}</h1>`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tmpl, err := templatex.LoadTemplate(path)
+	if err != nil {
+		t.Fatalf("LoadTemplate() error = %v", err)
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, map[string]any{}); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	if got, want := b.String(), "<h1>UNTITLED</h1>"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestLoadTemplateDir(t *testing.T) {
+	write := func(t *testing.T, dir string, files map[string]string) {
+		t.Helper()
+		for name, content := range files {
+			path := filepath.Join(dir, filepath.FromSlash(name))
+			if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	execute := func(t *testing.T, tmpl *templatex.Template, layout string) string {
+		t.Helper()
+		var b strings.Builder
+		data := map[string]any{"Title": "Page", "Lang": "en", "Content": template.HTML("<p>Body</p>")}
+		if err := tmpl.ExecuteLayout(&b, layout, data); err != nil {
+			t.Fatalf("ExecuteLayout(%q) error = %v", layout, err)
+		}
+		return b.String()
+	}
+
+	t.Run("partials replace embedded ones one at a time", func(t *testing.T) {
+		dir := t.TempDir()
+		write(t, dir, map[string]string{"partials/footer.gohtml": `<footer>{{ .Title }}</footer>`})
+		tmpl, err := templatex.LoadTemplate(dir)
 		if err != nil {
-			t.Errorf("LoadStyle() error = %v, wantErr nil (fallback expected)", err)
-		}
-		if style == "" {
-			t.Errorf("LoadStyle() returned empty style on fallback, want non-empty")
-		}
-		// A simple check for some known content from the embedded simple.css
-		// For example, embeddedFiles.ReadFile("files/styles/simple.css")
-		// Let's assume it contains "body {"
-		if !strings.Contains(style, "body {") {
-			t.Errorf("LoadStyle() fallback style does not seem to be the embedded one, content: %s", style)
-		}
-	})
-
-	// Test for os.ReadFile error on an existing file is harder to reliably set up
-	// without OS-level manipulations (e.g. changing permissions after stat).
-	// The current LoadStyle first stats, then reads. If stat fails, it falls back.
-	// If ReadFile fails after stat succeeded, it returns an error.
-	// This case is implicitly covered if ReadFile fails for a valid path.
-	// For example, if the file is deleted between Stat and ReadFile (race condition),
-	// or if the file has permissions that allow Stat but not Read.
-	// We can simulate the ReadFile error by making the file unreadable after stat,
-	// but that's complex. A simpler approach for now is to ensure that if a file path *is* valid
-	// and readable, it's loaded, and if it's not (and Stat fails), fallback occurs.
-	// The "errors on invalid user-provided template" for LoadTemplate covers a similar
-	// scenario where the file is readable but content is bad. For LoadStyle, content
-	// validity isn't parsed like templates, just read.
+			t.Fatalf("LoadTemplate() error = %v", err)
+		}
+		got := execute(t, tmpl, "")
+		for _, want := range []string{"<title>Page</title>", "<p>Body</p><footer>Page</footer>\n  </body>"} {
+			if !strings.Contains(got, want) {
+				t.Errorf("output = %q, want it to contain %q", got, want)
+			}
+		}
+		wantFiles := []string{dir, filepath.Join(dir, "partials"), filepath.Join(dir, "partials", "footer.gohtml")}
+		if strings.Join(tmpl.Files, "|") != strings.Join(wantFiles, "|") {
+			t.Errorf("Files = %v, want %v", tmpl.Files, wantFiles)
+		}
+	})
+
+	t.Run("layouts override blocks of the base", func(t *testing.T) {
+		dir := t.TempDir()
+		write(t, dir, map[string]string{
+			"base.gohtml":         `<body>{{ template "nav" . }}{{ block "main" . }}{{ .Content }}{{ end }}</body>`,
+			"partials/nav.gohtml": `<nav>{{ .Title }}</nav>`,
+			"layouts/post.gohtml": `{{ define "main" }}<article>{{ .Content }}</article>{{ end }}`,
+			"layouts/index.html":  `{{ define "main" }}<ul></ul>{{ end }}`,
+			"layouts/notes.txt":   `ignored`,
+		})
+		tmpl, err := templatex.LoadTemplate(dir)
+		if err != nil {
+			t.Fatalf("LoadTemplate() error = %v", err)
+		}
+		if got, want := strings.Join(tmpl.Layouts(), ","), "index,post"; got != want {
+			t.Errorf("Layouts() = %q, want %q", got, want)
+		}
+		tests := map[string]string{
+			"":        "<body><nav>Page</nav><p>Body</p></body>",
+			"default": "<body><nav>Page</nav><p>Body</p></body>",
+			"post":    "<body><nav>Page</nav><article><p>Body</p></article></body>",
+			"index":   "<body><nav>Page</nav><ul></ul></body>",
+		}
+		for layout, want := range tests {
+			if got := execute(t, tmpl, layout); got != want {
+				t.Errorf("ExecuteLayout(%q) = %q, want %q", layout, got, want)
+			}
+		}
+	})
+
+	t.Run("unknown layouts are errors", func(t *testing.T) {
+		dir := t.TempDir()
+		write(t, dir, map[string]string{"layouts/post.gohtml": `{{ define "main" }}{{ end }}`})
+		tmpl, err := templatex.LoadTemplate(dir)
+		if err != nil {
+			t.Fatalf("LoadTemplate() error = %v", err)
+		}
+		err = tmpl.ExecuteLayout(io.Discard, "pots", nil)
+		if err == nil || err.Error() != `unknown layout "pots", expected one of default, post` {
+			t.Errorf("ExecuteLayout() error = %v", err)
+		}
+		embedded, err := templatex.LoadTemplate(templatex.DefaultTemplate)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := embedded.CheckLayout("post"); err == nil {
+			t.Errorf("CheckLayout() on the embedded template = nil, want an error")
+		}
+	})
+
+	t.Run("errors are located in the partial", func(t *testing.T) {
+		dir := t.TempDir()
+		write(t, dir, map[string]string{"partials/header.gohtml": "<header>\n  {{ .Title.Missing }}\n</header>"})
+		tmpl, err := templatex.LoadTemplate(dir)
+		if err != nil {
+			t.Fatalf("LoadTemplate() error = %v", err)
+		}
+		err = tmpl.Execute(io.Discard, map[string]any{"Title": "Page"})
+		var located *diag.Error
+		if !errors.As(err, &located) {
+			t.Fatalf("Execute() error = %v (%T), want *diag.Error", err, err)
+		}
+		if want := filepath.Join(dir, "partials", "header.gohtml"); located.File != want || located.Line != 2 {
+			t.Errorf("Execute() error at %s:%d, want %s:2", located.File, located.Line, want)
+		}
+	})
+
+	t.Run("a single file can use and redefine partials", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "page.gohtml")
+		write(t, filepath.Dir(path), map[string]string{"page.gohtml": `<head>{{ template "head" . }}</head>{{ template "footer" . }}{{ define "footer" }}<footer></footer>{{ end }}`})
+		tmpl, err := templatex.LoadTemplate(path)
+		if err != nil {
+			t.Fatalf("LoadTemplate() error = %v", err)
+		}
+		got := execute(t, tmpl, "")
+		if !strings.Contains(got, "<title>Page</title>") || !strings.HasSuffix(got, "</head><footer></footer>") {
+			t.Errorf("output = %q, want the embedded head and the file's footer", got)
+		}
+	})
 }
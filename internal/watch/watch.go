@@ -3,35 +3,50 @@ package watch
 import (
 	"context"
 	"fmt"
+	"os"
 	"time"
 
 	"github.com/fsnotify/fsnotify"
+	"github.com/kscarlett/june/internal/diag"
 	"github.com/kscarlett/june/internal/generate"
 )
 
-func Run(ctx context.Context, input, output string, ugc bool, stylePath, templatePath string) error {
+func Run(ctx context.Context, cfg generate.GenerateConfig) error {
 	watcher, err := fsnotify.NewWatcher()
 	if err != nil {
 		return fmt.Errorf("error setting up watcher: %w", err)
 	}
 	defer watcher.Close()
 
-	err = watcher.Add(input)
+	err = watcher.Add(cfg.Input)
 	if err != nil {
-		return fmt.Errorf("error adding file %s to watcher: %w", input, err)
+		return fmt.Errorf("error adding file %s to watcher: %w", cfg.Input, err)
 	}
+	watched := map[string]bool{cfg.Input: true}
 
-	fmt.Println("Watching for changes. Press Ctrl+C to stop.")
-	if errGen := generate.Generate(generate.GenerateConfig{
-		Input:    input,
-		Output:   output,
-		Style:    stylePath,
-		Template: templatePath,
-		Ugc:      ugc,
-	}); errGen != nil {
-		fmt.Println("Initial generation error:", errGen)
+	// build regenerates the page and starts watching any source file it
+	// picked up, like a newly imported SCSS partial.
+	build := func(errPrefix string) {
+		res, errGen := generate.Build(cfg)
+		if errGen != nil {
+			fmt.Fprintln(os.Stderr, errPrefix)
+			diag.Print(os.Stderr, errGen)
+		}
+		for _, file := range res.Sources {
+			if watched[file] {
+				continue
+			}
+			if err := watcher.Add(file); err != nil {
+				diag.Print(os.Stderr, fmt.Errorf("watching %s: %w", file, err))
+				continue
+			}
+			watched[file] = true
+		}
 	}
 
+	fmt.Println("Watching for changes. Press Ctrl+C to stop.")
+	build("Initial generation error:")
+
 	for {
 		select {
 		case <-ctx.Done():
@@ -44,15 +59,7 @@ func Run(ctx context.Context, input, output string, ugc bool, stylePath, templat
 			if event.Op&fsnotify.Write == fsnotify.Write || event.Op&fsnotify.Create == fsnotify.Create {
 				fmt.Println("File changed, regenerating...")
 				time.Sleep(100 * time.Millisecond) // debounce
-				if errGen := generate.Generate(generate.GenerateConfig{
-					Input:    input,
-					Output:   output,
-					Style:    stylePath,
-					Template: templatePath,
-					Ugc:      ugc,
-				}); errGen != nil {
-					fmt.Println("Generation error:", errGen)
-				}
+				build("Generation error:")
 			}
 		case err, ok := <-watcher.Errors:
 			if !ok {
@@ -61,7 +68,7 @@ func Run(ctx context.Context, input, output string, ugc bool, stylePath, templat
 			}
 			// Log watcher errors but continue running, as they might be transient
 			// or related to specific files that can't be watched.
-			fmt.Println("Watcher error:", err)
+			diag.Print(os.Stderr, fmt.Errorf("watcher: %w", err))
 		}
 	}
 }
@@ -5,6 +5,8 @@ import (
 	"path/filepath"
 	"testing"
 	"time"
+
+	"github.com/kscarlett/june/internal/generate"
 )
 
 func TestRun_WatcherAddError(t *testing.T) {
@@ -17,7 +19,7 @@ func TestRun_WatcherAddError(t *testing.T) {
 
 	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
 	defer cancel()
-	err := Run(ctx, nonExistentFilePath, dummyOutputPath, false, "", "")
+	err := Run(ctx, generate.GenerateConfig{Input: nonExistentFilePath, Output: dummyOutputPath})
 	if err == nil {
 		t.Errorf("Run() with nonExistentFilePath %q expected an error due to watcher.Add failure, but got nil", nonExistentFilePath)
 	} else {
@@ -34,7 +36,7 @@ func TestRun_WatcherAddError(t *testing.T) {
 	emptyPath := ""
 	ctx2, cancel2 := context.WithTimeout(context.Background(), 2*time.Second)
 	defer cancel2()
-	err = Run(ctx2, emptyPath, dummyOutputPath, false, "", "")
+	err = Run(ctx2, generate.GenerateConfig{Input: emptyPath, Output: dummyOutputPath})
 	if err == nil {
 		t.Errorf("Run() with empty input path expected an error, but got nil")
 	} else {